@@ -0,0 +1,113 @@
+package main
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// LocationMarks is a sum and count of marks given to a location by users of
+// one gender born in one month. User age depends only on birth year and month
+// (see getUserAge), so age filters can be answered from these buckets exactly.
+type LocationMarks struct {
+	Location   int
+	Gender     string
+	BirthYear  int
+	BirthMonth int
+	MarksSum   int
+	MarksCnt   int
+}
+
+func (LocationMarks) TableName() string {
+	return "location_marks"
+}
+
+const locationMarksUpsertQuery = `
+INSERT INTO location_marks (location, gender, birth_year, birth_month, marks_sum, marks_cnt)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (location, gender, birth_year, birth_month) DO UPDATE SET
+marks_sum = marks_sum + excluded.marks_sum,
+marks_cnt = marks_cnt + excluded.marks_cnt
+`
+
+func getUserBirthMonth(u User) (int, int) {
+	year, month, _ := time.Unix(int64(u.BirthDate), 0).Date()
+	return year, int(month)
+}
+
+func getAgeByBirthMonth(year int, month int) int {
+	y, M, _ := time.Now().Date()
+	years := y - year
+	if int(M)-month < 0 {
+		years--
+	}
+	return years
+}
+
+func addLocationMarks(db *gorm.DB, location int, u User, marksSum int, marksCnt int) error {
+	year, month := getUserBirthMonth(u)
+	err := db.Exec(locationMarksUpsertQuery, location, u.Gender, year, month, marksSum, marksCnt).Error
+	if err != nil {
+		return err
+	}
+	if marksCnt < 0 {
+		return db.Where("location = ? AND marks_cnt <= 0", location).Delete(LocationMarks{}).Error
+	}
+	return nil
+}
+
+// applyVisitMarks adds (sign = 1) or removes (sign = -1) visit mark from
+// location aggregates. Visits of non-existent users aren't counted.
+func applyVisitMarks(db *gorm.DB, v Visit, sign int) error {
+	var u User
+	db.Where("id = ?", v.User).First(&u)
+	if (u == User{}) {
+		return nil
+	}
+	return addLocationMarks(db, v.Location, u, sign*v.Mark, sign)
+}
+
+// applyUserMarks adds (sign = 1) or removes (sign = -1) marks of all user
+// visits from location aggregates.
+func applyUserMarks(db *gorm.DB, u User, sign int) error {
+	if (u == User{}) {
+		return nil
+	}
+	var visits []Visit
+	if err := db.Where("user = ?", u.ID).Find(&visits).Error; err != nil {
+		return err
+	}
+	for _, v := range visits {
+		if err := addLocationMarks(db, v.Location, u, sign*v.Mark, sign); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getLocationMarks returns the same sum and count as filterVisitsGetMarks
+// without date filters, using precomputed aggregates.
+func getLocationMarks(db *gorm.DB, id string, fromAge int, toAge int, gender string) (int, int) {
+	query := db.Where("location = ?", id)
+	if gender != "" {
+		query = query.Where("gender = ?", gender)
+	}
+	var buckets []LocationMarks
+	query.Find(&buckets)
+
+	marksSum := 0
+	marksCnt := 0
+	for _, b := range buckets {
+		// age is 0 without fromAge like in filterVisitsGetMarks
+		age := 0
+		if fromAge != -1 {
+			age = getAgeByBirthMonth(b.BirthYear, b.BirthMonth)
+		}
+		if (fromAge != -1 && age <= fromAge) || (toAge != -1 && age >= toAge) {
+			continue
+		}
+		marksSum += b.MarksSum
+		marksCnt += b.MarksCnt
+	}
+	return marksSum, marksCnt
+}
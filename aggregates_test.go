@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func postJSON(t *testing.T, url string, payload string) {
+	req, _ := http.NewRequest("POST", url, bytes.NewBufferString(payload))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
+
+// baselineFilterVisitsGetMarks is filterVisitsGetMarks before aggregates,
+// averages must stay the same
+func baselineFilterVisitsGetMarks(id string, fromDate string, toDate string, fromAge int, toAge int, gender string) (int, int) {
+	db := InitDb()
+	defer db.Close()
+
+	var visits []Visit
+	db.Where("location = ?", id).Find(&visits)
+	marksSum := 0
+	marksCnt := 0
+	for _, v := range visits {
+		model, statusCode := getOrUpdateEntity("users", strconv.Itoa(v.User), GET)
+		if statusCode != 200 {
+			continue
+		}
+		vUser := model.(User)
+		var userAge int
+		if fromAge != -1 {
+			ts := time.Unix(int64(vUser.BirthDate), 0)
+			now := time.Now()
+			y1, M1, _ := ts.Date()
+			y2, M2, _ := now.Date()
+			userAge = y2 - y1
+			if int(M2-M1) < 0 {
+				userAge--
+			}
+		}
+		if (gender == "" || vUser.Gender == gender) && (fromAge == -1 || userAge > fromAge) && (toAge == -1 || userAge < toAge) && (fromDate == "" || v.VisitedAt > fromDate) && (toDate == "" || v.VisitedAt < toDate) {
+			marksSum += v.Mark
+			marksCnt += 1
+		}
+	}
+	return marksSum, marksCnt
+}
+
+func checkLocationMarks(t *testing.T, fromAge int, toAge int, gender string) {
+	expectedSum, expectedCnt := baselineFilterVisitsGetMarks("1", "", "", fromAge, toAge, gender)
+	filter := avgFilter{fromAge: fromAge, toAge: toAge, gender: gender}
+	for name, get := range map[string]func() (int, int){
+		"aggregates":           func() (int, int) { return getLocationMarks(InitDb(), "1", fromAge, toAge, gender) },
+		"filterVisitsGetMarks": func() (int, int) { return filterVisitsGetMarks(InitDb(), "1", filter) },
+	} {
+		sum, cnt := get()
+		if sum != expectedSum || cnt != expectedCnt {
+			t.Errorf("Expected marks sum %d and count %d of %s (fromAge=%d toAge=%d gender=%q). Got %d and %d",
+				expectedSum, expectedCnt, name, fromAge, toAge, gender, sum, cnt)
+		}
+	}
+}
+
+func checkAllLocationMarks(t *testing.T) {
+	for _, gender := range []string{"", "m", "f"} {
+		for _, ages := range [][2]int{{-1, -1}, {20, -1}, {-1, 40}, {-1, 0}, {20, 40}} {
+			checkLocationMarks(t, ages[0], ages[1], gender)
+		}
+	}
+}
+
+func TestLocationMarksAggregates(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/users/new", `{"id": 2, "email": "b@mail.com", "first_name": "B", "last_name": "B", "gender": "f", "birth_date": 946684800}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+	postJSON(t, "/visits/new", `{"id": 2, "location": 1, "user": 2, "visited_at": "1500000001", "mark": 2}`)
+	postJSON(t, "/visits/new", `{"id": 3, "location": 1, "user": 3, "visited_at": "1500000002", "mark": 4}`)
+	checkAllLocationMarks(t)
+
+	// visit of user 3 starts counting once the user is created
+	postJSON(t, "/users/new", `{"id": 3, "email": "c@mail.com", "first_name": "C", "last_name": "C", "gender": "f", "birth_date": 31536000}`)
+	checkAllLocationMarks(t)
+
+	postJSON(t, "/users/1", `{"gender": "f", "birth_date": 315532800}`)
+	checkAllLocationMarks(t)
+
+	postJSON(t, "/visits/2", `{"mark": 3}`)
+	checkAllLocationMarks(t)
+
+	req, _ := http.NewRequest("DELETE", "/visits/1", nil)
+	executeRequest(req)
+	checkAllLocationMarks(t)
+
+	req, _ = http.NewRequest("DELETE", "/users/3", nil)
+	executeRequest(req)
+	checkAllLocationMarks(t)
+
+	sum, cnt := getLocationMarks(InitDb(), "1", -1, -1, "")
+	if sum != 3 || cnt != 1 {
+		t.Errorf("Expected marks sum 3 and count 1. Got %d and %d", sum, cnt)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	OPERATION_CREATE = "create"
+	OPERATION_UPDATE = "update"
+	OPERATION_DELETE = "delete"
+	// requests denied by AuthorizationMiddleware, they aren't changes
+	OPERATION_ACCESS_DENIED = "access_denied"
+
+	REQUEST_ID_HEADER = "X-Request-ID"
+)
+
+// mutation is a change of one entity. Before is nil for created entities,
+// After is nil for deleted ones.
+type mutation struct {
+	Entity    string
+	ID        int
+	Operation string
+	Before    interface{}
+	After     interface{}
+}
+
+// AuditRecord is a mutation saved to audit log. Before and After are JSON
+// images of the entity.
+type AuditRecord struct {
+	ID        int
+	Actor     string
+	RequestID string
+	Entity    string
+	EntityID  int
+	Operation string
+	Timestamp int
+	Before    string
+	After     string
+}
+
+func (AuditRecord) TableName() string {
+	return "audit_log"
+}
+
+func getModelID(model interface{}) int {
+	switch m := model.(type) {
+	case User:
+		return m.ID
+	case Visit:
+		return m.ID
+	case Location:
+		return m.ID
+	}
+	return 0
+}
+
+func getActor(r *http.Request) string {
+	p := getPrincipal(r)
+	if p == nil {
+		return ""
+	}
+	return p.Type + ":" + p.Subject
+}
+
+func marshalImage(model interface{}) (string, error) {
+	if model == nil {
+		return "", nil
+	}
+	image, err := json.Marshal(model)
+	return string(image), err
+}
+
+func recordMutation(tx *gorm.DB, r *http.Request, m *mutation) (*AuditRecord, error) {
+	before, err := marshalImage(m.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := marshalImage(m.After)
+	if err != nil {
+		return nil, err
+	}
+	record := &AuditRecord{
+		Actor:     getActor(r),
+		RequestID: getRequestID(r),
+		Entity:    m.Entity,
+		EntityID:  m.ID,
+		Operation: m.Operation,
+		Timestamp: int(time.Now().Unix()),
+		Before:    before,
+		After:     after,
+	}
+	return record, tx.Create(record).Error
+}
+
+// recordAccessDenied saves denied request to audit log. Entity and id are
+// taken from route if it has them, after is the request instead of entity.
+func recordAccessDenied(r *http.Request, method string) {
+	db := InitDb()
+	defer db.Close()
+
+	vars := mux.Vars(r)
+	entityID, _ := strconv.Atoi(vars["id"])
+	request := map[string]string{"method": method, "uri": r.URL.RequestURI()}
+	if p := getPrincipal(r); p != nil {
+		request["role"] = p.Role
+	}
+	after, _ := json.Marshal(request)
+	err := db.Create(&AuditRecord{
+		Actor:     getActor(r),
+		RequestID: getRequestID(r),
+		Entity:    strings.ToLower(vars["entity"]),
+		EntityID:  entityID,
+		Operation: OPERATION_ACCESS_DENIED,
+		Timestamp: int(time.Now().Unix()),
+		After:     string(after),
+	}).Error
+	if err != nil {
+		log.WithFields(log.Fields{"module": "audit"}).Error(err)
+	}
+}
+
+// runMutation runs change in transaction and records mutation returned by
+// change to audit log and its event to outbox in the same transaction. change
+// returns nil mutation if nothing was changed. Event is published in process
+// after commit.
+func runMutation(r *http.Request, change func(tx *gorm.DB) (*mutation, error)) error {
+	db := InitMutationDb(r)
+	defer db.Close()
+
+	tx := db.Begin()
+	m, err := change(tx)
+	var record *AuditRecord
+	if err == nil && m != nil {
+		record, err = recordMutation(tx, r, m)
+	}
+	if err == nil && record != nil {
+		err = writeOutbox(tx, newEvent(*record))
+	}
+	if err != nil {
+		tx.Rollback()
+		log.WithFields(log.Fields{"module": "audit"}).Error(err)
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	if record != nil {
+		publishEvent(newEvent(*record))
+	}
+	return nil
+}
+
+// PruneAuditLog removes audit records older than AUDIT_RETENTION_DAYS
+func PruneAuditLog() error {
+	if AUDIT_RETENTION_DAYS <= 0 {
+		return nil
+	}
+	db := InitDb()
+	defer db.Close()
+
+	since := time.Now().AddDate(0, 0, -AUDIT_RETENTION_DAYS).Unix()
+	return db.Where("timestamp < ?", since).Delete(AuditRecord{}).Error
+}
+
+func runAuditLogPruning() {
+	for {
+		if err := PruneAuditLog(); err != nil {
+			log.WithFields(log.Fields{"module": "audit"}).Error(err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+func rawImage(image string) json.RawMessage {
+	if image == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(image)
+}
+
+func getAuditLog(w http.ResponseWriter, r *http.Request) {
+	db := InitRequestDb(r)
+	defer db.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	qsParams := r.URL.Query()
+	id, idOk := getIntParam(qsParams, "id", -1)
+	since, sinceOk := getIntParam(qsParams, "since", -1)
+	limit, limitOk := getIntParam(qsParams, "limit", MAX_LIMIT)
+	offset, offsetOk := getIntParam(qsParams, "offset", 0)
+	if !idOk || !sinceOk || !limitOk || !offsetOk || limit < 1 || limit > MAX_LIMIT || offset < 0 {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"Error": "Bad query string parameters"})
+		return
+	}
+
+	query := db.Order("id")
+	if entity := qsParams.Get("entity"); entity != "" {
+		query = query.Where("entity = ?", entity)
+	}
+	if id != -1 {
+		query = query.Where("entity_id = ?", id)
+	}
+	if operation := qsParams.Get("operation"); operation != "" {
+		query = query.Where("operation = ?", operation)
+	}
+	if since != -1 {
+		query = query.Where("timestamp >= ?", since)
+	}
+	var records []AuditRecord
+	query.Limit(limit).Offset(offset).Find(&records)
+
+	res := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		res = append(res, map[string]interface{}{
+			"id":         record.ID,
+			"actor":      record.Actor,
+			"request_id": record.RequestID,
+			"entity":     record.Entity,
+			"entity_id":  record.EntityID,
+			"operation":  record.Operation,
+			"timestamp":  record.Timestamp,
+			"before":     rawImage(record.Before),
+			"after":      rawImage(record.After),
+		})
+	}
+	json.NewEncoder(w).Encode(res)
+}
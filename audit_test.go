@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type auditResponseRecord struct {
+	Actor     string                 `json:"actor"`
+	RequestID string                 `json:"request_id"`
+	Entity    string                 `json:"entity"`
+	EntityID  int                    `json:"entity_id"`
+	Operation string                 `json:"operation"`
+	Before    map[string]interface{} `json:"before"`
+	After     map[string]interface{} `json:"after"`
+}
+
+func TestAuditLog(t *testing.T) {
+	ClearDB()
+	since := strconv.FormatInt(time.Now().Unix(), 10)
+
+	// request ids are taken from clients or generated by server
+	req, _ := http.NewRequest("POST", "/locations/new", bytes.NewBufferString(`{"id": 7, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`))
+	req.Header.Set(REQUEST_ID_HEADER, "request-1")
+	req.Header.Set(API_KEY_HEADER, testApiKey)
+	response := httptest.NewRecorder()
+	RequestLogger(r).ServeHTTP(response, req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	req, _ = http.NewRequest("POST", "/locations/7", bytes.NewBufferString(`{"distance": 20}`))
+	req.Header.Set(API_KEY_HEADER, testApiKey)
+	response = httptest.NewRecorder()
+	RequestLogger(r).ServeHTTP(response, req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	generatedID := response.Header().Get(REQUEST_ID_HEADER)
+	req, _ = http.NewRequest("DELETE", "/locations/7", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("GET", "/audit?entity=locations&id=7&since="+since, nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var records []auditResponseRecord
+	json.Unmarshal(response.Body.Bytes(), &records)
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 audit records. Got %d", len(records))
+	}
+
+	create, update, remove := records[0], records[1], records[2]
+	if create.Operation != OPERATION_CREATE || create.Before != nil || create.After["place"] != "Red Square" {
+		t.Errorf("Expected create record with after image. Got %+v", create)
+	}
+	if create.Actor != "api_key:tests" || create.RequestID != "request-1" {
+		t.Errorf("Expected actor 'api_key:tests' and request id 'request-1'. Got '%s' and '%s'", create.Actor, create.RequestID)
+	}
+	if update.Operation != OPERATION_UPDATE || update.Before["distance"] != 10.0 || update.After["distance"] != 20.0 {
+		t.Errorf("Expected update record with distance changed from 10 to 20. Got %+v", update)
+	}
+	if generatedID == "" || update.RequestID != generatedID {
+		t.Errorf("Expected generated request id %q. Got %q", generatedID, update.RequestID)
+	}
+	if remove.Operation != OPERATION_DELETE || remove.Before["distance"] != 20.0 || remove.After != nil {
+		t.Errorf("Expected delete record with before image. Got %+v", remove)
+	}
+
+	readerKey, _, _ := CreateApiKey("reader", ROLE_READER, 0)
+	req, _ = http.NewRequest("GET", "/audit", nil)
+	req.Header.Set(API_KEY_HEADER, readerKey)
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+}
+
+func TestPruneAuditLog(t *testing.T) {
+	db.Create(&AuditRecord{Entity: "users", EntityID: 100, Operation: OPERATION_DELETE, Timestamp: 1})
+	if err := PruneAuditLog(); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	db.Model(&AuditRecord{}).Where("timestamp = 1").Count(&count)
+	if count != 0 {
+		t.Errorf("Expected old audit records to be pruned. Got %d", count)
+	}
+}
+
+func TestFailedMutationIsRolledBack(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+	db.Exec("CREATE TRIGGER fail_location_update BEFORE UPDATE ON locations WHEN NEW.distance = 999 BEGIN SELECT RAISE(ABORT, 'bad distance'); END")
+	defer db.Exec("DROP TRIGGER fail_location_update")
+	db.Exec("CREATE TRIGGER fail_marks_insert BEFORE INSERT ON location_marks BEGIN SELECT RAISE(ABORT, 'marks failed'); END")
+	defer db.Exec("DROP TRIGGER fail_marks_insert")
+	var before int
+	db.Model(&AuditRecord{}).Count(&before)
+
+	// failed update and failed update of aggregates
+	for url, payload := range map[string]string{"/locations/1": `{"distance": 999}`, "/visits/1": `{"mark": 2}`} {
+		req, _ := http.NewRequest("POST", url, bytes.NewBufferString(payload))
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusInternalServerError, response.Code)
+	}
+
+	var after int
+	db.Model(&AuditRecord{}).Count(&after)
+	if after != before {
+		t.Errorf("Expected no audit records of failed updates. Got %d", after-before)
+	}
+	var visit Visit
+	db.First(&visit, 1)
+	if visit.Mark != 5 || visit.Version != 1 {
+		t.Errorf("Expected visit to be unchanged. Got %+v", visit)
+	}
+	if sum, cnt := getLocationMarks(InitDb(), "1", -1, -1, ""); sum != 5 || cnt != 1 {
+		t.Errorf("Expected marks sum 5 and count 1. Got %d and %d", sum, cnt)
+	}
+}
+
+func TestMutationTransactionLocks(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+
+	// transactions of other queries don't take write lock when they begin
+	tx := db.Begin()
+	req, _ := http.NewRequest("POST", "/locations/1", bytes.NewBufferString(`{"distance": 20}`))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	tx.Rollback()
+
+	// concurrent mutations read and write without failing on lock upgrade
+	var wg sync.WaitGroup
+	codes := make(chan int, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", "/locations/1", bytes.NewBufferString(`{"distance": `+strconv.Itoa(i)+`}`))
+			codes <- executeRequest(req).Code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		checkResponseCode(t, http.StatusOK, code)
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	API_KEY_HEADER = "X-API-Key"
+	// allowed clock skew for "exp" and "nbf" JWT claims
+	JWT_LEEWAY = 60 * time.Second
+)
+
+// Principal is an authenticated caller. Handlers can get it with getPrincipal.
+type Principal struct {
+	// "api_key" or "jwt"
+	Type string
+	// API key name or "sub" claim of JWT
+	Subject string
+	// one of ROLE_* constants, "role" claim of JWT
+	Role string
+	// user whose records principal with ROLE_SELF can access, "sub" claim of JWT
+	UserID   int
+	ApiKeyID int
+	Claims   map[string]interface{}
+}
+
+type contextKey string
+
+const principalContextKey contextKey = "principal"
+
+func getPrincipal(r *http.Request) *Principal {
+	principal, _ := r.Context().Value(principalContextKey).(*Principal)
+	return principal
+}
+
+// ApiKey is a static API key. Only SHA-256 hash of the key is stored.
+type ApiKey struct {
+	ID        int
+	Name      string
+	KeyHash   string
+	Role      string
+	UserID    int
+	CreatedAt int
+}
+
+func (ApiKey) TableName() string {
+	return "api_keys"
+}
+
+func hashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateApiKey creates new API key and returns it. The key can't be got later.
+// userID is needed only for ROLE_SELF keys.
+func CreateApiKey(name string, role string, userID int) (string, ApiKey, error) {
+	db := InitDb()
+	defer db.Close()
+
+	keyBytes := make([]byte, 32)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return "", ApiKey{}, err
+	}
+	key := hex.EncodeToString(keyBytes)
+
+	apiKey := ApiKey{Name: name, KeyHash: hashApiKey(key), Role: role, UserID: userID, CreatedAt: int(time.Now().Unix())}
+	err := db.Create(&apiKey).Error
+	return key, apiKey, err
+}
+
+func findApiKey(r *http.Request, key string) (ApiKey, bool) {
+	db := InitRequestDb(r)
+	defer db.Close()
+
+	var apiKey ApiKey
+	db.Where("key_hash = ?", hashApiKey(key)).First(&apiKey)
+	return apiKey, apiKey.ID != 0
+}
+
+type authError struct {
+	statusCode int
+	message    string
+}
+
+func (e *authError) Error() string {
+	return e.message
+}
+
+var (
+	errNoCredentials  = &authError{401, "Authentication required"}
+	errBadCredentials = &authError{401, "Invalid credentials"}
+	errBadTokenClaims = &authError{403, "Token isn't valid for this service"}
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+var (
+	jwksOnce sync.Once
+	jwksKeys map[string]*rsa.PublicKey
+)
+
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			return nil, fmt.Errorf("bad RSA key %q in JWKS", k.Kid)
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+func getJWKSKey(kid string) *rsa.PublicKey {
+	jwksOnce.Do(func() {
+		if JWT_JWKS_PATH == "" {
+			return
+		}
+		keys, err := loadJWKS(JWT_JWKS_PATH)
+		if err != nil {
+			log.WithFields(log.Fields{"module": "auth"}).Error(err)
+			return
+		}
+		jwksKeys = keys
+	})
+	key, ok := jwksKeys[kid]
+	if !ok && kid == "" && len(jwksKeys) == 1 {
+		// token without kid can be checked if there is only one key
+		for _, k := range jwksKeys {
+			key = k
+		}
+	}
+	return key
+}
+
+// getJWTKey returns key which checks signature of token
+func getJWTKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case "HS256":
+		if JWT_SECRET == "" {
+			return nil, errors.New("HS256 tokens aren't accepted")
+		}
+		return []byte(JWT_SECRET), nil
+	case "RS256":
+		kid, _ := token.Header["kid"].(string)
+		if key := getJWKSKey(kid); key != nil {
+			return key, nil
+		}
+		return nil, errors.New("unknown key")
+	}
+	return nil, errors.New("unsupported algorithm")
+}
+
+// verifyJWT checks JWT signature and claims and returns its claims. Tokens
+// without exp claim aren't accepted.
+func verifyJWT(token string) (map[string]interface{}, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(JWT_LEEWAY),
+	}
+	if JWT_ISSUER != "" {
+		options = append(options, jwt.WithIssuer(JWT_ISSUER))
+	}
+	if JWT_AUDIENCE != "" {
+		options = append(options, jwt.WithAudience(JWT_AUDIENCE))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, getJWTKey, options...)
+	if err == nil {
+		return claims, nil
+	}
+	log.WithFields(log.Fields{"module": "auth"}).Info("JWT rejected: ", err)
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired), errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		// expired tokens are bad credentials even if they're for other service
+		return nil, errBadCredentials
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer), errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return nil, errBadTokenClaims
+	}
+	return nil, errBadCredentials
+}
+
+// WebSocket subprotocols with credentials, browsers can't set headers of
+// WebSocket requests
+const (
+	WS_API_KEY_PROTOCOL_PREFIX = "api-key."
+	WS_BEARER_PROTOCOL_PREFIX  = "bearer."
+)
+
+// getWebSocketCredentials returns API key and Authorization header value sent
+// in Sec-WebSocket-Protocol header, e.g. "live-avg, api-key.<key>"
+func getWebSocketCredentials(r *http.Request) (string, string) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		return "", ""
+	}
+	for _, protocol := range websocket.Subprotocols(r) {
+		switch {
+		case strings.HasPrefix(protocol, WS_API_KEY_PROTOCOL_PREFIX):
+			return strings.TrimPrefix(protocol, WS_API_KEY_PROTOCOL_PREFIX), ""
+		case strings.HasPrefix(protocol, WS_BEARER_PROTOCOL_PREFIX):
+			return "", "Bearer " + strings.TrimPrefix(protocol, WS_BEARER_PROTOCOL_PREFIX)
+		}
+	}
+	return "", ""
+}
+
+func authenticate(r *http.Request) (*Principal, error) {
+	key, authorization := r.Header.Get(API_KEY_HEADER), r.Header.Get("Authorization")
+	if key == "" && authorization == "" {
+		key, authorization = getWebSocketCredentials(r)
+	}
+	if key != "" {
+		apiKey, ok := findApiKey(r, key)
+		if !ok {
+			return nil, errBadCredentials
+		}
+		return &Principal{Type: "api_key", Subject: apiKey.Name, Role: apiKey.Role, UserID: apiKey.UserID, ApiKeyID: apiKey.ID}, nil
+	}
+
+	if authorization == "" {
+		return nil, errNoCredentials
+	}
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return nil, errBadCredentials
+	}
+	claims, err := verifyJWT(strings.TrimPrefix(authorization, "Bearer "))
+	if err != nil {
+		return nil, err
+	}
+	subject, _ := claims["sub"].(string)
+	role, _ := claims["role"].(string)
+	userID, _ := strconv.Atoi(subject)
+	return &Principal{Type: "jwt", Subject: subject, Role: role, UserID: userID, Claims: claims}, nil
+}
+
+// AuthMiddleware requires API key (X-API-Key header) or JWT (Authorization:
+// Bearer header) and puts authenticated principal to request context.
+// publicRoutes don't require authentication.
+func AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// principal of in-process requests, e.g. of CLI commands, is set by caller
+		if isPublicRoute(r) || getPrincipal(r) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		principal, err := authenticate(r)
+		if err != nil {
+			authErr := err.(*authError)
+			w.Header().Set("Content-Type", "application/json")
+			if authErr.statusCode == 401 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			w.WriteHeader(authErr.statusCode)
+			json.NewEncoder(w).Encode(map[string]string{"Error": authErr.message})
+			return
+		}
+		setLogPrincipal(r, principal)
+		ctx := context.WithValue(r.Context(), principalContextKey, principal)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// runApiKeyCommand manages API keys: "apikey create <name> <role> [user id]",
+// "apikey list" and "apikey revoke <id>"
+// parseApiKeyRole parses "admin|writer|reader|self [user id]" arguments,
+// user id is required only for ROLE_SELF
+func parseApiKeyRole(args []string) (string, int, bool) {
+	if len(args) < 1 || len(args) > 2 || !isValidRole(args[0]) {
+		return "", 0, false
+	}
+	if args[0] != ROLE_SELF {
+		return args[0], 0, len(args) == 1
+	}
+	if len(args) != 2 {
+		return "", 0, false
+	}
+	userID, err := strconv.Atoi(args[1])
+	return args[0], userID, err == nil
+}
+
+func runApiKeyCommand(args []string) error {
+	usage := errors.New("usage: apikey create <name> admin|writer|reader|self [user id] | apikey list | apikey revoke <id> | apikey role <id> admin|writer|reader|self [user id]")
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "create":
+		if len(args) < 2 {
+			return usage
+		}
+		role, userID, ok := parseApiKeyRole(args[2:])
+		if !ok {
+			return usage
+		}
+		key, apiKey, err := CreateApiKey(args[1], role, userID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created API key %d (%s). Save it, it won't be shown again:\n%s\n", apiKey.ID, apiKey.Name, key)
+	case "list":
+		db := InitDb()
+		defer db.Close()
+
+		var apiKeys []ApiKey
+		db.Order("id").Find(&apiKeys)
+		for _, k := range apiKeys {
+			fmt.Printf("%d\t%s\t%s\t%d\t%s\n", k.ID, k.Name, k.Role, k.UserID, time.Unix(int64(k.CreatedAt), 0).Format(time.RFC3339))
+		}
+	case "revoke":
+		if len(args) != 2 {
+			return usage
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return usage
+		}
+		db := InitDb()
+		defer db.Close()
+
+		res := db.Where("id = ?", id).Delete(ApiKey{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("API key %d not found", id)
+		}
+		fmt.Printf("Revoked API key %d\n", id)
+	case "role":
+		if len(args) < 2 {
+			return usage
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return usage
+		}
+		role, userID, ok := parseApiKeyRole(args[2:])
+		if !ok {
+			return usage
+		}
+		db := InitDb()
+		defer db.Close()
+
+		res := db.Model(&ApiKey{}).Where("id = ?", id).Updates(map[string]interface{}{"role": role, "user_id": userID})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("API key %d not found", id)
+		}
+		fmt.Printf("Set role %s of API key %d\n", role, id)
+	default:
+		return usage
+	}
+	return nil
+}
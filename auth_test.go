@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func makeJWT(header map[string]interface{}, claims map[string]interface{}, sign func(string) []byte) string {
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign(signingInput))
+}
+
+func signHS256(secret string) func(string) []byte {
+	return func(signingInput string) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(signingInput))
+		return mac.Sum(nil)
+	}
+}
+
+func executeUnauthenticatedRequest(req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func checkAuthResponse(t *testing.T, header string, value string, expected int) {
+	req, _ := http.NewRequest("GET", "/users", nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	response := executeUnauthenticatedRequest(req)
+	checkResponseCode(t, expected, response.Code)
+	if expected != http.StatusOK {
+		var m map[string]string
+		json.Unmarshal(response.Body.Bytes(), &m)
+		if m["Error"] == "" {
+			t.Errorf("Expected the 'Error' key of the response to be set. Got '%s'", response.Body.String())
+		}
+	}
+}
+
+func TestAuthApiKey(t *testing.T) {
+	checkAuthResponse(t, "", "", http.StatusUnauthorized)
+	checkAuthResponse(t, API_KEY_HEADER, "bad key", http.StatusUnauthorized)
+	checkAuthResponse(t, API_KEY_HEADER, testApiKey, http.StatusOK)
+}
+
+func TestApiKeyRoleCommand(t *testing.T) {
+	key, apiKey, _ := CreateApiKey("old", ROLE_READER, 0)
+	if err := runApiKeyCommand([]string{"role", strconv.Itoa(apiKey.ID), ROLE_SELF}); err == nil {
+		t.Errorf("Expected self role without user id to be rejected")
+	}
+	if err := runApiKeyCommand([]string{"role", strconv.Itoa(apiKey.ID), ROLE_WRITER}); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := findApiKey(httptest.NewRequest("GET", "/", nil), key); found.Role != ROLE_WRITER {
+		t.Errorf("Expected key to get %s role. Got %s", ROLE_WRITER, found.Role)
+	}
+	if err := runApiKeyCommand([]string{"role", "0", ROLE_WRITER}); err == nil {
+		t.Errorf("Expected role of missing key not to be set")
+	}
+}
+
+func TestAuthHS256(t *testing.T) {
+	JWT_SECRET, JWT_ISSUER, JWT_AUDIENCE = "secret", "issuer", "rest_app"
+	defer func() { JWT_SECRET, JWT_ISSUER, JWT_AUDIENCE = "", "", "" }()
+
+	header := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	exp := time.Now().Add(time.Hour).Unix()
+	claims := map[string]interface{}{"sub": "user1", "role": ROLE_READER, "iss": "issuer", "aud": []string{"rest_app"}, "exp": exp}
+
+	checkAuthResponse(t, "Authorization", "Bearer "+makeJWT(header, claims, signHS256("secret")), http.StatusOK)
+	checkAuthResponse(t, "Authorization", "Bearer "+makeJWT(header, claims, signHS256("other secret")), http.StatusUnauthorized)
+	checkAuthResponse(t, "Authorization", "Bearer abc", http.StatusUnauthorized)
+
+	none := map[string]interface{}{"alg": "none"}
+	checkAuthResponse(t, "Authorization", "Bearer "+makeJWT(none, claims, func(string) []byte { return nil }), http.StatusUnauthorized)
+
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	checkAuthResponse(t, "Authorization", "Bearer "+makeJWT(header, claims, signHS256("secret")), http.StatusUnauthorized)
+
+	delete(claims, "exp")
+	checkAuthResponse(t, "Authorization", "Bearer "+makeJWT(header, claims, signHS256("secret")), http.StatusUnauthorized)
+
+	claims["exp"] = exp
+	claims["aud"] = "other_app"
+	checkAuthResponse(t, "Authorization", "Bearer "+makeJWT(header, claims, signHS256("secret")), http.StatusForbidden)
+}
+
+func TestAuthRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := ioutil.TempDir("", "jwks")
+	defer os.RemoveAll(dir)
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "key1",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	JWT_JWKS_PATH = filepath.Join(dir, "jwks.json")
+	ioutil.WriteFile(JWT_JWKS_PATH, jwks, 0600)
+	jwksOnce = sync.Once{}
+	defer func() {
+		JWT_JWKS_PATH = ""
+		jwksOnce = sync.Once{}
+		jwksKeys = nil
+	}()
+
+	signRS256 := func(signingInput string) []byte {
+		hash := sha256.Sum256([]byte(signingInput))
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+		return signature
+	}
+	claims := map[string]interface{}{"sub": "user1", "role": ROLE_READER, "exp": time.Now().Add(time.Hour).Unix()}
+
+	checkAuthResponse(t, "Authorization", "Bearer "+makeJWT(map[string]interface{}{"alg": "RS256", "kid": "key1"}, claims, signRS256), http.StatusOK)
+	checkAuthResponse(t, "Authorization", "Bearer "+makeJWT(map[string]interface{}{"alg": "RS256", "kid": "key2"}, claims, signRS256), http.StatusUnauthorized)
+	// HS256 token signed with public key mustn't be accepted
+	checkAuthResponse(t, "Authorization", "Bearer "+makeJWT(map[string]interface{}{"alg": "HS256", "kid": "key1"}, claims, signHS256(string(key.N.Bytes()))), http.StatusUnauthorized)
+}
+
+func TestAuthPrincipalInContext(t *testing.T) {
+	var principal *Principal
+	handler := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = getPrincipal(r)
+	}))
+	req, _ := http.NewRequest("GET", "/users", nil)
+	req.Header.Set(API_KEY_HEADER, testApiKey)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if principal == nil || principal.Type != "api_key" || principal.Subject != "tests" {
+		t.Errorf("Expected API key principal 'tests'. Got %+v", principal)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ROLE_ADMIN  = "admin"
+	ROLE_WRITER = "writer"
+	ROLE_READER = "reader"
+	// user who may only read and update own User record and Visits
+	ROLE_SELF = "self"
+)
+
+func isValidRole(role string) bool {
+	return role == ROLE_ADMIN || role == ROLE_WRITER || role == ROLE_READER || role == ROLE_SELF
+}
+
+// accessRule allows request to principals with one of roles. Principals with
+// ROLE_SELF are allowed if self isn't nil and returns true.
+type accessRule struct {
+	roles []string
+	self  func(p *Principal, r *http.Request) bool
+}
+
+var (
+	readRoles  = []string{ROLE_ADMIN, ROLE_WRITER, ROLE_READER}
+	writeRoles = []string{ROLE_ADMIN, ROLE_WRITER}
+	adminRoles = []string{ROLE_ADMIN}
+)
+
+// accessPolicies are access rules by route path template and method. Requests
+// to routes and methods which aren't listed are allowed only to admins.
+var accessPolicies = map[string]map[string]accessRule{
+	"/{entity}": {
+		http.MethodGet: {roles: readRoles},
+	},
+	"/{entity}/new": {
+		http.MethodPost: {roles: writeRoles},
+	},
+	"/locations/top": {
+		http.MethodGet: {roles: readRoles},
+	},
+	"/{entity}/{id}": {
+		http.MethodGet:    {roles: readRoles, self: isSelfEntity},
+		http.MethodPost:   {roles: writeRoles, self: isSelfEntity},
+		http.MethodDelete: {roles: writeRoles},
+	},
+	"/{entity}/{id}/restore": {
+		http.MethodPost: {roles: writeRoles},
+	},
+	"/users/{id}/visits": {
+		http.MethodGet: {roles: readRoles, self: isSelfUser},
+	},
+	"/users/{id}/stats": {
+		http.MethodGet: {roles: readRoles, self: isSelfUser},
+	},
+	"/users/{id}/recommendations": {
+		http.MethodGet: {roles: readRoles, self: isSelfUser},
+	},
+	"/locations/{id}/avg": {
+		http.MethodGet: {roles: readRoles},
+	},
+	"/locations/avg/live": {
+		http.MethodGet: {roles: readRoles},
+	},
+	"/locations/{id}/stats": {
+		http.MethodGet: {roles: readRoles},
+	},
+	"/events": {
+		http.MethodGet: {roles: readRoles},
+	},
+	// mutations are checked with rules of REST routes, see gqlAuthorize
+	"/graphql": {
+		http.MethodGet:  {roles: readRoles},
+		http.MethodPost: {roles: readRoles},
+	},
+}
+
+func isSelfUser(p *Principal, r *http.Request) bool {
+	return p.UserID != 0 && mux.Vars(r)["id"] == strconv.Itoa(p.UserID)
+}
+
+// isSelfEntity allows access to own User record and own Visits. Visit can't
+// be moved to another user.
+func isSelfEntity(p *Principal, r *http.Request) bool {
+	params := mux.Vars(r)
+	switch params["entity"] {
+	case "users":
+		return isSelfUser(p, r)
+	case "visits":
+		var visit Visit
+		db := InitRequestDb(r)
+		db.Where("id = ?", params["id"]).First(&visit)
+		db.Close()
+		if p.UserID == 0 || visit.User != p.UserID {
+			return false
+		}
+		if r.Method != http.MethodPost {
+			return true
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			// handler can't update visit without body, it responds with error
+			// of body, e.g. 413 for too large body
+			r.Body = failedBody{err}
+			return true
+		}
+		// request body is read again by handler
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		var updates map[string]interface{}
+		json.Unmarshal(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), &updates)
+		user, ok := updates["user"]
+		return !ok || user == float64(p.UserID)
+	}
+	return false
+}
+
+// query string parameters which only admins may use
+var adminParams = []string{"includeDeleted"}
+
+func isAllowed(p *Principal, r *http.Request) bool {
+	if p.Role != ROLE_ADMIN {
+		qsParams := r.URL.Query()
+		for _, param := range adminParams {
+			if _, ok := qsParams[param]; ok {
+				return false
+			}
+		}
+	}
+
+	var template string
+	if route := mux.CurrentRoute(r); route != nil {
+		template, _ = route.GetPathTemplate()
+	}
+	return isAllowedRoute(p, r, template)
+}
+
+// isAllowedRoute checks request against access rule of route path template.
+// GraphQL mutations are checked with rules of REST routes they correspond to.
+func isAllowedRoute(p *Principal, r *http.Request, template string) bool {
+	rule := accessRule{roles: adminRoles}
+	if methodRules, ok := accessPolicies[template]; ok {
+		if methodRule, ok := methodRules[r.Method]; ok {
+			rule = methodRule
+		}
+	}
+
+	for _, role := range rule.roles {
+		if p.Role == role {
+			return true
+		}
+	}
+	return p.Role == ROLE_SELF && rule.self != nil && rule.self(p, r)
+}
+
+// AuthorizationMiddleware checks principal set by AuthMiddleware against
+// accessPolicies. Denials are written to audit log.
+func AuthorizationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicRoute(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p := getPrincipal(r)
+		if p == nil || !isAllowed(p, r) {
+			logAccessDenied(r, p)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(map[string]string{"Error": "Access denied"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logAccessDenied writes denied request to log and audit log
+func logAccessDenied(r *http.Request, p *Principal) {
+	fields := log.Fields{"module": "audit", "event": "access_denied", "method": r.Method, "uri": r.RequestURI}
+	if p != nil {
+		fields["principal_type"] = p.Type
+		fields["principal"] = p.Subject
+		fields["role"] = p.Role
+	}
+	log.WithFields(fields).Warn("Access denied")
+	recordAccessDenied(r, r.Method)
+}
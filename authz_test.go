@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func checkAccess(t *testing.T, key string, method string, url string, payload string, expected int) {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(payload))
+	req.Header.Set(API_KEY_HEADER, key)
+	response := executeRequest(req)
+	checkResponseCode(t, expected, response.Code)
+}
+
+func TestAuthorizationRoles(t *testing.T) {
+	ClearDB()
+	db.Delete(AuditRecord{})
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+
+	readerKey, _, _ := CreateApiKey("reader", ROLE_READER, 0)
+	writerKey, _, _ := CreateApiKey("writer", ROLE_WRITER, 0)
+	noRoleKey, _, _ := CreateApiKey("no role", "", 0)
+
+	checkAccess(t, readerKey, "GET", "/users/1", "", http.StatusOK)
+	checkAccess(t, readerKey, "GET", "/users", "", http.StatusOK)
+	checkAccess(t, readerKey, "POST", "/users/1", `{"first_name": "B"}`, http.StatusForbidden)
+	checkAccess(t, readerKey, "DELETE", "/users/1", "", http.StatusForbidden)
+	checkAccess(t, writerKey, "POST", "/users/1", `{"first_name": "B"}`, http.StatusOK)
+	checkAccess(t, noRoleKey, "GET", "/users/1", "", http.StatusForbidden)
+	checkAccess(t, writerKey, "DELETE", "/users/1", "", http.StatusOK)
+
+	// denials are written to audit log
+	records := getAuditRecords(t, "/audit?operation=access_denied&entity=users&id=1")
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 denials. Got %v", records)
+	}
+	request := records[0]["after"].(map[string]interface{})
+	if records[0]["actor"] == "" || request["method"] != "POST" || request["uri"] != "/users/1" || request["role"] != ROLE_READER {
+		t.Errorf("Expected denied update by reader. Got %v", records[0])
+	}
+}
+
+func getAuditRecords(t *testing.T, url string) []map[string]interface{} {
+	req, _ := http.NewRequest("GET", url, nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var records []map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &records)
+	return records
+}
+
+func TestAuthorizationSelf(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/users/new", `{"id": 2, "email": "b@mail.com", "first_name": "B", "last_name": "B", "gender": "f", "birth_date": 946684800}`)
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+	postJSON(t, "/visits/new", `{"id": 2, "location": 1, "user": 2, "visited_at": "1500000000", "mark": 3}`)
+
+	selfKey, _, _ := CreateApiKey("user 1", ROLE_SELF, 1)
+
+	checkAccess(t, selfKey, "GET", "/users/1", "", http.StatusOK)
+	checkAccess(t, selfKey, "POST", "/users/1", `{"first_name": "C"}`, http.StatusOK)
+	checkAccess(t, selfKey, "GET", "/users/1/stats", "", http.StatusOK)
+	checkAccess(t, selfKey, "GET", "/users/2", "", http.StatusForbidden)
+	checkAccess(t, selfKey, "GET", "/users", "", http.StatusForbidden)
+	checkAccess(t, selfKey, "DELETE", "/users/1", "", http.StatusForbidden)
+
+	checkAccess(t, selfKey, "GET", "/visits/1", "", http.StatusOK)
+	checkAccess(t, selfKey, "POST", "/visits/1", `{"mark": 4}`, http.StatusOK)
+	checkAccess(t, selfKey, "POST", "/visits/1", `{"user": 2}`, http.StatusForbidden)
+	checkAccess(t, selfKey, "GET", "/visits/2", "", http.StatusForbidden)
+
+	// body without known length is checked while it's read for ownership
+	maxBodySize := MAX_BODY_SIZE
+	MAX_BODY_SIZE = 100
+	req, _ := http.NewRequest("POST", "/visits/1", strings.NewReader(`{"visited_at": "`+strings.Repeat("1", 100)+`"}`))
+	req.ContentLength = -1
+	req.Header.Set(API_KEY_HEADER, selfKey)
+	checkResponseCode(t, http.StatusRequestEntityTooLarge, executeRequest(req).Code)
+	MAX_BODY_SIZE = maxBodySize
+	checkAccess(t, selfKey, "GET", "/locations/1", "", http.StatusForbidden)
+	checkAccess(t, selfKey, "POST", "/visits/new", `{"location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`, http.StatusForbidden)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+var (
+	errBodyTooLarge           = errors.New("request body is too large")
+	errUnsupportedContentType = errors.New("unsupported content type")
+)
+
+// model fields which are set only by the app
+var readOnlyFields = []string{"version", "deleted_at"}
+
+// limitedBody returns errBodyTooLarge if more than remaining bytes are read
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// body is allowed to end exactly at the limit
+		var probe [1]byte
+		n, err := b.body.Read(probe[:])
+		if n > 0 {
+			return 0, errBodyTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// BodyLimitMiddleware limits request body size by MAX_BODY_SIZE
+func BodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > int64(MAX_BODY_SIZE) {
+			res, statusCode := getBodyErrorResponse(errBodyTooLarge)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+		r.Body = &limitedBody{body: r.Body, remaining: int64(MAX_BODY_SIZE)}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// failedBody returns error of the first read of request body
+type failedBody struct {
+	err error
+}
+
+func (b failedBody) Read(p []byte) (int, error) {
+	return 0, b.err
+}
+
+func (b failedBody) Close() error {
+	return nil
+}
+
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		// clients which don't set content type are expected to send JSON
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// readRequestBody checks request content type and reads its body with BOM trimmed
+func readRequestBody(r *http.Request) ([]byte, error) {
+	if !isJSONContentType(r.Header.Get("Content-Type")) {
+		return nil, errUnsupportedContentType
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), nil
+}
+
+func getBodyErrorResponse(err error) (interface{}, int) {
+	switch err {
+	case errBodyTooLarge:
+		return map[string]string{"Error": "Request body is too large"}, 413
+	case errUnsupportedContentType:
+		return map[string]string{"Error": "Unsupported content type, expected application/json"}, 415
+	default:
+		return map[string]string{"Error": "Bad request body parameters"}, 400
+	}
+}
+
+// checkDuplicateKeys returns error if any JSON object in data has duplicate
+// keys. Keys are compared case-insensitively, like encoding/json matches them
+// to fields.
+func checkDuplicateKeys(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var checkValue func() error
+	checkValue = func() error {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'):
+			keys := make(map[string]bool)
+			for dec.More() {
+				keyToken, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key := strings.ToLower(keyToken.(string))
+				if keys[key] {
+					return fmt.Errorf("duplicate key %q", key)
+				}
+				keys[key] = true
+				if err := checkValue(); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		case json.Delim('['):
+			for dec.More() {
+				if err := checkValue(); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		}
+		return nil
+	}
+	return checkValue()
+}
+
+// decodeStrict unmarshals JSON rejecting unknown fields, duplicate keys and
+// data after JSON value
+func decodeStrict(data []byte, v interface{}) error {
+	if err := checkDuplicateKeys(data); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// checkReadOnlyFields returns error if JSON object in data sets any of readOnlyFields
+func checkReadOnlyFields(data []byte) error {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return nil
+	}
+	for name := range fields {
+		for _, field := range readOnlyFields {
+			if strings.EqualFold(name, field) {
+				return fmt.Errorf("field %q is read only", field)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func checkBodyResponse(t *testing.T, url string, contentType string, payload string, expected int) {
+	req, _ := http.NewRequest("POST", url, bytes.NewBufferString(payload))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	response := executeRequest(req)
+	checkResponseCode(t, expected, response.Code)
+}
+
+func TestStrictBodyDecoding(t *testing.T) {
+	ClearDB()
+	user := `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`
+
+	checkBodyResponse(t, "/users/new", "application/json", "\xef\xbb\xbf"+user, http.StatusOK)
+	checkBodyResponse(t, "/users/new", "", `{"id": 2, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 1, "age": 3}`, http.StatusBadRequest)
+	checkBodyResponse(t, "/users/new", "", `{"id": 2, "email": "a@mail.com", "email": "b@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 1}`, http.StatusBadRequest)
+	checkBodyResponse(t, "/users/new", "", `{"id": 2, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 1} {}`, http.StatusBadRequest)
+	checkBodyResponse(t, "/users/new", "text/plain", user, http.StatusUnsupportedMediaType)
+
+	checkBodyResponse(t, "/users/1", "application/json; charset=utf-8", `{"first_name": "B"}`, http.StatusOK)
+	checkBodyResponse(t, "/users/1", "", `{"first_name": "B", "age": 3}`, http.StatusBadRequest)
+	checkBodyResponse(t, "/users/1", "", `{"first_name": "B", "first_name": "C"}`, http.StatusBadRequest)
+	// encoding/json matches keys case-insensitively, so the last one would win
+	checkBodyResponse(t, "/users/1", "", `{"first_name": "B", "First_Name": "C"}`, http.StatusBadRequest)
+	checkBodyResponse(t, "/users/1", "", `{"Version": 5}`, http.StatusBadRequest)
+	checkBodyResponse(t, "/users/1", "", `{"first_name": "B"}garbage`, http.StatusBadRequest)
+	checkBodyResponse(t, "/users/1", "", `{"birth_date": "yesterday"}`, http.StatusBadRequest)
+	checkBodyResponse(t, "/users/1", "", `[]`, http.StatusBadRequest)
+	checkBodyResponse(t, "/users/1", "application/xml", `{"first_name": "B"}`, http.StatusUnsupportedMediaType)
+}
+
+func TestBodySizeLimit(t *testing.T) {
+	maxBodySize := MAX_BODY_SIZE
+	MAX_BODY_SIZE = 100
+	defer func() { MAX_BODY_SIZE = maxBodySize }()
+
+	payload := `{"first_name": "` + strings.Repeat("a", 100) + `"}`
+	checkBodyResponse(t, "/users/1", "", payload, http.StatusRequestEntityTooLarge)
+
+	// body without known length is checked while reading
+	req, _ := http.NewRequest("POST", "/users/new", strings.NewReader(payload))
+	req.ContentLength = -1
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusRequestEntityTooLarge, response.Code)
+}
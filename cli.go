@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"rest_app/client"
+	"rest_app/models"
+)
+
+// output of CLI commands
+var cliOutput io.Writer = os.Stdout
+
+// cliOptions are flags of CLI commands which work with entities. Without url
+// commands work with local database.
+type cliOptions struct {
+	url    string
+	apiKey string
+	token  string
+	output string
+}
+
+func newCliFlagSet(name string, opts *cliOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&opts.url, "url", getEnv("API_URL", ""), "URL of running server, local database is used if empty")
+	fs.StringVar(&opts.apiKey, "api-key", getEnv("API_KEY", ""), "API key for server")
+	fs.StringVar(&opts.token, "token", getEnv("API_TOKEN", ""), "JWT for server")
+	fs.StringVar(&opts.output, "output", "table", "output format, table or json")
+	return fs
+}
+
+// parseCliArgs parses flags which may be placed before, after or between
+// positional arguments and returns positional arguments
+func parseCliArgs(fs *flag.FlagSet, opts *cliOptions, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if opts.output != "table" && opts.output != "json" {
+		return nil, fmt.Errorf("unknown output format %q", opts.output)
+	}
+	return positional, nil
+}
+
+// handlerTransport serves requests of client in process by handler. They
+// have no IP address, so they aren't limited by it, and get request ids like
+// requests of server.
+type handlerTransport struct {
+	handler   http.Handler
+	principal *Principal
+}
+
+func (t *handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.RequestURI = req.URL.RequestURI()
+	ctx := context.WithValue(req.Context(), principalContextKey, t.principal)
+	ctx = context.WithValue(ctx, ipRateLimitedContextKey, true)
+	ctx = context.WithValue(ctx, requestIDContextKey, newRequestID())
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req.WithContext(ctx))
+	return rec.Result(), nil
+}
+
+// getCliPrincipal returns admin principal named by OS user, it's written to audit log
+func getCliPrincipal() *Principal {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return &Principal{Type: "cli", Subject: name, Role: ROLE_ADMIN}
+}
+
+// client returns API client of server or of local database. Local requests are
+// served by the same handlers as server's, so they are validated and audited.
+func (opts *cliOptions) client() *client.Client {
+	if opts.url == "" {
+		// local commands aren't limited
+		RATE_LIMIT_READS, RATE_LIMIT_WRITES, RATE_LIMIT_EXPENSIVE = 0, 0, 0
+		transport := &handlerTransport{handler: SetupHandlers(), principal: getCliPrincipal()}
+		return client.New("http://localhost", client.WithHTTPClient(&http.Client{Transport: transport}), client.WithRetries(0, 0))
+	}
+	var auth client.Auth
+	if opts.token != "" {
+		auth = client.BearerToken(opts.token)
+	} else if opts.apiKey != "" {
+		auth = client.APIKey(opts.apiKey)
+	}
+	return client.New(opts.url, client.WithAuth(auth))
+}
+
+func formatCliValue(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// writeTable writes struct or slice of structs as table with columns named by JSON fields
+func writeTable(w io.Writer, v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rows := []reflect.Value{rv}
+	if rv.Kind() == reflect.Slice {
+		rows = rows[:0]
+		for i := 0; i < rv.Len(); i++ {
+			rows = append(rows, reflect.Indirect(rv.Index(i)))
+		}
+	}
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Struct {
+		_, err := fmt.Fprintln(w, v)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	t := rv.Type()
+	if rv.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	var header []string
+	for i := 0; i < t.NumField(); i++ {
+		header = append(header, strings.ToUpper(strings.Split(t.Field(i).Tag.Get("json"), ",")[0]))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		var values []string
+		for i := 0; i < row.NumField(); i++ {
+			values = append(values, formatCliValue(row.Field(i)))
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeCliOutput(opts *cliOptions, v interface{}) error {
+	if opts.output == "json" {
+		enc := json.NewEncoder(cliOutput)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	return writeTable(cliOutput, v)
+}
+
+// parseFieldArgs parses "name=value" arguments, numeric values are parsed as numbers
+func parseFieldArgs(args []string) (client.Fields, error) {
+	fields := client.Fields{}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("bad field %q, expected name=value", arg)
+		}
+		if n, err := strconv.Atoi(parts[1]); err == nil {
+			fields[parts[0]] = n
+		} else {
+			fields[parts[0]] = parts[1]
+		}
+	}
+	return fields, nil
+}
+
+// runUserCommand manages users: "user get <id>", "user create <field>=<value>...",
+// "user update <id> <field>=<value>..." and "user delete <id>"
+func runUserCommand(args []string) error {
+	usage := errors.New("usage: user get <id> | user create <field>=<value>... | user update <id> <field>=<value>... | user delete <id> [--url url] [--api-key key] [--token jwt] [--output table|json]")
+	var opts cliOptions
+	fs := newCliFlagSet("user", &opts)
+	args, err := parseCliArgs(fs, &opts, args)
+	if err != nil || len(args) == 0 {
+		return usage
+	}
+	ctx := context.Background()
+	c := opts.client()
+
+	if args[0] == "create" {
+		fields, err := parseFieldArgs(args[1:])
+		if err != nil {
+			return err
+		}
+		// field names are checked by server, so typos aren't ignored
+		data, _ := json.Marshal(fields)
+		var user models.User
+		if err := decodeStrict(data, &user); err != nil {
+			return err
+		}
+		created, err := c.CreateUser(ctx, user)
+		if err != nil {
+			return err
+		}
+		return writeCliOutput(&opts, created)
+	}
+
+	if len(args) < 2 {
+		return usage
+	}
+	id, err := strconv.Atoi(args[1])
+	if err != nil {
+		return usage
+	}
+	switch args[0] {
+	case "get":
+		if len(args) != 2 {
+			return usage
+		}
+		user, err := c.GetUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		return writeCliOutput(&opts, user)
+	case "update":
+		fields, err := parseFieldArgs(args[2:])
+		if err != nil {
+			return err
+		}
+		if len(fields) == 0 {
+			return usage
+		}
+		if err := c.UpdateUser(ctx, id, fields, 0); err != nil {
+			return err
+		}
+		user, err := c.GetUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		return writeCliOutput(&opts, user)
+	case "delete":
+		if len(args) != 2 {
+			return usage
+		}
+		if err := c.DeleteUser(ctx, id); err != nil {
+			return err
+		}
+		fmt.Fprintf(cliOutput, "Deleted user %d\n", id)
+		return nil
+	}
+	return usage
+}
+
+// runVisitsCommand lists user visits: "visits --user <id> [--from ts] [--to ts]"
+func runVisitsCommand(args []string) error {
+	usage := errors.New("usage: visits --user <id> [--from ts] [--to ts] [--country country] [--to-distance distance] [--url url] [--api-key key] [--token jwt] [--output table|json]")
+	var opts cliOptions
+	var userID int
+	var filter client.VisitsFilter
+	fs := newCliFlagSet("visits", &opts)
+	fs.IntVar(&userID, "user", 0, "user id")
+	fs.IntVar(&filter.FromDate, "from", 0, "visits after timestamp")
+	fs.IntVar(&filter.ToDate, "to", 0, "visits before timestamp")
+	fs.StringVar(&filter.Country, "country", "", "country of locations")
+	fs.IntVar(&filter.ToDistance, "to-distance", 0, "locations closer than distance")
+	args, err := parseCliArgs(fs, &opts, args)
+	if err != nil || len(args) != 0 || userID == 0 {
+		return usage
+	}
+
+	visits, err := opts.client().UserVisits(context.Background(), userID, filter)
+	if err != nil {
+		return err
+	}
+	return writeCliOutput(&opts, visits)
+}
+
+// runAvgCommand prints average location mark: "avg --location <id>"
+func runAvgCommand(args []string) error {
+	usage := errors.New("usage: avg --location <id> [--from ts] [--to ts] [--from-age age] [--to-age age] [--gender m|f] [--url url] [--api-key key] [--token jwt] [--output table|json]")
+	var opts cliOptions
+	var locationID int
+	var filter client.AvgFilter
+	fs := newCliFlagSet("avg", &opts)
+	fs.IntVar(&locationID, "location", 0, "location id")
+	fs.IntVar(&filter.FromDate, "from", 0, "visits after timestamp")
+	fs.IntVar(&filter.ToDate, "to", 0, "visits before timestamp")
+	fs.IntVar(&filter.FromAge, "from-age", 0, "users older than age")
+	fs.IntVar(&filter.ToAge, "to-age", 0, "users younger than age")
+	fs.StringVar(&filter.Gender, "gender", "", "gender of users, m or f")
+	args, err := parseCliArgs(fs, &opts, args)
+	if err != nil || len(args) != 0 || locationID == 0 {
+		return usage
+	}
+
+	avg, err := opts.client().LocationAvg(context.Background(), locationID, filter)
+	if err != nil {
+		return err
+	}
+	if opts.output == "json" {
+		return writeCliOutput(&opts, map[string]float64{"avg": avg})
+	}
+	return writeCliOutput(&opts, avg)
+}
+
+// dataDump is a format of import and export files
+type dataDump struct {
+	Users     []models.User     `json:"users"`
+	Locations []models.Location `json:"locations"`
+	Visits    []models.Visit    `json:"visits"`
+}
+
+// runImportCommand creates entities of dump file: "import <file>", "-" is stdin.
+// Entities keep their ids, so visits can refer to imported users and locations.
+func runImportCommand(args []string) error {
+	usage := errors.New("usage: import <file> [--url url] [--api-key key] [--token jwt]")
+	var opts cliOptions
+	fs := newCliFlagSet("import", &opts)
+	args, err := parseCliArgs(fs, &opts, args)
+	if err != nil || len(args) != 1 {
+		return usage
+	}
+
+	var data []byte
+	if args[0] == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(args[0])
+	}
+	if err != nil {
+		return err
+	}
+	var dump dataDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	c := opts.client()
+	for _, user := range dump.Users {
+		if _, err := c.CreateUser(ctx, user); err != nil {
+			return fmt.Errorf("user %d: %v", user.ID, err)
+		}
+	}
+	for _, location := range dump.Locations {
+		if _, err := c.CreateLocation(ctx, location); err != nil {
+			return fmt.Errorf("location %d: %v", location.ID, err)
+		}
+	}
+	for _, visit := range dump.Visits {
+		if _, err := c.CreateVisit(ctx, visit); err != nil {
+			return fmt.Errorf("visit %d: %v", visit.ID, err)
+		}
+	}
+	fmt.Fprintf(cliOutput, "Imported %d users, %d locations and %d visits\n", len(dump.Users), len(dump.Locations), len(dump.Visits))
+	return nil
+}
+
+// runExportCommand writes all entities to dump file: "export [file]", stdout by default
+func runExportCommand(args []string) error {
+	usage := errors.New("usage: export [file] [--url url] [--api-key key] [--token jwt]")
+	var opts cliOptions
+	fs := newCliFlagSet("export", &opts)
+	args, err := parseCliArgs(fs, &opts, args)
+	if err != nil || len(args) > 1 {
+		return usage
+	}
+
+	ctx := context.Background()
+	c := opts.client()
+	var dump dataDump
+	if dump.Users, err = c.ListUsers(ctx); err != nil {
+		return err
+	}
+	if dump.Locations, err = c.ListLocations(ctx); err != nil {
+		return err
+	}
+	if dump.Visits, err = c.ListVisits(ctx); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if len(args) == 0 {
+		_, err = cliOutput.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(args[0], data, 0644)
+}
+
+// runMigrateCommand applies pending migrations of local database, with
+// --dry-run it only prints them: "migrate [--dry-run]"
+func runMigrateCommand(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "print pending migrations without applying them")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errors.New("usage: migrate [--dry-run]")
+	}
+	db := InitDb()
+	defer db.Close()
+
+	return runMigrations(db, *dryRun)
+}
+
+// runMigrations applies or prints pending migrations of db
+func runMigrations(db *gorm.DB, dryRun bool) error {
+	version, err := getSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		if err := migrateDb(db); err != nil {
+			return err
+		}
+	}
+	for i := version; i < len(migrations); i++ {
+		if dryRun {
+			fmt.Fprintf(cliOutput, "Pending migration %d: %s\n", i+1, getMigrationName(i))
+		} else {
+			fmt.Fprintf(cliOutput, "Applied migration %d: %s\n", i+1, getMigrationName(i))
+		}
+	}
+	if !dryRun {
+		version = len(migrations)
+	}
+	fmt.Fprintf(cliOutput, "Database schema is at version %d of %d\n", version, len(migrations))
+	return nil
+}
+
+// runResetCommand deletes all entities of local database: "reset --yes"
+func runResetCommand(args []string) error {
+	usage := errors.New("usage: reset --yes")
+	fs := flag.NewFlagSet("reset", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "confirm deletion of all entities")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || !*yes {
+		return usage
+	}
+	ClearDB()
+	fmt.Fprintln(cliOutput, "Deleted all users, locations and visits")
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"rest_app/models"
+)
+
+func runCliCommand(t *testing.T, command string, args ...string) string {
+	var out bytes.Buffer
+	cliOutput = &out
+	defer func() { cliOutput = os.Stdout }()
+	if err := commands[command](args); err != nil {
+		t.Fatalf("Expected command %s %v to succeed. Got %v", command, args, err)
+	}
+	return out.String()
+}
+
+func TestCliLocal(t *testing.T) {
+	ClearDB()
+
+	out := runCliCommand(t, "user", "create", "id=1", "email=test@test.com", "first_name=Test", "last_name=User", "gender=m", "birth_date=100")
+	if !strings.Contains(out, "test@test.com") || !strings.HasPrefix(out, "ID") {
+		t.Errorf("Expected table with created user. Got %q", out)
+	}
+	runCliCommand(t, "user", "update", "1", "last_name=Updated")
+	var user User
+	json.Unmarshal([]byte(runCliCommand(t, "user", "get", "1", "--output", "json")), &user)
+	if user.LastName != "Updated" || user.Version != 2 {
+		t.Errorf("Expected updated user. Got %+v", user)
+	}
+
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Place", "country": "Country", "city": "City", "distance": 10}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 3}`)
+	var visits []Visit
+	json.Unmarshal([]byte(runCliCommand(t, "visits", "--user", "1", "--to", "1600000000", "--output", "json")), &visits)
+	if len(visits) != 1 {
+		t.Errorf("Expected one visit. Got %+v", visits)
+	}
+	if out := runCliCommand(t, "avg", "--location", "1"); out != "3\n" {
+		t.Errorf("Expected average mark 3. Got %q", out)
+	}
+
+	var audit AuditRecord
+	db.Where("entity = ? AND entity_id = ?", "users", 1).Order("id desc").First(&audit)
+	if audit.Operation != "update" || !strings.HasPrefix(audit.Actor, "cli:") || audit.RequestID == "" {
+		t.Errorf("Expected CLI changes to be audited with request id. Got %+v", audit)
+	}
+
+	if err := runUserCommand([]string{"create", "emial=test@test.com"}); err == nil {
+		t.Errorf("Expected unknown field to fail")
+	}
+	if err := runResetCommand(nil); err == nil {
+		t.Errorf("Expected reset without confirmation to fail")
+	}
+	runCliCommand(t, "reset", "--yes")
+	if err := runUserCommand([]string{"get", "1"}); err == nil {
+		t.Errorf("Expected user to be deleted by reset")
+	}
+}
+
+func TestCliImportExport(t *testing.T) {
+	ClearDB()
+	dump := `{
+		"users": [{"id": 1, "email": "test@test.com", "first_name": "Test", "last_name": "User", "gender": "f", "birth_date": 100}],
+		"locations": [{"id": 2, "place": "Place", "country": "Country", "city": "City", "distance": 10}],
+		"visits": [{"id": 3, "location": 2, "user": 1, "visited_at": "1500000000", "mark": 5}]
+	}`
+	file, _ := ioutil.TempFile("", "dump*.json")
+	file.WriteString(dump)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	// import and export work against server as well as local database
+	server := httptest.NewServer(SetupHandlers())
+	defer server.Close()
+	out := runCliCommand(t, "import", file.Name(), "--url", server.URL, "--api-key", testApiKey)
+	if out != "Imported 1 users, 1 locations and 1 visits\n" {
+		t.Errorf("Unexpected import output %q", out)
+	}
+
+	var exported dataDump
+	json.Unmarshal([]byte(runCliCommand(t, "export")), &exported)
+	if len(exported.Users) != 1 || len(exported.Locations) != 1 || len(exported.Visits) != 1 || exported.Visits[0].Mark != 5 {
+		t.Errorf("Expected imported entities to be exported. Got %+v", exported)
+	}
+
+	if err := runUserCommand([]string{"get", "1", "--url", server.URL}); err == nil {
+		t.Errorf("Expected request without API key to fail")
+	}
+}
+
+func TestCliImportDefaultRateLimits(t *testing.T) {
+	ClearDB()
+	defer func(reads, writes, expensive, ip int) {
+		RATE_LIMIT_READS, RATE_LIMIT_WRITES, RATE_LIMIT_EXPENSIVE, RATE_LIMIT_IP = reads, writes, expensive, ip
+	}(RATE_LIMIT_READS, RATE_LIMIT_WRITES, RATE_LIMIT_EXPENSIVE, RATE_LIMIT_IP)
+	RATE_LIMIT_READS, RATE_LIMIT_WRITES, RATE_LIMIT_EXPENSIVE, RATE_LIMIT_IP = 600, 120, 60, 1200
+
+	// local import makes more requests than limits allow, even with tokens
+	// added while it runs
+	var dump dataDump
+	for i := 1; i <= 2*RATE_LIMIT_IP; i++ {
+		dump.Locations = append(dump.Locations, models.Location{ID: i, Place: "Place", Country: "Country", City: "City", Distance: 10})
+	}
+	data, _ := json.Marshal(dump)
+	file, _ := ioutil.TempFile("", "dump*.json")
+	file.Write(data)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	out := runCliCommand(t, "import", file.Name())
+	if out != "Imported 0 users, 2400 locations and 0 visits\n" {
+		t.Errorf("Unexpected import output %q", out)
+	}
+}
@@ -0,0 +1,461 @@
+// Package client is a typed client of the API. Requests are retried with
+// exponential backoff when it's safe, creates are sent with Idempotency-Key
+// so that their retries don't create duplicates.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"rest_app/models"
+)
+
+// Auth sets credentials of request
+type Auth interface {
+	Authorize(req *http.Request) error
+}
+
+// AuthFunc is a function which implements Auth
+type AuthFunc func(req *http.Request) error
+
+func (f AuthFunc) Authorize(req *http.Request) error {
+	return f(req)
+}
+
+// APIKey authenticates requests with static API key
+func APIKey(key string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		req.Header.Set("X-API-Key", key)
+		return nil
+	})
+}
+
+// BearerToken authenticates requests with JWT
+func BearerToken(token string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("API error %d: %s", e.StatusCode, e.Message)
+}
+
+func hasStatus(err error, statusCode int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
+
+// IsNotFound checks if entity doesn't exist
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsPreconditionFailed checks if entity was modified after version of If-Match
+func IsPreconditionFailed(err error) bool {
+	return hasStatus(err, http.StatusPreconditionFailed)
+}
+
+// Fields are new values of entity fields for update
+type Fields map[string]interface{}
+
+// VisitsFilter is filter of UserVisits, zero fields aren't applied
+type VisitsFilter struct {
+	// visits after and before timestamps
+	FromDate int
+	ToDate   int
+	Country  string
+	// locations closer than distance
+	ToDistance int
+}
+
+// AvgFilter is filter of LocationAvg, zero fields aren't applied
+type AvgFilter struct {
+	// visits after and before timestamps
+	FromDate int
+	ToDate   int
+	// users older and younger than ages
+	FromAge int
+	ToAge   int
+	// "m" or "f"
+	Gender string
+}
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	auth       Auth
+	maxRetries int
+	retryDelay time.Duration
+}
+
+type Option func(c *Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+func WithAuth(auth Auth) Option {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+// WithRetries sets max number of retries and delay before the first retry,
+// delay is doubled for every next retry
+func WithRetries(maxRetries int, delay time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryDelay = delay
+	}
+}
+
+// New returns client of the API at baseURL, e.g. "http://localhost:8000"
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		maxRetries: 3,
+		retryDelay: 100 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// request is a call of the API. idempotent requests are retried after
+// network and gateway errors.
+type request struct {
+	method         string
+	path           string
+	query          url.Values
+	body           interface{}
+	headers        map[string]string
+	idempotent     bool
+	idempotencyKey string
+}
+
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return hex.EncodeToString(key)
+}
+
+// shouldRetry checks response status. Rate limited requests aren't processed,
+// so they're always retried.
+func shouldRetry(statusCode int, idempotent bool) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+func (c *Client) backoff(attempt int, retryAfter string) time.Duration {
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	delay := float64(c.retryDelay) * math.Pow(2, float64(attempt))
+	// jitter spreads retries of many clients
+	return time.Duration(delay/2 + mathrand.Float64()*delay/2)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Client) newHTTPRequest(ctx context.Context, r *request, body []byte) (*http.Request, error) {
+	u := c.baseURL + r.path
+	if len(r.query) != 0 {
+		u += "?" + r.query.Encode()
+	}
+	req, err := http.NewRequest(r.method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if r.idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", r.idempotencyKey)
+	}
+	for name, value := range r.headers {
+		req.Header.Set(name, value)
+	}
+	if c.auth != nil {
+		if err := c.auth.Authorize(req); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// do sends request and decodes response to out
+func (c *Client) do(ctx context.Context, r *request, out interface{}) error {
+	var body []byte
+	if r.body != nil {
+		var err error
+		if body, err = json.Marshal(r.body); err != nil {
+			return err
+		}
+	}
+
+	// set when request may have been applied by server before retry
+	applied := false
+	for attempt := 0; ; attempt++ {
+		req, err := c.newHTTPRequest(ctx, r, body)
+		if err != nil {
+			return err
+		}
+		res, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if r.idempotent && attempt < c.maxRetries {
+				if err := sleep(ctx, c.backoff(attempt, "")); err != nil {
+					return err
+				}
+				applied = true
+				continue
+			}
+			return err
+		}
+		resBody, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		// retried delete isn't found if previous attempt deleted entity
+		if res.StatusCode == http.StatusNotFound && r.method == http.MethodDelete && applied {
+			return nil
+		}
+		if res.StatusCode >= 400 {
+			if shouldRetry(res.StatusCode, r.idempotent) && attempt < c.maxRetries {
+				if err := sleep(ctx, c.backoff(attempt, res.Header.Get("Retry-After"))); err != nil {
+					return err
+				}
+				applied = applied || res.StatusCode != http.StatusTooManyRequests
+				continue
+			}
+			var errRes struct{ Error string }
+			json.Unmarshal(resBody, &errRes)
+			if errRes.Error == "" {
+				errRes.Error = http.StatusText(res.StatusCode)
+			}
+			return &Error{StatusCode: res.StatusCode, Message: errRes.Error}
+		}
+		if out == nil {
+			return nil
+		}
+		return json.Unmarshal(resBody, out)
+	}
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	return c.do(ctx, &request{method: http.MethodGet, path: path, query: query, idempotent: true}, out)
+}
+
+// fields of models which are set only by the API
+var readOnlyFields = []string{"version", "deleted_at"}
+
+func (c *Client) create(ctx context.Context, entity string, model interface{}, out interface{}) error {
+	data, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+	var fields Fields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, field := range readOnlyFields {
+		delete(fields, field)
+	}
+	key := newIdempotencyKey()
+	return c.do(ctx, &request{method: http.MethodPost, path: "/" + entity + "/new", body: fields, idempotent: true, idempotencyKey: key}, out)
+}
+
+func (c *Client) update(ctx context.Context, entity string, id int, fields Fields, version int) error {
+	r := &request{method: http.MethodPost, path: "/" + entity + "/" + strconv.Itoa(id), body: fields}
+	if version != 0 {
+		r.headers = map[string]string{"If-Match": `"` + strconv.Itoa(version) + `"`}
+	}
+	return c.do(ctx, r, nil)
+}
+
+func (c *Client) delete(ctx context.Context, entity string, id int) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: "/" + entity + "/" + strconv.Itoa(id), idempotent: true}, nil)
+}
+
+func (c *Client) GetUser(ctx context.Context, id int) (*models.User, error) {
+	var user models.User
+	if err := c.get(ctx, "/users/"+strconv.Itoa(id), nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *Client) GetLocation(ctx context.Context, id int) (*models.Location, error) {
+	var location models.Location
+	if err := c.get(ctx, "/locations/"+strconv.Itoa(id), nil, &location); err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+func (c *Client) GetVisit(ctx context.Context, id int) (*models.Visit, error) {
+	var visit models.Visit
+	if err := c.get(ctx, "/visits/"+strconv.Itoa(id), nil, &visit); err != nil {
+		return nil, err
+	}
+	return &visit, nil
+}
+
+func (c *Client) ListUsers(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	if err := c.get(ctx, "/users", nil, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (c *Client) ListLocations(ctx context.Context) ([]models.Location, error) {
+	var locations []models.Location
+	if err := c.get(ctx, "/locations", nil, &locations); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+func (c *Client) ListVisits(ctx context.Context) ([]models.Visit, error) {
+	var visits []models.Visit
+	if err := c.get(ctx, "/visits", nil, &visits); err != nil {
+		return nil, err
+	}
+	return visits, nil
+}
+
+func (c *Client) CreateUser(ctx context.Context, user models.User) (*models.User, error) {
+	var created models.User
+	if err := c.create(ctx, "users", user, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) CreateLocation(ctx context.Context, location models.Location) (*models.Location, error) {
+	var created models.Location
+	if err := c.create(ctx, "locations", location, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) CreateVisit(ctx context.Context, visit models.Visit) (*models.Visit, error) {
+	var created models.Visit
+	if err := c.create(ctx, "visits", visit, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateUser updates fields of user. If version isn't 0, update fails with
+// error checked by IsPreconditionFailed if user was modified after it.
+func (c *Client) UpdateUser(ctx context.Context, id int, fields Fields, version int) error {
+	return c.update(ctx, "users", id, fields, version)
+}
+
+// UpdateLocation updates fields of location, see UpdateUser for version
+func (c *Client) UpdateLocation(ctx context.Context, id int, fields Fields, version int) error {
+	return c.update(ctx, "locations", id, fields, version)
+}
+
+// UpdateVisit updates fields of visit, see UpdateUser for version
+func (c *Client) UpdateVisit(ctx context.Context, id int, fields Fields, version int) error {
+	return c.update(ctx, "visits", id, fields, version)
+}
+
+func (c *Client) DeleteUser(ctx context.Context, id int) error {
+	return c.delete(ctx, "users", id)
+}
+
+func (c *Client) DeleteLocation(ctx context.Context, id int) error {
+	return c.delete(ctx, "locations", id)
+}
+
+func (c *Client) DeleteVisit(ctx context.Context, id int) error {
+	return c.delete(ctx, "visits", id)
+}
+
+func setIntParam(query url.Values, name string, value int) {
+	if value != 0 {
+		query.Set(name, strconv.Itoa(value))
+	}
+}
+
+func (c *Client) UserVisits(ctx context.Context, id int, filter VisitsFilter) ([]models.Visit, error) {
+	query := url.Values{}
+	setIntParam(query, "fromDate", filter.FromDate)
+	setIntParam(query, "toDate", filter.ToDate)
+	setIntParam(query, "toDistance", filter.ToDistance)
+	if filter.Country != "" {
+		query.Set("country", filter.Country)
+	}
+	var visits []models.Visit
+	if err := c.get(ctx, "/users/"+strconv.Itoa(id)+"/visits", query, &visits); err != nil {
+		return nil, err
+	}
+	return visits, nil
+}
+
+func (c *Client) LocationAvg(ctx context.Context, id int, filter AvgFilter) (float64, error) {
+	query := url.Values{}
+	setIntParam(query, "fromDate", filter.FromDate)
+	setIntParam(query, "toDate", filter.ToDate)
+	setIntParam(query, "fromAge", filter.FromAge)
+	setIntParam(query, "toAge", filter.ToAge)
+	if filter.Gender != "" {
+		query.Set("gender", filter.Gender)
+	}
+	var res struct {
+		Avg float64
+	}
+	if err := c.get(ctx, "/locations/"+strconv.Itoa(id)+"/avg", query, &res); err != nil {
+		return 0, err
+	}
+	return res.Avg, nil
+}
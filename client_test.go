@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"rest_app/client"
+	"rest_app/models"
+)
+
+func newTestClient(handler http.Handler, options ...client.Option) (*client.Client, func()) {
+	server := httptest.NewServer(handler)
+	options = append([]client.Option{client.WithAuth(client.APIKey(testApiKey))}, options...)
+	return client.New(server.URL, options...), server.Close
+}
+
+func TestClient(t *testing.T) {
+	ClearDB()
+	c, closeServer := newTestClient(SetupHandlers())
+	defer closeServer()
+	ctx := context.Background()
+
+	user, err := c.CreateUser(ctx, models.User{ID: 1, Email: "test@test.com", FirstName: "Test", LastName: "User", Gender: "m", BirthDate: 100})
+	if err != nil {
+		t.Fatalf("Expected user to be created. Got %v", err)
+	}
+	if user.ID != 1 || user.Version != 1 {
+		t.Errorf("Expected created user with id 1 and version 1. Got %+v", user)
+	}
+	if _, err := c.CreateLocation(ctx, models.Location{ID: 1, Place: "Place", Country: "Country", City: "City", Distance: 10}); err != nil {
+		t.Fatalf("Expected location to be created. Got %v", err)
+	}
+	if _, err := c.CreateVisit(ctx, models.Visit{ID: 1, Location: 1, User: 1, VisitedAt: "1500000000", Mark: 4}); err != nil {
+		t.Fatalf("Expected visit to be created. Got %v", err)
+	}
+
+	if err := c.UpdateLocation(ctx, 1, client.Fields{"distance": 20}, 1); err != nil {
+		t.Fatalf("Expected location to be updated. Got %v", err)
+	}
+	if err := c.UpdateLocation(ctx, 1, client.Fields{"distance": 30}, 1); !client.IsPreconditionFailed(err) {
+		t.Errorf("Expected update of old version to fail. Got %v", err)
+	}
+	location, err := c.GetLocation(ctx, 1)
+	if err != nil || location.Distance != 20 || location.Version != 2 {
+		t.Errorf("Expected updated location. Got %+v, %v", location, err)
+	}
+
+	visits, err := c.UserVisits(ctx, 1, client.VisitsFilter{Country: "Country", ToDistance: 25})
+	if err != nil || len(visits) != 1 || visits[0].Mark != 4 {
+		t.Errorf("Expected one user visit. Got %+v, %v", visits, err)
+	}
+	visits, err = c.UserVisits(ctx, 1, client.VisitsFilter{FromDate: 1500000000})
+	if err != nil || len(visits) != 0 {
+		t.Errorf("Expected no user visits. Got %+v, %v", visits, err)
+	}
+
+	avg, err := c.LocationAvg(ctx, 1, client.AvgFilter{Gender: "m"})
+	if err != nil || avg != 4 {
+		t.Errorf("Expected average mark 4. Got %v, %v", avg, err)
+	}
+
+	if err := c.DeleteVisit(ctx, 1); err != nil {
+		t.Fatalf("Expected visit to be deleted. Got %v", err)
+	}
+	if _, err := c.GetVisit(ctx, 1); !client.IsNotFound(err) {
+		t.Errorf("Expected deleted visit not to be found. Got %v", err)
+	}
+	if _, err := c.GetUser(ctx, 2); !client.IsNotFound(err) {
+		t.Errorf("Expected non existent user not to be found. Got %v", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	ClearDB()
+	var requests int32
+	handler := SetupHandlers()
+	c, closeServer := newTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// first request of every call is rate limited
+		if atomic.AddInt32(&requests, 1)%2 == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}), client.WithRetries(1, time.Millisecond))
+	defer closeServer()
+
+	_, err := c.CreateUser(context.Background(), models.User{ID: 1, Email: "test@test.com", FirstName: "Test", LastName: "User", Gender: "m", BirthDate: 100})
+	if err != nil {
+		t.Errorf("Expected rate limited request to be retried. Got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests. Got %d", requests)
+	}
+
+	c, closeServer = newTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), client.WithRetries(2, time.Millisecond))
+	defer closeServer()
+	_, err = c.GetUser(context.Background(), 1)
+	if e, ok := err.(*client.Error); !ok || e.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected API error with status 503 after retries. Got %v", err)
+	}
+
+	// first attempt deletes user, but its response is lost
+	requests = 0
+	c, closeServer = newTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}), client.WithRetries(1, time.Millisecond))
+	defer closeServer()
+	if err := c.DeleteUser(context.Background(), 1); err != nil {
+		t.Errorf("Expected retried delete to succeed. Got %v", err)
+	}
+	if err := c.DeleteUser(context.Background(), 1); !client.IsNotFound(err) {
+		t.Errorf("Expected delete of deleted user to fail with 404. Got %v", err)
+	}
+}
+
+func TestClientContextCancellation(t *testing.T) {
+	c, closeServer := newTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), client.WithRetries(10, time.Second))
+	defer closeServer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.GetUser(ctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded error. Got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Expected retries to stop on cancellation")
+	}
+}
+
+// TestClientOpenAPISpec checks that every method of client sends operation,
+// query parameters and headers of OpenAPI spec
+func TestClientOpenAPISpec(t *testing.T) {
+	spec := readOpenAPISpec(t)
+	// paths with less variables are matched first, like routes of SetupHandlers
+	var paths []string
+	for path := range spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		vars := strings.Count(paths[i], "{") - strings.Count(paths[j], "{")
+		return vars < 0 || vars == 0 && paths[i] < paths[j]
+	})
+	router := mux.NewRouter()
+	for _, path := range paths {
+		for method := range spec.Paths[path] {
+			if method != "parameters" {
+				router.NewRoute().Path(path).Methods(strings.ToUpper(method)).Name(method + " " + path)
+			}
+		}
+	}
+
+	var requests []*http.Request
+	c, closeServer := newTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		w.Write([]byte("{}"))
+	}), client.WithRetries(0, 0))
+	defer closeServer()
+	ctx := context.Background()
+	fields := client.Fields{"email": "a@mail.com"}
+	calls := map[string]func(){
+		"GetUser":        func() { c.GetUser(ctx, 1) },
+		"GetLocation":    func() { c.GetLocation(ctx, 1) },
+		"GetVisit":       func() { c.GetVisit(ctx, 1) },
+		"ListUsers":      func() { c.ListUsers(ctx) },
+		"ListLocations":  func() { c.ListLocations(ctx) },
+		"ListVisits":     func() { c.ListVisits(ctx) },
+		"CreateUser":     func() { c.CreateUser(ctx, models.User{ID: 1}) },
+		"CreateLocation": func() { c.CreateLocation(ctx, models.Location{ID: 1}) },
+		"CreateVisit":    func() { c.CreateVisit(ctx, models.Visit{ID: 1}) },
+		"UpdateUser":     func() { c.UpdateUser(ctx, 1, fields, 1) },
+		"UpdateLocation": func() { c.UpdateLocation(ctx, 1, fields, 1) },
+		"UpdateVisit":    func() { c.UpdateVisit(ctx, 1, fields, 1) },
+		"DeleteUser":     func() { c.DeleteUser(ctx, 1) },
+		"DeleteLocation": func() { c.DeleteLocation(ctx, 1) },
+		"DeleteVisit":    func() { c.DeleteVisit(ctx, 1) },
+		"UserVisits": func() {
+			c.UserVisits(ctx, 1, client.VisitsFilter{FromDate: 1, ToDate: 2, Country: "Russia", ToDistance: 3})
+		},
+		"LocationAvg": func() {
+			c.LocationAvg(ctx, 1, client.AvgFilter{FromDate: 1, ToDate: 2, FromAge: 3, ToAge: 4, Gender: "m"})
+		},
+	}
+	clientType := reflect.TypeOf(c)
+	for i := 0; i < clientType.NumMethod(); i++ {
+		if _, ok := calls[clientType.Method(i).Name]; !ok {
+			t.Errorf("Method %s of client isn't checked against OpenAPI spec", clientType.Method(i).Name)
+		}
+	}
+
+	for name, call := range calls {
+		requests = nil
+		call()
+		if len(requests) != 1 {
+			t.Errorf("Expected one request of %s. Got %d", name, len(requests))
+			continue
+		}
+		req := requests[0]
+		var match mux.RouteMatch
+		if !router.Match(req, &match) || match.Route == nil {
+			t.Errorf("Request %s %s of %s isn't in OpenAPI spec", req.Method, req.URL.Path, name)
+			continue
+		}
+		path, _ := match.Route.GetPathTemplate()
+		parameters := spec.getParameters(path, strings.ToLower(req.Method))
+		for parameter := range req.URL.Query() {
+			if !parameters["query "+parameter] {
+				t.Errorf("Query parameter %s of %s isn't in OpenAPI spec of %s %s", parameter, name, req.Method, path)
+			}
+		}
+		for _, header := range []string{"If-Match", "If-None-Match", "Idempotency-Key"} {
+			if req.Header.Get(header) != "" && !parameters["header "+header] {
+				t.Errorf("Header %s of %s isn't in OpenAPI spec of %s %s", header, name, req.Method, path)
+			}
+		}
+	}
+}
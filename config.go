@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Settings which can be set with environment variables of the same name
+var (
+	// HS256 JWTs are accepted only if secret is set
+	JWT_SECRET = getEnv("JWT_SECRET", "")
+	// RS256 JWTs are accepted only if JWKS file is set
+	JWT_JWKS_PATH = getEnv("JWT_JWKS_PATH", "")
+	// "iss" and "aud" claims of JWTs are checked if these are set
+	JWT_ISSUER   = getEnv("JWT_ISSUER", "")
+	JWT_AUDIENCE = getEnv("JWT_AUDIENCE", "")
+
+	// requests per minute from one API key or IP address, 0 disables limit
+	RATE_LIMIT_READS     = getEnvInt("RATE_LIMIT_READS", 600)
+	RATE_LIMIT_WRITES    = getEnvInt("RATE_LIMIT_WRITES", 120)
+	RATE_LIMIT_EXPENSIVE = getEnvInt("RATE_LIMIT_EXPENSIVE", 60)
+	// requests per minute from one IP address before authentication, it limits
+	// requests with bad credentials
+	RATE_LIMIT_IP = getEnvInt("RATE_LIMIT_IP", 1200)
+
+	// max request body size in bytes
+	MAX_BODY_SIZE = getEnvInt("MAX_BODY_SIZE", 1<<20)
+
+	// audit records are removed after this number of days, 0 keeps them forever
+	AUDIT_RETENTION_DAYS = getEnvInt("AUDIT_RETENTION_DAYS", 90)
+
+	// updates and deletes without If-Match header are rejected if set to "true"
+	REQUIRE_IF_MATCH = getEnv("REQUIRE_IF_MATCH", "") == "true"
+
+	// server deletes all entities on start if set to "true", like it did
+	// before data was kept between starts
+	CLEAR_DB_ON_START = getEnv("CLEAR_DB_ON_START", "") == "true"
+
+	// responses to requests with Idempotency-Key header are kept for this number of hours
+	IDEMPOTENCY_KEY_TTL_HOURS = getEnvInt("IDEMPOTENCY_KEY_TTL_HOURS", 24)
+
+	// failed webhook deliveries are retried with delay doubled after each
+	// attempt, events are moved to dead letters after the last attempt
+	WEBHOOK_MAX_ATTEMPTS    = getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5)
+	WEBHOOK_RETRY_DELAY_MS  = getEnvInt("WEBHOOK_RETRY_DELAY_MS", 1000)
+	WEBHOOK_TIMEOUT_SECONDS = getEnvInt("WEBHOOK_TIMEOUT_SECONDS", 10)
+
+	// events of outbox are delivered to these sinks, separated by commas:
+	// "webhook", "stdout" or "file"
+	OUTBOX_SINKS     = getEnv("OUTBOX_SINKS", "webhook")
+	OUTBOX_FILE_PATH = getEnv("OUTBOX_FILE_PATH", "events.log")
+	// failed deliveries to sink are retried with delay doubled after each
+	// attempt up to max delay
+	OUTBOX_RETRY_DELAY_MS     = getEnvInt("OUTBOX_RETRY_DELAY_MS", 1000)
+	OUTBOX_MAX_RETRY_DELAY_MS = getEnvInt("OUTBOX_MAX_RETRY_DELAY_MS", 60000)
+
+	// WebSocket connections of live location averages, in total and from one
+	// API key or IP address
+	LIVE_AVG_MAX_CONNECTIONS            = getEnvInt("LIVE_AVG_MAX_CONNECTIONS", 1000)
+	LIVE_AVG_MAX_CONNECTIONS_PER_CLIENT = getEnvInt("LIVE_AVG_MAX_CONNECTIONS_PER_CLIENT", 10)
+	// subscriptions of one WebSocket connection and its subscribe messages
+	// per minute
+	LIVE_AVG_MAX_SUBSCRIPTIONS    = getEnvInt("LIVE_AVG_MAX_SUBSCRIPTIONS", 100)
+	LIVE_AVG_SUBSCRIBE_RATE_LIMIT = getEnvInt("LIVE_AVG_SUBSCRIBE_RATE_LIMIT", 60)
+
+	// nesting of GraphQL queries and number of their fields, fragments are
+	// counted every time they're spread
+	GRAPHQL_MAX_DEPTH      = getEnvInt("GRAPHQL_MAX_DEPTH", 10)
+	GRAPHQL_MAX_COMPLEXITY = getEnvInt("GRAPHQL_MAX_COMPLEXITY", 500)
+
+	// log is written to "file", "stdout" or "both"
+	LOG_OUTPUT    = getEnv("LOG_OUTPUT", "file")
+	LOG_FILE_PATH = getEnv("LOG_FILE_PATH", "log.log")
+	// log file is rotated when it reaches this size, 0 disables rotation
+	LOG_MAX_SIZE_MB = getEnvInt("LOG_MAX_SIZE_MB", 100)
+	// number of rotated log files which are kept
+	LOG_MAX_BACKUPS = getEnvInt("LOG_MAX_BACKUPS", 5)
+
+	// /metrics is served without authentication on this address (e.g. ":9100")
+	// if it's set, otherwise it's served by the API to admins
+	METRICS_ADDR = getEnv("METRICS_ADDR", "")
+
+	// gRPC API is served on this address, empty address disables it
+	GRPC_ADDR = getEnv("GRPC_ADDR", ":9000")
+
+	// on SIGTERM /readyz fails for this number of seconds before server stops
+	// accepting requests, so that load balancers stop sending them
+	SHUTDOWN_DRAIN_SECONDS = getEnvInt("SHUTDOWN_DRAIN_SECONDS", 5)
+	// time for requests in progress to finish on shutdown
+	SHUTDOWN_TIMEOUT_SECONDS = getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 30)
+
+	// spans are exported to "otlp", "stdout" or "file", tracing is disabled by default
+	TRACING_EXPORTER     = getEnv("TRACING_EXPORTER", "")
+	TRACING_FILE_PATH    = getEnv("TRACING_FILE_PATH", "traces.log")
+	TRACING_SERVICE_NAME = getEnv("TRACING_SERVICE_NAME", "rest_app")
+	// OTLP/HTTP traces endpoint of collector
+	OTLP_ENDPOINT = getEnv("OTLP_ENDPOINT", "http://localhost:4318/v1/traces")
+)
+
+func getEnv(name string, defaultValue string) string {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvInt(name string, defaultValue int) int {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultValue
+	}
+	res, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s must be an integer", name)
+	}
+	return res
+}
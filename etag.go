@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Version of models is incremented on every change of entity and is used as
+// its ETag
+
+func getModelVersion(model interface{}) int {
+	switch m := model.(type) {
+	case User:
+		return m.Version
+	case Visit:
+		return m.Version
+	case Location:
+		return m.Version
+	}
+	return 0
+}
+
+func getETag(model interface{}) string {
+	return `"` + strconv.Itoa(getModelVersion(model)) + `"`
+}
+
+// incrementVersion is an update of version column for Updates
+func incrementVersion() interface{} {
+	return gorm.Expr("version + 1")
+}
+
+// bumpVersion increments version of entity on delete and restore, so ETags of
+// entity before them don't match. Version of model isn't changed.
+func bumpVersion(tx *gorm.DB, model interface{}) error {
+	return tx.Unscoped().Model(model).UpdateColumn("version", incrementVersion()).Error
+}
+
+// matchETag checks if etag is in list of If-Match or If-None-Match header.
+// Weak ETags in the list match only with weak comparison.
+func matchETag(header string, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch checks If-Match header of update or delete request against
+// current state of entity. Header is required if REQUIRE_IF_MATCH is set.
+func checkIfMatch(r *http.Request, model interface{}) (interface{}, int) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if REQUIRE_IF_MATCH {
+			return map[string]string{"Error": "If-Match header is required"}, 428
+		}
+		return nil, 200
+	}
+	if !matchETag(header, getETag(model), false) {
+		return map[string]string{"Error": "Entity was modified"}, 412
+	}
+	return nil, 200
+}
+
+// isNotModified checks If-None-Match header of read request
+func isNotModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	return header != "" && matchETag(header, etag, true)
+}
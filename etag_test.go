@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestETags(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+
+	req, _ := http.NewRequest("GET", "/users/1", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	etag := response.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Errorf("Expected ETag of new entity to be '\"1\"'. Got '%s'", etag)
+	}
+
+	req, _ = http.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusNotModified, response.Code)
+	if response.Body.Len() != 0 {
+		t.Errorf("Expected empty body of not modified response. Got '%s'", response.Body.String())
+	}
+
+	req, _ = http.NewRequest("POST", "/users/1", bytes.NewBufferString(`{"first_name": "B"}`))
+	req.Header.Set("If-Match", etag)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if newETag := response.Header().Get("ETag"); newETag != `"2"` {
+		t.Errorf("Expected ETag of updated entity to be '\"2\"'. Got '%s'", newETag)
+	}
+
+	req, _ = http.NewRequest("POST", "/users/1", bytes.NewBufferString(`{"first_name": "C"}`))
+	req.Header.Set("If-Match", etag)
+	checkResponseCode(t, http.StatusPreconditionFailed, executeRequest(req).Code)
+	req, _ = http.NewRequest("DELETE", "/users/1", nil)
+	req.Header.Set("If-Match", etag)
+	checkResponseCode(t, http.StatusPreconditionFailed, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	REQUIRE_IF_MATCH = true
+	defer func() { REQUIRE_IF_MATCH = false }()
+	req, _ = http.NewRequest("DELETE", "/users/1", nil)
+	checkResponseCode(t, http.StatusPreconditionRequired, executeRequest(req).Code)
+	req, _ = http.NewRequest("DELETE", "/users/1", nil)
+	req.Header.Set("If-Match", `W/"2"`)
+	checkResponseCode(t, http.StatusPreconditionFailed, executeRequest(req).Code)
+	req, _ = http.NewRequest("DELETE", "/users/1", nil)
+	req.Header.Set("If-Match", `"3", "2"`)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	checkBodyResponse(t, "/users/new", "", `{"id": 2, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 1, "version": 5}`, http.StatusBadRequest)
+}
+
+func TestETagsOfDeleteAndRestore(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+
+	req, _ := http.NewRequest("DELETE", "/locations/1", nil)
+	req.Header.Set("If-Match", `"1"`)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	postJSON(t, "/locations/1/restore", "")
+
+	// ETag from before delete doesn't match restored entity
+	req, _ = http.NewRequest("POST", "/locations/1", bytes.NewBufferString(`{"distance": 20}`))
+	req.Header.Set("If-Match", `"1"`)
+	checkResponseCode(t, http.StatusPreconditionFailed, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("GET", "/locations/1", nil)
+	response := executeRequest(req)
+	if etag := response.Header().Get("ETag"); etag != `"3"` {
+		t.Errorf("Expected ETag of restored entity to be '\"3\"'. Got '%s'", etag)
+	}
+	var record AuditRecord
+	db.Where("entity = ? AND entity_id = ?", "locations", 1).Order("id desc").First(&record)
+	if record.Operation != OPERATION_RESTORE || !strings.Contains(record.After, `"version":3`) {
+		t.Errorf("Expected audit record of restore with version 3. Got %+v", record)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	EVENT_CREATED  = "created"
+	EVENT_UPDATED  = "updated"
+	EVENT_DELETED  = "deleted"
+	EVENT_RESTORED = "restored"
+
+	// events buffered for each SSE client, slow clients are disconnected
+	// and may resume with Last-Event-ID
+	EVENT_BUFFER_SIZE = 100
+	// comment is sent to SSE clients after this time without events, so
+	// proxies don't close idle connections
+	SSE_HEARTBEAT_INTERVAL = 15 * time.Second
+)
+
+var eventTypes = map[string]string{
+	OPERATION_CREATE:  EVENT_CREATED,
+	OPERATION_UPDATE:  EVENT_UPDATED,
+	OPERATION_DELETE:  EVENT_DELETED,
+	OPERATION_RESTORE: EVENT_RESTORED,
+}
+
+// operations of audit records which are events, denials aren't
+var eventOperations = []string{OPERATION_CREATE, OPERATION_UPDATE, OPERATION_DELETE, OPERATION_RESTORE}
+
+// Event is a change of entity. ID is id of audit record of the change, so
+// events are ordered and can be replayed from audit log. Data is entity
+// after the change or before it for deleted entities.
+type Event struct {
+	ID        int             `json:"id"`
+	Type      string          `json:"type"`
+	Entity    string          `json:"entity"`
+	EntityID  int             `json:"entity_id"`
+	Timestamp int             `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+	// entity before update, it isn't sent to clients
+	before json.RawMessage
+}
+
+func newEvent(record AuditRecord) Event {
+	data := record.After
+	if data == "" {
+		data = record.Before
+	}
+	var before json.RawMessage
+	if record.Before != "" && record.After != "" {
+		before = rawImage(record.Before)
+	}
+	return Event{
+		ID:        record.ID,
+		Type:      eventTypes[record.Operation],
+		Entity:    record.Entity,
+		EntityID:  record.EntityID,
+		Timestamp: record.Timestamp,
+		Data:      rawImage(data),
+		before:    before,
+	}
+}
+
+type eventSubscription struct {
+	// events of all entities are sent if entity is empty
+	entity string
+	events chan Event
+}
+
+// eventBus sends published events to subscribers in process
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[*eventSubscription]bool
+}
+
+var events = &eventBus{subscribers: make(map[*eventSubscription]bool)}
+
+func (b *eventBus) subscribe(entity string) *eventSubscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &eventSubscription{entity: entity, events: make(chan Event, EVENT_BUFFER_SIZE)}
+	b.subscribers[s] = true
+	return s
+}
+
+func (b *eventBus) unsubscribe(s *eventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers[s] {
+		delete(b.subscribers, s)
+		close(s.events)
+	}
+}
+
+// publish doesn't wait for subscribers, channel of subscriber whose buffer is
+// full is closed
+func (b *eventBus) publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		if s.entity != "" && s.entity != e.Entity {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			log.WithFields(log.Fields{"module": "events"}).Warn("Slow subscriber is disconnected")
+			delete(b.subscribers, s)
+			close(s.events)
+		}
+	}
+}
+
+// closeAll closes channels of all subscribers, it's called on shutdown so
+// SSE responses are finished
+func (b *eventBus) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		delete(b.subscribers, s)
+		close(s.events)
+	}
+}
+
+// publishEvent sends event to subscribers in process and wakes up outbox
+// dispatcher, which delivers it from outbox
+func publishEvent(e Event) {
+	events.publish(e)
+	wakeOutbox()
+}
+
+func isEventEntity(entity string) bool {
+	return entity == "users" || entity == "locations" || entity == "visits"
+}
+
+func writeSSEEvent(w http.ResponseWriter, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
+
+// replayEvents sends events after lastEventID from audit log and returns id
+// of the last sent event
+func replayEvents(w http.ResponseWriter, r *http.Request, entity string, lastEventID int) (int, error) {
+	db := InitRequestDb(r)
+	defer db.Close()
+
+	for {
+		query := db.Where("id > ? AND operation IN (?)", lastEventID, eventOperations)
+		if entity != "" {
+			query = query.Where("entity = ?", entity)
+		}
+		var records []AuditRecord
+		if err := query.Order("id").Limit(MAX_LIMIT).Find(&records).Error; err != nil {
+			return lastEventID, err
+		}
+		for _, record := range records {
+			if err := writeSSEEvent(w, newEvent(record)); err != nil {
+				return lastEventID, err
+			}
+			lastEventID = record.ID
+		}
+		if len(records) < MAX_LIMIT {
+			return lastEventID, nil
+		}
+	}
+}
+
+// getEvents streams events as Server-Sent Events. Clients reconnecting with
+// Last-Event-ID header get missed events from audit log first.
+func getEvents(w http.ResponseWriter, r *http.Request) {
+	entity := r.URL.Query().Get("entity")
+	lastEventID := -1
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.Atoi(header)
+		if err != nil || id < 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(map[string]string{"Error": "Bad Last-Event-ID header"})
+			return
+		}
+		lastEventID = id
+	}
+	if entity != "" && !isEventEntity(entity) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"Error": "Bad query string parameters"})
+		return
+	}
+
+	// subscription is made before replay so events committed during it aren't
+	// missed, replayed ones are skipped
+	subscription := events.subscribe(entity)
+	defer events.unsubscribe(subscription)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+	rc := http.NewResponseController(w)
+
+	replayed := -1
+	if lastEventID != -1 {
+		var err error
+		if replayed, err = replayEvents(w, r, entity, lastEventID); err != nil {
+			log.WithFields(log.Fields{"module": "events"}).Error(err)
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(SSE_HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-subscription.events:
+			if !ok {
+				return
+			}
+			if e.ID <= replayed {
+				continue
+			}
+			if err := writeSSEEvent(w, e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// openEventStream connects to /events, subscription is made before response
+// headers are sent
+func openEventStream(t *testing.T, url string, lastEventID string) (*bufio.Reader, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req.Header.Set(API_KEY_HEADER, testApiKey)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+	if contentType := res.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected text/event-stream content type. Got %s", contentType)
+	}
+	return bufio.NewReader(res.Body), func() {
+		cancel()
+		res.Body.Close()
+	}
+}
+
+func readSSEEvent(t *testing.T, reader *bufio.Reader) (string, Event) {
+	var id string
+	var e Event
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Unexpected end of stream %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && id != "":
+			return id, e
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e)
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	ClearDB()
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	stream, closeStream := openEventStream(t, server.URL+"/events?entity=visits", "")
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Place", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+	postJSON(t, "/visits/1", `{"mark": 4}`)
+
+	// events of other entities aren't sent
+	id, e := readSSEEvent(t, stream)
+	if e.Type != EVENT_CREATED || e.Entity != "visits" || e.EntityID != 1 || id != strconv.Itoa(e.ID) {
+		t.Errorf("Expected created visit event. Got %s %+v", id, e)
+	}
+	createdID := id
+	_, e = readSSEEvent(t, stream)
+	var visit Visit
+	json.Unmarshal(e.Data, &visit)
+	if e.Type != EVENT_UPDATED || visit.Mark != 4 || visit.Version != 2 {
+		t.Errorf("Expected updated visit event. Got %+v", e)
+	}
+	closeStream()
+
+	// missed events are replayed from audit log after Last-Event-ID
+	req, _ := http.NewRequest("DELETE", "/visits/1", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	stream, closeStream = openEventStream(t, server.URL+"/events?entity=visits", createdID)
+	defer closeStream()
+	_, e = readSSEEvent(t, stream)
+	if e.Type != EVENT_UPDATED {
+		t.Errorf("Expected replayed updated visit event. Got %+v", e)
+	}
+	_, e = readSSEEvent(t, stream)
+	json.Unmarshal(e.Data, &visit)
+	if e.Type != EVENT_DELETED || visit.ID != 1 {
+		t.Errorf("Expected replayed deleted visit event. Got %+v", e)
+	}
+	postJSON(t, "/visits/new", `{"id": 2, "location": 1, "user": 1, "visited_at": "1500000001", "mark": 3}`)
+	_, e = readSSEEvent(t, stream)
+	if e.Type != EVENT_CREATED || e.EntityID != 2 {
+		t.Errorf("Expected live event after replayed ones. Got %+v", e)
+	}
+}
+
+func TestEventStreamBadParameters(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/events?entity=badentity", nil)
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+	req, _ = http.NewRequest("GET", "/events", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+}
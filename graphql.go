@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/lexer"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// GraphQL requests are parsed, validated and executed by graphql-go, which
+// supports the whole spec including introspection. Depth and number of fields
+// of operations are limited before execution.
+
+// documents nested deeper are rejected before parsing, so they don't exhaust
+// stack. Depth of queries is limited by GRAPHQL_MAX_DEPTH after parsing.
+const gqlMaxNesting = 64
+
+// checkNesting checks nesting of brackets of document. Syntax errors are left
+// to parser.
+func checkNesting(src *source.Source) error {
+	next := lexer.Lex(src)
+	depth := 0
+	for {
+		token, err := next(0)
+		if err != nil {
+			return nil
+		}
+		switch token.Kind {
+		case lexer.EOF:
+			return nil
+		case lexer.BRACE_L, lexer.PAREN_L, lexer.BRACKET_L:
+			depth++
+			if depth > gqlMaxNesting {
+				description := fmt.Sprintf("Document is nested deeper than %d levels.", gqlMaxNesting)
+				return gqlerrors.NewSyntaxError(src, token.Start, description)
+			}
+		case lexer.BRACE_R, lexer.PAREN_R, lexer.BRACKET_R:
+			depth--
+		}
+	}
+}
+
+// gqlCost is depth and number of fields of selections with fragments expanded
+type gqlCost struct {
+	depth      int
+	complexity int
+}
+
+// gqlMeasure measures selections of document. Cost of fragments is counted
+// once and kept in costs, so documents which spread fragments many times are
+// measured quickly.
+type gqlMeasure struct {
+	fragments map[string]*ast.FragmentDefinition
+	costs     map[string]gqlCost
+}
+
+// measure returns cost of selections. Complexity is capped to stay in int.
+// ofType fields of introspection aren't counted in depth, they describe
+// wrapping of one type, e.g. [Int!]!.
+func (m *gqlMeasure) measure(set *ast.SelectionSet) gqlCost {
+	var cost gqlCost
+	if set == nil {
+		return cost
+	}
+	for _, s := range set.Selections {
+		var c gqlCost
+		switch s := s.(type) {
+		case *ast.FragmentSpread:
+			c = m.fragment(s.Name.Value)
+		case *ast.InlineFragment:
+			c = m.measure(s.SelectionSet)
+		case *ast.Field:
+			c = m.measure(s.SelectionSet)
+			if s.Name.Value != "ofType" {
+				c.depth++
+			}
+			c.complexity++
+		}
+		if c.depth > cost.depth {
+			cost.depth = c.depth
+		}
+		cost.complexity += c.complexity
+		if cost.complexity > GRAPHQL_MAX_COMPLEXITY {
+			cost.complexity = GRAPHQL_MAX_COMPLEXITY + 1
+		}
+	}
+	return cost
+}
+
+// fragment returns cost of fragment. Unknown fragments and cycles are
+// reported by validation, they cost nothing here.
+func (m *gqlMeasure) fragment(name string) gqlCost {
+	if cost, ok := m.costs[name]; ok {
+		return cost
+	}
+	fragment, ok := m.fragments[name]
+	if !ok {
+		return gqlCost{}
+	}
+	m.costs[name] = gqlCost{}
+	cost := m.measure(fragment.SelectionSet)
+	m.costs[name] = cost
+	return cost
+}
+
+// gqlRequest is a body of GraphQL request
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func gqlErrorResult(err error) *graphql.Result {
+	return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+}
+
+// getOperation returns operation of document which is executed for request,
+// or nil if there is no such operation. Fragments of document are added to
+// fragments.
+func getOperation(doc *ast.Document, name string, fragments map[string]*ast.FragmentDefinition) *ast.OperationDefinition {
+	var operations []*ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.OperationDefinition:
+			if name == "" || (def.Name != nil && def.Name.Value == name) {
+				operations = append(operations, def)
+			}
+		case *ast.FragmentDefinition:
+			fragments[def.Name.Value] = def
+		}
+	}
+	if len(operations) != 1 {
+		// execution reports missing and ambiguous operations
+		return nil
+	}
+	return operations[0]
+}
+
+// executeGraphQL executes operation of request. Operations of GET requests
+// may only be queries.
+func executeGraphQL(ctx *gqlContext, schema graphql.Schema, req *gqlRequest, readOnly bool) *graphql.Result {
+	src := source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"})
+	if err := checkNesting(src); err != nil {
+		return gqlErrorResult(err)
+	}
+	doc, err := parser.Parse(parser.ParseParams{Source: src})
+	if err != nil {
+		return gqlErrorResult(err)
+	}
+
+	fragments := make(map[string]*ast.FragmentDefinition)
+	if op := getOperation(doc, req.OperationName, fragments); op != nil {
+		if op.Operation == ast.OperationTypeMutation && readOnly {
+			return gqlErrorResult(errors.New("Mutations are allowed only in POST requests"))
+		}
+		m := &gqlMeasure{fragments: fragments, costs: make(map[string]gqlCost)}
+		cost := m.measure(op.SelectionSet)
+		if cost.depth > GRAPHQL_MAX_DEPTH {
+			return gqlErrorResult(fmt.Errorf("Query depth is more than %d", GRAPHQL_MAX_DEPTH))
+		}
+		if cost.complexity > GRAPHQL_MAX_COMPLEXITY {
+			return gqlErrorResult(fmt.Errorf("Query has more than %d fields", GRAPHQL_MAX_COMPLEXITY))
+		}
+	}
+
+	if res := graphql.ValidateDocument(&schema, doc, nil); !res.IsValid {
+		return &graphql.Result{Errors: res.Errors}
+	}
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       context.WithValue(ctx.r.Context(), gqlContextKey, ctx),
+	})
+}
+
+// serveGraphQL serves GraphQL requests in POST body or in GET query string
+func serveGraphQL(schema graphql.Schema) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req gqlRequest
+		if r.Method == http.MethodGet {
+			qsParams := r.URL.Query()
+			req.Query = qsParams.Get("query")
+			req.OperationName = qsParams.Get("operationName")
+			if variables := qsParams.Get("variables"); variables != "" {
+				if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+					w.WriteHeader(400)
+					json.NewEncoder(w).Encode(gqlErrorResult(errors.New("Bad variables parameter")))
+					return
+				}
+			}
+		} else {
+			body, err := readRequestBody(r)
+			if err != nil {
+				res, statusCode := getBodyErrorResponse(err)
+				w.WriteHeader(statusCode)
+				json.NewEncoder(w).Encode(res)
+				return
+			}
+			if err := json.Unmarshal(body, &req); err != nil {
+				w.WriteHeader(400)
+				json.NewEncoder(w).Encode(gqlErrorResult(errors.New("Bad request body, expected JSON with query")))
+				return
+			}
+		}
+		if req.Query == "" {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(gqlErrorResult(errors.New("No query specified")))
+			return
+		}
+
+		ctx := newGqlContext(r)
+		defer ctx.db.Close()
+		json.NewEncoder(w).Encode(executeGraphQL(ctx, schema, &req, r.Method == http.MethodGet))
+	}
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
+	"github.com/jinzhu/gorm"
+)
+
+const gqlContextKey contextKey = "graphql"
+
+// gqlContext is a state of one GraphQL request
+type gqlContext struct {
+	r      *http.Request
+	db     *gorm.DB
+	loader *gqlLoader
+}
+
+func newGqlContext(r *http.Request) *gqlContext {
+	db := InitRequestDb(r)
+	return &gqlContext{r: r, db: db, loader: newGqlLoader(db)}
+}
+
+func getGqlContext(p graphql.ResolveParams) *gqlContext {
+	return p.Context.Value(gqlContextKey).(*gqlContext)
+}
+
+// gqlResponseError returns error of REST error response
+func gqlResponseError(res interface{}) error {
+	if res, ok := res.(map[string]string); ok && res["Error"] != "" {
+		return errors.New(res["Error"])
+	}
+	return errors.New("Unexpected error")
+}
+
+// mutationRequest returns request and body for handler of mutation. Request is
+// checked with access rule of REST route template, so GraphQL mutations are
+// allowed like REST ones. Version argument is sent in If-Match header.
+func (ctx *gqlContext) mutationRequest(method string, template string, entity string, args map[string]interface{}) (*http.Request, []byte, error) {
+	req := ctx.r.Clone(ctx.r.Context())
+	req.Method = method
+	vars := map[string]string{"entity": entity}
+	if id, ok := args["id"].(int); ok {
+		vars["id"] = strconv.Itoa(id)
+	}
+	req = mux.SetURLVars(req, vars)
+	req.Header.Del("If-Match")
+	if version, ok := args["version"].(int); ok {
+		req.Header.Set("If-Match", `"`+strconv.Itoa(version)+`"`)
+	}
+	body, err := json.Marshal(args["input"])
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	p := getPrincipal(req)
+	if p == nil || !isAllowedRoute(p, req, template) {
+		logAccessDenied(req, p)
+		return nil, nil, errors.New("Access denied")
+	}
+	return req, body, nil
+}
+
+// gqlBatch is ids of entities which are loaded with one query when value of
+// any of them is needed
+type gqlBatch struct {
+	ids    []int
+	fetch  func(ids []int) (map[int]interface{}, error)
+	values map[int]interface{}
+	err    error
+	done   bool
+}
+
+func (b *gqlBatch) run() {
+	if !b.done {
+		b.done = true
+		b.values, b.err = b.fetch(b.ids)
+	}
+}
+
+// gqlLoader loads entities by ids in batches and caches them for request, so
+// nested fields of lists aren't loaded with query per parent. Resolvers return
+// thunks, graphql-go calls them after fields of all parents are resolved.
+type gqlLoader struct {
+	db       *gorm.DB
+	entities map[string]map[int]interface{}
+	batches  map[string]*gqlBatch
+}
+
+func newGqlLoader(db *gorm.DB) *gqlLoader {
+	return &gqlLoader{db: db, entities: make(map[string]map[int]interface{}), batches: make(map[string]*gqlBatch)}
+}
+
+// flush loads pending batches, mutations call it so fields of previous
+// mutations aren't resolved with their changes
+func (l *gqlLoader) flush() {
+	for _, b := range l.batches {
+		b.run()
+	}
+}
+
+// reset clears cache after mutations
+func (l *gqlLoader) reset() {
+	l.entities = make(map[string]map[int]interface{})
+	l.batches = make(map[string]*gqlBatch)
+}
+
+func (l *gqlLoader) cache(entity string) map[int]interface{} {
+	cache, ok := l.entities[entity]
+	if !ok {
+		cache = make(map[int]interface{})
+		l.entities[entity] = cache
+	}
+	return cache
+}
+
+// prime caches entities loaded by other queries
+func (l *gqlLoader) prime(entity string, models []interface{}) {
+	cache := l.cache(entity)
+	for _, model := range models {
+		cache[getModelID(model)] = model
+	}
+}
+
+// enqueue adds id to pending batch of key, it returns thunk of value of id
+func (l *gqlLoader) enqueue(key string, id int, fetch func(ids []int) (map[int]interface{}, error)) func() (interface{}, error) {
+	b := l.batches[key]
+	if b == nil || b.done {
+		b = &gqlBatch{fetch: fetch}
+		l.batches[key] = b
+	}
+	b.ids = append(b.ids, id)
+	return func() (interface{}, error) {
+		b.run()
+		return b.values[id], b.err
+	}
+}
+
+// load returns thunk of entity with id. Entities which don't exist are nil.
+func (l *gqlLoader) load(entity string, id int) func() (interface{}, error) {
+	if model, ok := l.cache(entity)[id]; ok {
+		return func() (interface{}, error) { return model, nil }
+	}
+	return l.enqueue(entity, id, func(ids []int) (map[int]interface{}, error) {
+		models := gqlModels(entity)
+		if err := l.db.Where("id IN (?)", ids).Find(models).Error; err != nil {
+			return nil, err
+		}
+		cache := l.cache(entity)
+		for _, id := range ids {
+			cache[id] = nil
+		}
+		l.prime(entity, gqlList(models))
+		return cache, nil
+	})
+}
+
+// loadVisits returns thunk of visits by value of their field "user" or
+// "location"
+func (l *gqlLoader) loadVisits(field string, id int) func() (interface{}, error) {
+	return l.enqueue("visits of "+field, id, func(ids []int) (map[int]interface{}, error) {
+		var visits []Visit
+		if err := l.db.Where(field+" IN (?)", ids).Order("id").Find(&visits).Error; err != nil {
+			return nil, err
+		}
+		res := make(map[int]interface{})
+		for _, id := range ids {
+			res[id] = []interface{}{}
+		}
+		for _, v := range visits {
+			id := v.User
+			if field == "location" {
+				id = v.Location
+			}
+			res[id] = append(res[id].([]interface{}), v)
+		}
+		l.prime("visits", gqlList(visits))
+		return res, nil
+	})
+}
+
+// gqlModels returns pointer to slice of models of entity
+func gqlModels(entity string) interface{} {
+	switch entity {
+	case "users":
+		return &[]User{}
+	case "locations":
+		return &[]Location{}
+	default:
+		return &[]Visit{}
+	}
+}
+
+// gqlList converts slice or pointer to slice to list of field values
+func gqlList(slice interface{}) []interface{} {
+	v := reflect.Indirect(reflect.ValueOf(slice))
+	list := make([]interface{}, v.Len())
+	for i := range list {
+		list[i] = v.Index(i).Interface()
+	}
+	return list
+}
+
+// gqlEntityField resolves entity which parent model refers to by id
+func gqlEntityField(entity string, getID func(parent interface{}) int) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return getGqlContext(p).loader.load(entity, getID(p.Source)), nil
+	}
+}
+
+// gqlVisitsField resolves visits of parent users or locations
+func gqlVisitsField(field string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return getGqlContext(p).loader.loadVisits(field, getModelID(p.Source)), nil
+	}
+}
+
+var gqlPaginationArgs = graphql.FieldConfigArgument{
+	"limit":  {Type: graphql.Int},
+	"offset": {Type: graphql.Int},
+}
+
+func gqlArgs(args ...graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	res := make(graphql.FieldConfigArgument)
+	for _, a := range args {
+		for name, arg := range a {
+			res[name] = arg
+		}
+	}
+	return res
+}
+
+// gqlPaginate applies limit and offset arguments to query
+func gqlPaginate(query *gorm.DB, args map[string]interface{}) (*gorm.DB, error) {
+	limit, offset := DEFAULT_LIMIT, 0
+	if args["limit"] != nil {
+		limit = args["limit"].(int)
+	}
+	if args["offset"] != nil {
+		offset = args["offset"].(int)
+	}
+	if limit < 1 || limit > MAX_LIMIT || offset < 0 {
+		return nil, fmt.Errorf("limit must be from 1 to %d and offset must not be negative", MAX_LIMIT)
+	}
+	return query.Order("id").Limit(limit).Offset(offset), nil
+}
+
+// gqlEntityQuery resolves entity by id argument
+func gqlEntityQuery(typ *graphql.Object, entity string) *graphql.Field {
+	return &graphql.Field{
+		Type: typ,
+		Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.Int)}},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return getGqlContext(p).loader.load(entity, p.Args["id"].(int)), nil
+		},
+	}
+}
+
+// gqlListQuery resolves page of entities. Filters map arguments to conditions
+// of query, conditions are applied if arguments are set.
+func gqlListQuery(typ *graphql.Object, entity string, filters map[string]string, filterArgs graphql.FieldConfigArgument) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewList(typ),
+		Args: gqlArgs(filterArgs, gqlPaginationArgs),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			ctx := getGqlContext(p)
+			query, err := gqlPaginate(ctx.db, p.Args)
+			if err != nil {
+				return nil, err
+			}
+			for name, condition := range filters {
+				if value, ok := p.Args[name]; ok {
+					query = query.Where(condition, value)
+				}
+			}
+
+			models := gqlModels(entity)
+			if err := query.Find(models).Error; err != nil {
+				return nil, err
+			}
+			list := gqlList(models)
+			ctx.loader.prime(entity, list)
+			return list, nil
+		},
+	}
+}
+
+// gqlDateArg returns date argument as string, like dates of query string
+func gqlDateArg(args map[string]interface{}, name string) string {
+	if date, ok := args[name].(int); ok {
+		return strconv.Itoa(date)
+	}
+	return ""
+}
+
+// gqlIntArg returns int argument or defaultValue if it isn't set
+func gqlIntArg(args map[string]interface{}, name string, defaultValue int) int {
+	if value, ok := args[name].(int); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func gqlCreateMutation(typ *graphql.Object, input *graphql.InputObject, entity string) *graphql.Field {
+	return &graphql.Field{
+		Type: typ,
+		Args: graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(input)}},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			ctx := getGqlContext(p)
+			req, body, err := ctx.mutationRequest(http.MethodPost, "/{entity}/new", entity, p.Args)
+			if err != nil {
+				return nil, err
+			}
+			ctx.loader.flush()
+			model, errRes, _ := saveNewEntity(req, entity, body)
+			ctx.loader.reset()
+			if errRes != nil {
+				return nil, gqlResponseError(errRes)
+			}
+			return model, nil
+		},
+	}
+}
+
+func gqlUpdateMutation(typ *graphql.Object, input *graphql.InputObject, entity string) *graphql.Field {
+	return &graphql.Field{
+		Type: typ,
+		Args: graphql.FieldConfigArgument{
+			"id":      {Type: graphql.NewNonNull(graphql.Int)},
+			"input":   {Type: graphql.NewNonNull(input)},
+			"version": {Type: graphql.Int},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			ctx := getGqlContext(p)
+			req, body, err := ctx.mutationRequest(http.MethodPost, "/{entity}/{id}", entity, p.Args)
+			if err != nil {
+				return nil, err
+			}
+			id := strconv.Itoa(p.Args["id"].(int))
+			ctx.loader.flush()
+			res, _, statusCode := updateEntity(req, entity, id, body)
+			ctx.loader.reset()
+			if statusCode != 200 {
+				return nil, gqlResponseError(res)
+			}
+			model, _ := findOrUpdateEntity(ctx.db, entity, id, GET)
+			return model, nil
+		},
+	}
+}
+
+func gqlDeleteMutation(entity string) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.Boolean,
+		Args: graphql.FieldConfigArgument{
+			"id":      {Type: graphql.NewNonNull(graphql.Int)},
+			"version": {Type: graphql.Int},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			ctx := getGqlContext(p)
+			req, _, err := ctx.mutationRequest(http.MethodDelete, "/{entity}/{id}", entity, p.Args)
+			if err != nil {
+				return nil, err
+			}
+			ctx.loader.flush()
+			res, statusCode := deleteEntity(req, entity, strconv.Itoa(p.Args["id"].(int)))
+			ctx.loader.reset()
+			if statusCode != 200 {
+				return nil, gqlResponseError(res)
+			}
+			return true, nil
+		},
+	}
+}
+
+// gqlInput returns input type of entity with fields of types
+func gqlInput(name string, fields map[string]graphql.Input) *graphql.InputObject {
+	config := make(graphql.InputObjectConfigFieldMap)
+	for field, typ := range fields {
+		config[field] = &graphql.InputObjectFieldConfig{Type: typ}
+	}
+	return graphql.NewInputObject(graphql.InputObjectConfig{Name: name, Fields: config})
+}
+
+// newGqlSchema returns GraphQL schema of API. Field names are the same as JSON
+// fields of models, except that ids of visit's user and location are resolved
+// to objects.
+func newGqlSchema() graphql.Schema {
+	var userType, locationType, visitType *graphql.Object
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":         {Type: graphql.Int},
+				"email":      {Type: graphql.String},
+				"first_name": {Type: graphql.String},
+				"last_name":  {Type: graphql.String},
+				"gender":     {Type: graphql.String},
+				"birth_date": {Type: graphql.Int},
+				"version":    {Type: graphql.Int},
+				"visits":     {Type: graphql.NewList(visitType), Resolve: gqlVisitsField("user")},
+			}
+		}),
+	})
+	locationType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Location",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":       {Type: graphql.Int},
+				"place":    {Type: graphql.String},
+				"country":  {Type: graphql.String},
+				"city":     {Type: graphql.String},
+				"distance": {Type: graphql.Int},
+				"version":  {Type: graphql.Int},
+				"visits":   {Type: graphql.NewList(visitType), Resolve: gqlVisitsField("location")},
+			}
+		}),
+	})
+	visitType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Visit",
+		Fields: graphql.Fields{
+			"id":         {Type: graphql.Int},
+			"location":   {Type: locationType, Resolve: gqlEntityField("locations", func(p interface{}) int { return p.(Visit).Location })},
+			"user":       {Type: userType, Resolve: gqlEntityField("users", func(p interface{}) int { return p.(Visit).User })},
+			"visited_at": {Type: graphql.String},
+			"mark":       {Type: graphql.Int},
+			"version":    {Type: graphql.Int},
+		},
+	})
+
+	userInput := gqlInput("UserInput", map[string]graphql.Input{
+		"id": graphql.Int, "email": graphql.String, "first_name": graphql.String, "last_name": graphql.String,
+		"gender": graphql.String, "birth_date": graphql.Int,
+	})
+	locationInput := gqlInput("LocationInput", map[string]graphql.Input{
+		"id": graphql.Int, "place": graphql.String, "country": graphql.String, "city": graphql.String, "distance": graphql.Int,
+	})
+	visitInput := gqlInput("VisitInput", map[string]graphql.Input{
+		"id": graphql.Int, "location": graphql.Int, "user": graphql.Int, "visited_at": graphql.String, "mark": graphql.Int,
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user":     gqlEntityQuery(userType, "users"),
+			"location": gqlEntityQuery(locationType, "locations"),
+			"visit":    gqlEntityQuery(visitType, "visits"),
+			"users": gqlListQuery(userType, "users",
+				map[string]string{"gender": "gender = ?", "fromBirthDate": "birth_date > ?", "toBirthDate": "birth_date < ?"},
+				graphql.FieldConfigArgument{"gender": {Type: graphql.String}, "fromBirthDate": {Type: graphql.Int}, "toBirthDate": {Type: graphql.Int}}),
+			"locations": gqlListQuery(locationType, "locations",
+				map[string]string{"country": "country = ?", "city": "city = ?", "toDistance": "distance < ?"},
+				graphql.FieldConfigArgument{"country": {Type: graphql.String}, "city": {Type: graphql.String}, "toDistance": {Type: graphql.Int}}),
+			"visits": gqlListQuery(visitType, "visits",
+				map[string]string{"user": "user = ?", "location": "location = ?", "fromDate": "visited_at > ?", "toDate": "visited_at < ?"},
+				graphql.FieldConfigArgument{"user": {Type: graphql.Int}, "location": {Type: graphql.Int}, "fromDate": {Type: graphql.Int}, "toDate": {Type: graphql.Int}}),
+			"userVisits": {
+				Type: graphql.NewList(visitType),
+				Args: graphql.FieldConfigArgument{
+					"id":         {Type: graphql.NewNonNull(graphql.Int)},
+					"fromDate":   {Type: graphql.Int},
+					"toDate":     {Type: graphql.Int},
+					"country":    {Type: graphql.String},
+					"toDistance": {Type: graphql.Int},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					ctx := getGqlContext(p)
+					id := strconv.Itoa(p.Args["id"].(int))
+					if res, statusCode := findOrUpdateEntity(ctx.db, "users", id, GET); statusCode != 200 {
+						return nil, gqlResponseError(res)
+					}
+					country, _ := p.Args["country"].(string)
+					f := visitsFilter{
+						fromDate:   gqlDateArg(p.Args, "fromDate"),
+						toDate:     gqlDateArg(p.Args, "toDate"),
+						country:    country,
+						toDistance: gqlIntArg(p.Args, "toDistance", -1),
+					}
+					list := gqlList(filterUserVisits(ctx.db, id, f))
+					ctx.loader.prime("visits", list)
+					return list, nil
+				},
+			},
+			"locationAvg": {
+				Type: graphql.Float,
+				Args: graphql.FieldConfigArgument{
+					"id":       {Type: graphql.NewNonNull(graphql.Int)},
+					"fromDate": {Type: graphql.Int},
+					"toDate":   {Type: graphql.Int},
+					"fromAge":  {Type: graphql.Int},
+					"toAge":    {Type: graphql.Int},
+					"gender":   {Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					gender, _ := p.Args["gender"].(string)
+					f := avgFilter{
+						fromDate: gqlDateArg(p.Args, "fromDate"),
+						toDate:   gqlDateArg(p.Args, "toDate"),
+						fromAge:  gqlIntArg(p.Args, "fromAge", -1),
+						toAge:    gqlIntArg(p.Args, "toAge", -1),
+						gender:   gender,
+					}
+					avg, errRes, statusCode := getLocationAvg(getGqlContext(p).db, strconv.Itoa(p.Args["id"].(int)), f)
+					if statusCode != 200 {
+						return nil, gqlResponseError(errRes)
+					}
+					return avg, nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser":     gqlCreateMutation(userType, userInput, "users"),
+			"createLocation": gqlCreateMutation(locationType, locationInput, "locations"),
+			"createVisit":    gqlCreateMutation(visitType, visitInput, "visits"),
+			"updateUser":     gqlUpdateMutation(userType, userInput, "users"),
+			"updateLocation": gqlUpdateMutation(locationType, locationInput, "locations"),
+			"updateVisit":    gqlUpdateMutation(visitType, visitInput, "visits"),
+			"deleteUser":     gqlDeleteMutation("users"),
+			"deleteLocation": gqlDeleteMutation("locations"),
+			"deleteVisit":    gqlDeleteMutation("visits"),
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+	check(err)
+	return schema
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func executeGraphQLRequest(t *testing.T, apiKey string, query string, variables map[string]interface{}) gqlTestResponse {
+	body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	req, _ := http.NewRequest("POST", "/graphql", bytes.NewReader(body))
+	if apiKey != "" {
+		req.Header.Set(API_KEY_HEADER, apiKey)
+	}
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var res gqlTestResponse
+	json.Unmarshal(response.Body.Bytes(), &res)
+	return res
+}
+
+// gqlTestResponse keeps data as is to compare it with expected JSON
+type gqlTestResponse struct {
+	Data   json.RawMessage
+	Errors []struct {
+		Message string
+	}
+}
+
+// getGraphQLError returns the first line of the first error, syntax errors
+// have source of document in next lines
+func getGraphQLError(res gqlTestResponse) string {
+	if len(res.Errors) == 0 {
+		return ""
+	}
+	return strings.SplitN(res.Errors[0].Message, "\n", 2)[0]
+}
+
+// checkGraphQLData compares data with expected JSON, fields of objects are
+// ordered by name in responses
+func checkGraphQLData(t *testing.T, expected string, data json.RawMessage) {
+	var expectedValue, value interface{}
+	json.Unmarshal([]byte(expected), &expectedValue)
+	json.Unmarshal(data, &value)
+	if !reflect.DeepEqual(expectedValue, value) {
+		t.Errorf("Expected %s. Got %s", expected, data)
+	}
+}
+
+func createGraphQLTestData(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/users/new", `{"id": 2, "email": "b@mail.com", "first_name": "B", "last_name": "B", "gender": "f", "birth_date": 631152000}`)
+	postJSON(t, "/users/new", `{"id": 3, "email": "c@mail.com", "first_name": "C", "last_name": "C", "gender": "f", "birth_date": 631152000}`)
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Place 1", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/locations/new", `{"id": 2, "place": "Place 2", "country": "France", "city": "Paris", "distance": 20}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+	postJSON(t, "/visits/new", `{"id": 2, "location": 2, "user": 1, "visited_at": "1500000001", "mark": 2}`)
+	postJSON(t, "/visits/new", `{"id": 3, "location": 1, "user": 2, "visited_at": "1500000002", "mark": 3}`)
+	postJSON(t, "/visits/new", `{"id": 4, "location": 2, "user": 3, "visited_at": "1500000003", "mark": 4}`)
+}
+
+func TestGraphQLNestedQuery(t *testing.T) {
+	createGraphQLTestData(t)
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	res := executeGraphQLRequest(t, testApiKey, `
+		query Users($gender: String) {
+			users(gender: $gender, limit: 10) {
+				id
+				...names
+				visits { mark place: location { place } }
+			}
+		}
+		fragment names on User { first_name last_name }`, map[string]interface{}{"gender": "f"})
+	if err := getGraphQLError(res); err != "" {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	expected := `{"users":[` +
+		`{"id":2,"first_name":"B","last_name":"B","visits":[{"mark":3,"place":{"place":"Place 1"}}]},` +
+		`{"id":3,"first_name":"C","last_name":"C","visits":[{"mark":4,"place":{"place":"Place 2"}}]}]}`
+	checkGraphQLData(t, expected, res.Data)
+
+	// nested fields are loaded with one query for all parents
+	queries := map[string]int{}
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["module"] == "gorm" {
+			for _, table := range []string{"users", "visits", "locations"} {
+				if strings.HasPrefix(entry.Message, `SELECT * FROM "`+table+`"`) {
+					queries[table]++
+				}
+			}
+		}
+	}
+	if queries["users"] != 1 || queries["visits"] != 1 || queries["locations"] != 1 {
+		t.Errorf("Expected one query per table. Got %v", queries)
+	}
+}
+
+func TestGraphQLQueries(t *testing.T) {
+	createGraphQLTestData(t)
+
+	res := executeGraphQLRequest(t, testApiKey, `{
+		user(id: 1) { email }
+		missing: user(id: 99) { email }
+		visit(id: 3) { __typename user { id } }
+		locations(country: "France") { id }
+		visits(location: 1, fromDate: 1500000001) { id }
+		userVisits(id: 1, country: "Russia") { id mark }
+		locationAvg(id: 1, gender: "m")
+	}`, nil)
+	expected := `{"user":{"email":"a@mail.com"},"missing":null,"visit":{"__typename":"Visit","user":{"id":2}},` +
+		`"locations":[{"id":2}],"visits":[{"id":3}],"userVisits":[{"id":1,"mark":5}],"locationAvg":5}`
+	checkGraphQLData(t, expected, res.Data)
+
+	for query, expectedErr := range map[string]string{
+		`{ users { password } }`:                            `Cannot query field "password" on type "User".`,
+		`{ user { id } }`:                                   `Field "user" argument "id" of type "Int!" is required but not provided.`,
+		`{ user(id: 1) }`:                                   `Field "user" of type "User" must have a sub selection.`,
+		`{ users(limit: 1000) { id } }`:                     `limit must be from 1 to 100 and offset must not be negative`,
+		`{ locationAvg(id: 99) }`:                           `Location not found`,
+		`{ userVisits(id: 99) { id } }`:                     `Entity not found`,
+		`{ user(id: 1) { id `:                               `Syntax Error GraphQL request (1:20) Expected Name, found EOF`,
+		`query A { users { id } } query B { users { id } }`: `Must provide operation name if query contains multiple operations.`,
+		`{ user(id: $id) { id } }`:                          `Variable "$id" is not defined.`,
+	} {
+		if err := getGraphQLError(executeGraphQLRequest(t, testApiKey, query, nil)); err != expectedErr {
+			t.Errorf("Expected error %q for %s. Got %q", expectedErr, query, err)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/graphql?query="+url.QueryEscape(`{ user(id: 2) { first_name } }`), nil)
+	response := executeRequest(req)
+	if body := response.Body.String(); body != `{"data":{"user":{"first_name":"B"}}}`+"\n" {
+		t.Errorf("Unexpected response of GET request %s", body)
+	}
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	createGraphQLTestData(t)
+
+	res := executeGraphQLRequest(t, testApiKey, `mutation Create($input: VisitInput!) {
+		createVisit(input: $input) { id version user { id } }
+		updateLocation(id: 1, input: {distance: 15}, version: 1) { distance version }
+		deleteUser(id: 3)
+	}`, map[string]interface{}{"input": map[string]interface{}{"id": 5, "location": 1, "user": 2, "visited_at": "1500000004", "mark": 5}})
+	expected := `{"createVisit":{"id":5,"version":1,"user":{"id":2}},"updateLocation":{"distance":15,"version":2},"deleteUser":true}`
+	checkGraphQLData(t, expected, res.Data)
+
+	// mutations are validated, aggregated and audited by handlers of REST API
+	checkAllLocationMarks(t)
+	var audit AuditRecord
+	db.Where("entity = ? AND entity_id = ?", "visits", 5).First(&audit)
+	if audit.Operation != OPERATION_CREATE || audit.Actor != "api_key:tests" {
+		t.Errorf("Expected created visit to be audited. Got %+v", audit)
+	}
+	for query, expectedErr := range map[string]string{
+		`mutation { updateLocation(id: 1, input: {distance: 1}, version: 1) { id } }`: "Entity was modified",
+		`mutation { createUser(input: {id: 4}) { id } }`:                              "Bad request body parameters",
+	} {
+		if err := getGraphQLError(executeGraphQLRequest(t, testApiKey, query, nil)); err != expectedErr {
+			t.Errorf("Expected error %q for %s. Got %q", expectedErr, query, err)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/graphql?query="+url.QueryEscape(`mutation { deleteUser(id: 1) }`), nil)
+	response := executeRequest(req)
+	if body := response.Body.String(); body != `{"data":null,"errors":[{"message":"Mutations are allowed only in POST requests","locations":[]}]}`+"\n" {
+		t.Errorf("Expected mutation in GET request to fail. Got %s", body)
+	}
+
+	// readers may query, but their mutations are denied by access rules of REST API
+	readerKey, _, _ := CreateApiKey("reader", ROLE_READER, 0)
+	res = executeGraphQLRequest(t, readerKey, `mutation { deleteUser(id: 1) }`, nil)
+	if err := getGraphQLError(res); err != "Access denied" {
+		t.Errorf("Expected reader mutation to be denied. Got %q", err)
+	}
+	res = executeGraphQLRequest(t, readerKey, `{ user(id: 1) { id } }`, nil)
+	if err := getGraphQLError(res); err != "" {
+		t.Errorf("Expected reader query to succeed. Got %q", err)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	createGraphQLTestData(t)
+
+	// depth 11: user, 4 pairs of visits and user, visits and id
+	deep := `{ user(id: 1) {` + strings.Repeat(` visits { user {`, 4) + ` visits { id } ` + strings.Repeat(`} }`, 4) + ` } }`
+	var bomb strings.Builder
+	bomb.WriteString(`{ user(id: 1) { ...F20 } } fragment F0 on User { id }`)
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&bomb, ` fragment F%d on User { ...F%d ...F%d }`, i, i-1, i-1)
+	}
+	for query, expectedErr := range map[string]string{
+		`{ user(id: 1) { ...A } } fragment A on User { visits { user { ...A } } }`:                             `Cannot spread fragment "A" within itself.`,
+		`{ user(id: 1) { ...A } } fragment A on User { ...B } fragment B on User { visits { user { ...A } } }`: `Cannot spread fragment "A" within itself via B.`,
+		`{ user(id: 1) { ...A } }`:  `Unknown fragment "A".`,
+		deep:                        `Query depth is more than 10`,
+		bomb.String():               `Query has more than 500 fields`,
+		strings.Repeat(`{ a `, 100): `Syntax Error GraphQL request (1:257) Document is nested deeper than 64 levels.`,
+	} {
+		if err := getGraphQLError(executeGraphQLRequest(t, testApiKey, query, nil)); err != expectedErr {
+			t.Errorf("Expected error %q for %.80s. Got %q", expectedErr, query, err)
+		}
+	}
+
+	// fragments at depth 10 are allowed
+	res := executeGraphQLRequest(t, testApiKey, `{ user(id: 1) { ...V } } fragment V on User {`+
+		strings.Repeat(` visits { user {`, 4)+` id `+strings.Repeat(`} }`, 4)+` }`, nil)
+	if err := getGraphQLError(res); err != "" {
+		t.Errorf("Expected query of depth 10 to be executed. Got %q", err)
+	}
+}
+
+func TestGraphQLIntrospection(t *testing.T) {
+	res := executeGraphQLRequest(t, testApiKey, `{
+		__schema { queryType { name } mutationType { name } }
+		__type(name: "User") { fields(includeDeprecated: true) { name type { kind ofType { name } } } }
+	}`, nil)
+	if err := getGraphQLError(res); err != "" {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	var data struct {
+		Schema struct {
+			QueryType    struct{ Name string }
+			MutationType struct{ Name string }
+		} `json:"__schema"`
+		Type struct {
+			Fields []struct {
+				Name string
+				Type struct {
+					Kind   string
+					OfType struct{ Name string }
+				}
+			}
+		} `json:"__type"`
+	}
+	json.Unmarshal(res.Data, &data)
+	if data.Schema.QueryType.Name != "Query" || data.Schema.MutationType.Name != "Mutation" {
+		t.Errorf("Expected Query and Mutation root types. Got %s", res.Data)
+	}
+	visits := false
+	for _, field := range data.Type.Fields {
+		visits = visits || (field.Name == "visits" && field.Type.Kind == "LIST" && field.Type.OfType.Name == "Visit")
+	}
+	if !visits {
+		t.Errorf("Expected User type to have visits field. Got %s", res.Data)
+	}
+
+	// type references of introspection query of GraphiQL are deeper than
+	// GRAPHQL_MAX_DEPTH
+	res = executeGraphQLRequest(t, testApiKey, `{ __schema { types { name fields { name type { ...TypeRef } } } } }
+		fragment TypeRef on __Type { kind name`+strings.Repeat(` ofType { kind name`, 7)+strings.Repeat(` }`, 7)+` }`, nil)
+	if err := getGraphQLError(res); err != "" {
+		t.Errorf("Expected introspection query to be executed. Got %q", err)
+	}
+}
+
+func TestGraphQLMutationIsOneRequest(t *testing.T) {
+	createGraphQLTestData(t)
+	RATE_LIMIT_WRITES, RATE_LIMIT_EXPENSIVE = 1, 1
+	rateLimiter = newMemoryRateLimiter()
+	defer func() {
+		RATE_LIMIT_WRITES, RATE_LIMIT_EXPENSIVE = 0, 0
+	}()
+
+	// mutations are executed by handlers directly, they aren't limited as
+	// REST requests
+	res := executeGraphQLRequest(t, testApiKey, `mutation {
+		a: createLocation(input: {id: 3, place: "Place 3", country: "Spain", city: "Madrid", distance: 30}) { id }
+		b: createLocation(input: {id: 4, place: "Place 4", country: "Spain", city: "Madrid", distance: 40}) { id }
+	}`, nil)
+	if err := getGraphQLError(res); err != "" {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	checkGraphQLData(t, `{"a":{"id":3},"b":{"id":4}}`, res.Data)
+
+	body, _ := json.Marshal(map[string]interface{}{"query": `{ locations { id } }`})
+	req, _ := http.NewRequest("POST", "/graphql", bytes.NewReader(body))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusTooManyRequests, response.Code)
+}
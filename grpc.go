@@ -0,0 +1,504 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"rest_app/client"
+	"rest_app/models"
+	"rest_app/pb"
+)
+
+// number of entities read from database at once by streaming methods
+const GRPC_STREAM_BATCH_SIZE = 500
+
+// grpcServer serves gRPC calls with API client of REST handlers, so they're
+// validated, authorized and audited the same way as REST requests. Streaming
+// methods read database directly in batches.
+type grpcServer struct {
+	pb.UnimplementedRestAppServer
+	client     *client.Client
+	httpClient *http.Client
+}
+
+// grpcTransport serves REST requests of gRPC calls in process. Principal and
+// request id are in context of call.
+type grpcTransport struct {
+	handler http.Handler
+}
+
+func (t *grpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.RequestURI = req.URL.RequestURI()
+	if p, ok := peer.FromContext(req.Context()); ok {
+		req.RemoteAddr = p.Addr.String()
+	}
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+func newGrpcServer(router http.Handler) *grpc.Server {
+	s := grpc.NewServer(grpc.UnaryInterceptor(grpcUnaryInterceptor), grpc.StreamInterceptor(grpcStreamInterceptor))
+	httpClient := &http.Client{Transport: &grpcTransport{handler: router}}
+	pb.RegisterRestAppServer(s, &grpcServer{client: client.New("http://localhost", client.WithHTTPClient(httpClient), client.WithRetries(0, 0)), httpClient: httpClient})
+	reflection.Register(s)
+	return s
+}
+
+// serveGrpc serves gRPC API on GRPC_ADDR until server is stopped
+func serveGrpc(s *grpc.Server) error {
+	listener, err := net.Listen("tcp", GRPC_ADDR)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := s.Serve(listener); err != nil {
+			log.WithFields(log.Fields{"module": "grpc"}).Error(err)
+		}
+	}()
+	return nil
+}
+
+// stopGrpcServer waits for calls in progress for SHUTDOWN_TIMEOUT_SECONDS
+func stopGrpcServer(s *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Duration(SHUTDOWN_TIMEOUT_SECONDS) * time.Second):
+		s.Stop()
+	}
+}
+
+// grpcCodes are codes of gRPC errors by HTTP status codes of REST handlers
+var grpcCodes = map[int]codes.Code{
+	400: codes.InvalidArgument,
+	401: codes.Unauthenticated,
+	403: codes.PermissionDenied,
+	404: codes.NotFound,
+	409: codes.Aborted,
+	412: codes.FailedPrecondition,
+	413: codes.InvalidArgument,
+	415: codes.InvalidArgument,
+	422: codes.InvalidArgument,
+	428: codes.FailedPrecondition,
+	429: codes.ResourceExhausted,
+	503: codes.Unavailable,
+}
+
+// delete sends REST delete request of entity, non-zero version is sent in
+// If-Match header
+func (s *grpcServer) delete(ctx context.Context, entity string, req *pb.DeleteRequest) error {
+	httpReq, err := http.NewRequest(http.MethodDelete, "http://localhost/"+entity+"/"+strconv.Itoa(int(req.Id)), nil)
+	if err != nil {
+		return err
+	}
+	if req.Version != 0 {
+		httpReq.Header.Set("If-Match", `"`+strconv.Itoa(int(req.Version))+`"`)
+	}
+	res, err := s.httpClient.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		var errRes struct{ Error string }
+		json.NewDecoder(res.Body).Decode(&errRes)
+		return &client.Error{StatusCode: res.StatusCode, Message: errRes.Error}
+	}
+	return nil
+}
+
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	apiErr, ok := err.(*client.Error)
+	if !ok {
+		return status.Error(codes.Internal, err.Error())
+	}
+	code, ok := grpcCodes[apiErr.StatusCode]
+	if !ok {
+		code = codes.Internal
+	}
+	return status.Error(code, apiErr.Message)
+}
+
+// isPublicGrpcMethod checks if method is served without authentication
+func isPublicGrpcMethod(method string) bool {
+	return strings.HasPrefix(method, "/grpc.reflection.")
+}
+
+// newGrpcHTTPRequest returns HTTP request with credentials and peer address of
+// call, which is used to authenticate and rate limit the call like REST requests
+func newGrpcHTTPRequest(ctx context.Context, method string) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, method, nil)
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, name := range []string{API_KEY_HEADER, "Authorization"} {
+		if values := md.Get(name); len(values) != 0 {
+			req.Header.Set(name, values[0])
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		req.RemoteAddr = p.Addr.String()
+	}
+	return req.WithContext(ctx)
+}
+
+// grpcContext authenticates call and returns its context with principal and
+// request id, which is taken from "x-request-id" metadata or generated
+func grpcContext(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	requestID := ""
+	if values := md.Get(REQUEST_ID_HEADER); len(values) != 0 {
+		requestID = values[0]
+	}
+	if !isValidRequestID(requestID) {
+		requestID = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(REQUEST_ID_HEADER, requestID))
+	ctx = context.WithValue(ctx, requestIDContextKey, requestID)
+	if isPublicGrpcMethod(method) {
+		return ctx, nil
+	}
+
+	// REST requests of unary calls aren't limited by IP address again
+	req := newGrpcHTTPRequest(ctx, method)
+	if !takeIPRateLimit(req).Allowed {
+		return ctx, status.Error(codes.ResourceExhausted, "Too many requests")
+	}
+	ctx = context.WithValue(ctx, ipRateLimitedContextKey, true)
+
+	principal, err := authenticate(req)
+	if err != nil {
+		authErr := err.(*authError)
+		return ctx, status.Error(grpcCodes[authErr.statusCode], authErr.message)
+	}
+	return context.WithValue(ctx, principalContextKey, principal), nil
+}
+
+func logGrpcCall(ctx context.Context, method string, start time.Time, err error) {
+	fields := log.Fields{
+		"module":      "grpc",
+		"request_id":  ctx.Value(requestIDContextKey),
+		"method":      method,
+		"code":        status.Code(err).String(),
+		"duration_ms": time.Since(start).Seconds() * 1000,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields["peer"] = p.Addr.String()
+	}
+	if p, ok := ctx.Value(principalContextKey).(*Principal); ok {
+		fields["principal"] = p.Type + ":" + p.Subject
+	}
+	log.WithFields(fields).Info("Call")
+}
+
+func grpcUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx, err := grpcContext(ctx, info.FullMethod)
+	var res interface{}
+	if err == nil {
+		res, err = handler(ctx, req)
+	}
+	logGrpcCall(ctx, info.FullMethod, start, err)
+	return res, err
+}
+
+// grpcContextStream replaces context of stream
+type grpcContextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcContextStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcStreamInterceptor authenticates streaming calls. Streaming methods of
+// the API read database directly, so they're authorized here like reads of
+// all entities and are limited like expensive REST requests.
+func grpcStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, err := grpcContext(ss.Context(), info.FullMethod)
+	if err == nil && !isPublicGrpcMethod(info.FullMethod) {
+		err = authorizeGrpcStream(ctx, info.FullMethod)
+	}
+	if err == nil {
+		err = handler(srv, &grpcContextStream{ServerStream: ss, ctx: ctx})
+	}
+	logGrpcCall(ctx, info.FullMethod, start, err)
+	return err
+}
+
+func authorizeGrpcStream(ctx context.Context, method string) error {
+	p := ctx.Value(principalContextKey).(*Principal)
+	allowed := false
+	for _, role := range readRoles {
+		allowed = allowed || p.Role == role
+	}
+	if !allowed {
+		log.WithFields(log.Fields{"module": "audit", "event": "access_denied", "method": "gRPC", "uri": method,
+			"principal_type": p.Type, "principal": p.Subject, "role": p.Role}).Warn("Access denied")
+		recordAccessDenied(newGrpcHTTPRequest(ctx, method), "gRPC")
+		return status.Error(codes.PermissionDenied, "Access denied")
+	}
+
+	if RATE_LIMIT_EXPENSIVE > 0 {
+		res := rateLimiter.Take("expensive:"+getRateLimitClient(newGrpcHTTPRequest(ctx, method)), RATE_LIMIT_EXPENSIVE)
+		if !res.Allowed {
+			return status.Error(codes.ResourceExhausted, "Too many requests")
+		}
+	}
+	return nil
+}
+
+// streamEntities sends all entities ordered by id, they're read in batches so
+// large tables aren't loaded into memory
+func streamEntities(ctx context.Context, newModels func() interface{}, send func(model interface{}) error) error {
+	db := InitDb()
+	defer db.Close()
+
+	lastID := 0
+	for {
+		models := newModels()
+		if err := db.Where("id > ?", lastID).Order("id").Limit(GRPC_STREAM_BATCH_SIZE).Find(models).Error; err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		batch := reflect.ValueOf(models).Elem()
+		for i := 0; i < batch.Len(); i++ {
+			model := batch.Index(i).Interface()
+			if err := send(model); err != nil {
+				return err
+			}
+			lastID = getModelID(model)
+		}
+		if batch.Len() < GRPC_STREAM_BATCH_SIZE {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+	}
+}
+
+func userToPb(u *models.User) *pb.User {
+	return &pb.User{Id: int32(u.ID), Email: u.Email, FirstName: u.FirstName, LastName: u.LastName,
+		Gender: u.Gender, BirthDate: int64(u.BirthDate), Version: int32(u.Version)}
+}
+
+func locationToPb(l *models.Location) *pb.Location {
+	return &pb.Location{Id: int32(l.ID), Place: l.Place, Country: l.Country, City: l.City,
+		Distance: int32(l.Distance), Version: int32(l.Version)}
+}
+
+func visitToPb(v *models.Visit) *pb.Visit {
+	return &pb.Visit{Id: int32(v.ID), Location: int32(v.Location), User: int32(v.User),
+		VisitedAt: v.VisitedAt, Mark: int32(v.Mark), Version: int32(v.Version)}
+}
+
+func (s *grpcServer) GetUser(ctx context.Context, req *pb.GetRequest) (*pb.User, error) {
+	user, err := s.client.GetUser(ctx, int(req.Id))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return userToPb(user), nil
+}
+
+func (s *grpcServer) CreateUser(ctx context.Context, req *pb.User) (*pb.User, error) {
+	user, err := s.client.CreateUser(ctx, models.User{ID: int(req.Id), Email: req.Email, FirstName: req.FirstName,
+		LastName: req.LastName, Gender: req.Gender, BirthDate: int(req.BirthDate)})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return userToPb(user), nil
+}
+
+func (s *grpcServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.User, error) {
+	fields := client.Fields{}
+	if f := req.Fields; f != nil {
+		if f.Email != nil {
+			fields["email"] = *f.Email
+		}
+		if f.FirstName != nil {
+			fields["first_name"] = *f.FirstName
+		}
+		if f.LastName != nil {
+			fields["last_name"] = *f.LastName
+		}
+		if f.Gender != nil {
+			fields["gender"] = *f.Gender
+		}
+		if f.BirthDate != nil {
+			fields["birth_date"] = *f.BirthDate
+		}
+	}
+	if err := s.client.UpdateUser(ctx, int(req.Id), fields, int(req.Version)); err != nil {
+		return nil, grpcError(err)
+	}
+	return s.GetUser(ctx, &pb.GetRequest{Id: req.Id})
+}
+
+func (s *grpcServer) DeleteUser(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if err := s.delete(ctx, "users", req); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+func (s *grpcServer) ListUsers(req *pb.ListRequest, stream pb.RestApp_ListUsersServer) error {
+	return streamEntities(stream.Context(), func() interface{} { return &[]User{} }, func(model interface{}) error {
+		user := model.(User)
+		return stream.Send(userToPb(&user))
+	})
+}
+
+func (s *grpcServer) GetLocation(ctx context.Context, req *pb.GetRequest) (*pb.Location, error) {
+	location, err := s.client.GetLocation(ctx, int(req.Id))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return locationToPb(location), nil
+}
+
+func (s *grpcServer) CreateLocation(ctx context.Context, req *pb.Location) (*pb.Location, error) {
+	location, err := s.client.CreateLocation(ctx, models.Location{ID: int(req.Id), Place: req.Place, Country: req.Country,
+		City: req.City, Distance: int(req.Distance)})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return locationToPb(location), nil
+}
+
+func (s *grpcServer) UpdateLocation(ctx context.Context, req *pb.UpdateLocationRequest) (*pb.Location, error) {
+	fields := client.Fields{}
+	if f := req.Fields; f != nil {
+		if f.Place != nil {
+			fields["place"] = *f.Place
+		}
+		if f.Country != nil {
+			fields["country"] = *f.Country
+		}
+		if f.City != nil {
+			fields["city"] = *f.City
+		}
+		if f.Distance != nil {
+			fields["distance"] = *f.Distance
+		}
+	}
+	if err := s.client.UpdateLocation(ctx, int(req.Id), fields, int(req.Version)); err != nil {
+		return nil, grpcError(err)
+	}
+	return s.GetLocation(ctx, &pb.GetRequest{Id: req.Id})
+}
+
+func (s *grpcServer) DeleteLocation(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if err := s.delete(ctx, "locations", req); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+func (s *grpcServer) ListLocations(req *pb.ListRequest, stream pb.RestApp_ListLocationsServer) error {
+	return streamEntities(stream.Context(), func() interface{} { return &[]Location{} }, func(model interface{}) error {
+		location := model.(Location)
+		return stream.Send(locationToPb(&location))
+	})
+}
+
+func (s *grpcServer) GetVisit(ctx context.Context, req *pb.GetRequest) (*pb.Visit, error) {
+	visit, err := s.client.GetVisit(ctx, int(req.Id))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return visitToPb(visit), nil
+}
+
+func (s *grpcServer) CreateVisit(ctx context.Context, req *pb.Visit) (*pb.Visit, error) {
+	visit, err := s.client.CreateVisit(ctx, models.Visit{ID: int(req.Id), Location: int(req.Location), User: int(req.User),
+		VisitedAt: req.VisitedAt, Mark: int(req.Mark)})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return visitToPb(visit), nil
+}
+
+func (s *grpcServer) UpdateVisit(ctx context.Context, req *pb.UpdateVisitRequest) (*pb.Visit, error) {
+	fields := client.Fields{}
+	if f := req.Fields; f != nil {
+		if f.Location != nil {
+			fields["location"] = *f.Location
+		}
+		if f.User != nil {
+			fields["user"] = *f.User
+		}
+		if f.VisitedAt != nil {
+			fields["visited_at"] = *f.VisitedAt
+		}
+		if f.Mark != nil {
+			fields["mark"] = *f.Mark
+		}
+	}
+	if err := s.client.UpdateVisit(ctx, int(req.Id), fields, int(req.Version)); err != nil {
+		return nil, grpcError(err)
+	}
+	return s.GetVisit(ctx, &pb.GetRequest{Id: req.Id})
+}
+
+func (s *grpcServer) DeleteVisit(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if err := s.delete(ctx, "visits", req); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+func (s *grpcServer) ListVisits(req *pb.ListRequest, stream pb.RestApp_ListVisitsServer) error {
+	return streamEntities(stream.Context(), func() interface{} { return &[]Visit{} }, func(model interface{}) error {
+		visit := model.(Visit)
+		return stream.Send(visitToPb(&visit))
+	})
+}
+
+func (s *grpcServer) GetUserVisits(ctx context.Context, req *pb.UserVisitsRequest) (*pb.UserVisitsResponse, error) {
+	visits, err := s.client.UserVisits(ctx, int(req.Id), client.VisitsFilter{FromDate: int(req.FromDate), ToDate: int(req.ToDate),
+		Country: req.Country, ToDistance: int(req.ToDistance)})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	res := &pb.UserVisitsResponse{Visits: make([]*pb.Visit, len(visits))}
+	for i := range visits {
+		res.Visits[i] = visitToPb(&visits[i])
+	}
+	return res, nil
+}
+
+func (s *grpcServer) GetLocationAvg(ctx context.Context, req *pb.LocationAvgRequest) (*pb.LocationAvgResponse, error) {
+	avg, err := s.client.LocationAvg(ctx, int(req.Id), client.AvgFilter{FromDate: int(req.FromDate), ToDate: int(req.ToDate),
+		FromAge: int(req.FromAge), ToAge: int(req.ToAge), Gender: req.Gender})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.LocationAvgResponse{Avg: avg}, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"rest_app/pb"
+)
+
+func newTestGrpcClient(t *testing.T) (pb.RestAppClient, *grpc.ClientConn, func()) {
+	listener := bufconn.Listen(1 << 20)
+	server := newGrpcServer(SetupHandlers())
+	go server.Serve(listener)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pb.NewRestAppClient(conn), conn, func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func withTestApiKey() context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), API_KEY_HEADER, testApiKey)
+}
+
+func TestGrpc(t *testing.T) {
+	ClearDB()
+	c, _, stop := newTestGrpcClient(t)
+	defer stop()
+	ctx := withTestApiKey()
+
+	user, err := c.CreateUser(ctx, &pb.User{Id: 1, Email: "a@mail.com", FirstName: "A", LastName: "A", Gender: "m", BirthDate: 631152000})
+	if err != nil || user.Version != 1 {
+		t.Fatalf("Expected user to be created. Got %v, %v", user, err)
+	}
+	if _, err := c.CreateLocation(ctx, &pb.Location{Id: 1, Place: "Place", Country: "Russia", City: "Moscow", Distance: 10}); err != nil {
+		t.Fatalf("Expected location to be created. Got %v", err)
+	}
+	if _, err := c.CreateVisit(ctx, &pb.Visit{Id: 1, Location: 1, User: 1, VisitedAt: "1500000000", Mark: 4}); err != nil {
+		t.Fatalf("Expected visit to be created. Got %v", err)
+	}
+
+	user, err = c.UpdateUser(ctx, &pb.UpdateUserRequest{Id: 1, Fields: &pb.UserFields{FirstName: proto.String("B")}, Version: 1})
+	if err != nil || user.FirstName != "B" || user.LastName != "A" || user.Version != 2 {
+		t.Errorf("Expected first name to be updated. Got %v, %v", user, err)
+	}
+	_, err = c.UpdateUser(ctx, &pb.UpdateUserRequest{Id: 1, Fields: &pb.UserFields{FirstName: proto.String("C")}, Version: 1})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected update of old version to fail with FailedPrecondition. Got %v", err)
+	}
+	_, err = c.CreateUser(ctx, &pb.User{Id: 2})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected invalid user to fail with InvalidArgument. Got %v", err)
+	}
+
+	visits, err := c.GetUserVisits(ctx, &pb.UserVisitsRequest{Id: 1, Country: "Russia"})
+	if err != nil || len(visits.Visits) != 1 || visits.Visits[0].Mark != 4 {
+		t.Errorf("Expected one visit of user. Got %v, %v", visits, err)
+	}
+	avg, err := c.GetLocationAvg(ctx, &pb.LocationAvgRequest{Id: 1, Gender: "m"})
+	if err != nil || avg.Avg != 4 {
+		t.Errorf("Expected avg 4. Got %v, %v", avg, err)
+	}
+
+	_, err = c.DeleteVisit(ctx, &pb.DeleteRequest{Id: 1, Version: 2})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected delete of other version to fail with FailedPrecondition. Got %v", err)
+	}
+	if _, err := c.DeleteVisit(ctx, &pb.DeleteRequest{Id: 1, Version: 1}); err != nil {
+		t.Errorf("Expected visit to be deleted. Got %v", err)
+	}
+	_, err = c.GetVisit(ctx, &pb.GetRequest{Id: 1})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected deleted visit to be not found. Got %v", err)
+	}
+
+	// calls are audited like REST requests
+	var audit AuditRecord
+	db.Where("entity = ? AND entity_id = ?", "users", 1).Order("id desc").First(&audit)
+	if audit.Operation != OPERATION_UPDATE || audit.Actor != "api_key:tests" || audit.RequestID == "" {
+		t.Errorf("Expected updated user to be audited with request id. Got %+v", audit)
+	}
+}
+
+func TestGrpcContextErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if code := status.Code(grpcError(&url.Error{Op: "Get", URL: "/users/1", Err: ctx.Err()})); code != codes.Canceled {
+		t.Errorf("Expected code %v. Got %v", codes.Canceled, code)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if code := status.Code(grpcError(&url.Error{Op: "Get", URL: "/users/1", Err: ctx.Err()})); code != codes.DeadlineExceeded {
+		t.Errorf("Expected code %v. Got %v", codes.DeadlineExceeded, code)
+	}
+}
+
+func TestGrpcListStream(t *testing.T) {
+	ClearDB()
+	for i := 1; i <= GRPC_STREAM_BATCH_SIZE+5; i++ {
+		db.Create(&Location{ID: i, Place: "Place", Country: "Russia", City: "Moscow", Distance: i})
+	}
+	c, _, stop := newTestGrpcClient(t)
+	defer stop()
+
+	stream, err := c.ListLocations(withTestApiKey(), &pb.ListRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for {
+		location, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		count++
+		if int(location.Id) != count {
+			t.Fatalf("Expected location %d. Got %d", count, location.Id)
+		}
+	}
+	if count != GRPC_STREAM_BATCH_SIZE+5 {
+		t.Errorf("Expected %d locations. Got %d", GRPC_STREAM_BATCH_SIZE+5, count)
+	}
+}
+
+func TestGrpcAuthentication(t *testing.T) {
+	ClearDB()
+	c, conn, stop := newTestGrpcClient(t)
+	defer stop()
+
+	_, err := c.GetUser(context.Background(), &pb.GetRequest{Id: 1})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected call without credentials to fail with Unauthenticated. Got %v", err)
+	}
+	stream, _ := c.ListUsers(context.Background(), &pb.ListRequest{})
+	if _, err := stream.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected stream without credentials to fail with Unauthenticated. Got %v", err)
+	}
+
+	readerKey, _, _ := CreateApiKey("reader", ROLE_READER, 0)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), API_KEY_HEADER, readerKey)
+	_, err = c.DeleteUser(ctx, &pb.DeleteRequest{Id: 1})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected delete by reader to fail with PermissionDenied. Got %v", err)
+	}
+
+	noRoleKey, _, _ := CreateApiKey("no role", "", 0)
+	ctx = metadata.AppendToOutgoingContext(context.Background(), API_KEY_HEADER, noRoleKey)
+	stream, _ = c.ListUsers(ctx, &pb.ListRequest{})
+	if _, err := stream.Recv(); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected stream without role to fail with PermissionDenied. Got %v", err)
+	}
+	records := getAuditRecords(t, "/audit?operation=access_denied")
+	if n := len(records); n == 0 || records[n-1]["after"].(map[string]interface{})["uri"] != "/restapp.v1.RestApp/ListUsers" {
+		t.Errorf("Expected denied stream in audit log. Got %v", records)
+	}
+
+	// reflection is served without credentials
+	info, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.Send(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}})
+	res, err := info.Recv()
+	if err != nil {
+		t.Fatalf("Expected services to be listed. Got %v", err)
+	}
+	found := false
+	for _, service := range res.GetListServicesResponse().GetService() {
+		found = found || service.Name == "restapp.v1.RestApp"
+	}
+	if !found {
+		t.Errorf("Expected RestApp service to be listed. Got %v", res)
+	}
+}
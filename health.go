@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// Build info, set at link time:
+// go build -ldflags "-X main.BUILD_COMMIT=$(git rev-parse HEAD) -X main.BUILD_TIME=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	BUILD_COMMIT = "unknown"
+	BUILD_TIME   = "unknown"
+)
+
+// routes which are served without authentication
+var publicRoutes = map[string]bool{
+	"/healthz":      true,
+	"/readyz":       true,
+	"/version":      true,
+	"/openapi.json": true,
+	"/docs":         true,
+	"/docs/{file}":  true,
+}
+
+func isPublicRoute(r *http.Request) bool {
+	if route := mux.CurrentRoute(r); route != nil {
+		template, _ := route.GetPathTemplate()
+		return publicRoutes[template]
+	}
+	return false
+}
+
+// draining is set to 1 when server is shutting down, readiness check fails
+// then so that new requests are sent to other instances
+var draining int32
+
+func setDraining() {
+	atomic.StoreInt32(&draining, 1)
+}
+
+func isDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+func getHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// getReadiness checks that shared DB connection is alive, all migrations are
+// applied and server isn't draining
+func getReadiness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	checks := map[string]string{"database": "ok", "migrations": "ok", "draining": "no"}
+	ready := true
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	if err := getSqlDB().PingContext(ctx); err != nil {
+		checks["database"] = err.Error()
+		ready = false
+	} else {
+		db := InitRequestDb(r)
+		version, err := getSchemaVersion(db)
+		db.Close()
+		if err != nil {
+			checks["migrations"] = err.Error()
+			ready = false
+		} else if version != len(migrations) {
+			checks["migrations"] = "schema version " + strconv.Itoa(version) + " of " + strconv.Itoa(len(migrations))
+			ready = false
+		}
+	}
+	if isDraining() {
+		checks["draining"] = "yes"
+		ready = false
+	}
+
+	status := "ok"
+	if !ready {
+		status = "unavailable"
+		w.WriteHeader(503)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "checks": checks})
+}
+
+func getVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	db := InitRequestDb(r)
+	defer db.Close()
+	version, _ := getSchemaVersion(db)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"commit":         BUILD_COMMIT,
+		"build_time":     BUILD_TIME,
+		"schema_version": version,
+	})
+}
+
+// shutdownOnSignal drains and stops server on SIGTERM or SIGINT
+func shutdownOnSignal(server *http.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	<-signals
+
+	log.Info("Server is draining")
+	setDraining()
+	time.Sleep(time.Duration(SHUTDOWN_DRAIN_SECONDS) * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(SHUTDOWN_TIMEOUT_SECONDS)*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func executePublicRequest(method string, url string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	checkResponseCode(t, http.StatusOK, executePublicRequest("GET", "/healthz").Code)
+	checkResponseCode(t, http.StatusOK, executePublicRequest("GET", "/readyz").Code)
+
+	response := executePublicRequest("GET", "/version")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var version map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &version)
+	if version["commit"] != BUILD_COMMIT || version["schema_version"] != float64(len(migrations)) {
+		t.Errorf("Unexpected version %v", version)
+	}
+
+	setDraining()
+	defer func() { draining = 0 }()
+	response = executePublicRequest("GET", "/readyz")
+	checkResponseCode(t, http.StatusServiceUnavailable, response.Code)
+	var readiness struct {
+		Status string
+		Checks map[string]string
+	}
+	json.Unmarshal(response.Body.Bytes(), &readiness)
+	if readiness.Status != "unavailable" || readiness.Checks["draining"] != "yes" {
+		t.Errorf("Unexpected readiness response '%s'", response.Body.String())
+	}
+
+	// other routes still require authentication
+	checkResponseCode(t, http.StatusUnauthorized, executePublicRequest("GET", "/users").Code)
+}
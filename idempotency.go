@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const IDEMPOTENCY_KEY_HEADER = "Idempotency-Key"
+
+// IdempotencyRecord is a response to request with idempotency key. StatusCode
+// is 0 while the request is processed.
+type IdempotencyRecord struct {
+	Client      string `gorm:"primary_key"`
+	Key         string `gorm:"primary_key"`
+	Fingerprint string
+	StatusCode  int
+	Body        string
+	CreatedAt   int
+}
+
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_keys"
+}
+
+// getIdempotencyClient returns caller whose idempotency keys are separate
+// from keys of other callers
+func getIdempotencyClient(r *http.Request) string {
+	p := getPrincipal(r)
+	if p == nil {
+		return ""
+	}
+	if p.Type == "api_key" {
+		return "api_key:" + strconv.Itoa(p.ApiKeyID)
+	}
+	return p.Type + ":" + p.Subject
+}
+
+func getRequestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordingResponseWriter keeps copy of response status and body
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (w *recordingResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *recordingResponseWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func writeIdempotencyError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"Error": message})
+}
+
+// withIdempotencyKey stores response to request with Idempotency-Key header for
+// IDEMPOTENCY_KEY_TTL_HOURS and replays it to retries of the request. Key
+// reused with other request is rejected with 422. Server errors aren't stored,
+// so such requests can be retried.
+func withIdempotencyKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IDEMPOTENCY_KEY_HEADER)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 {
+			writeIdempotencyError(w, 400, "Idempotency key is too long")
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			res, statusCode := getBodyErrorResponse(err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		db := InitRequestDb(r)
+		defer db.Close()
+
+		now := time.Now()
+		expired := now.Add(-time.Duration(IDEMPOTENCY_KEY_TTL_HOURS) * time.Hour).Unix()
+		db.Where("created_at < ?", expired).Delete(IdempotencyRecord{})
+
+		record := IdempotencyRecord{
+			Client:      getIdempotencyClient(r),
+			Key:         key,
+			Fingerprint: getRequestFingerprint(r, body),
+			CreatedAt:   int(now.Unix()),
+		}
+		res := db.Exec("INSERT OR IGNORE INTO idempotency_keys (client, key, fingerprint, status_code, body, created_at) VALUES (?, ?, ?, 0, '', ?)",
+			record.Client, record.Key, record.Fingerprint, record.CreatedAt)
+		if res.Error != nil {
+			log.WithFields(log.Fields{"module": "idempotency"}).Error(res.Error)
+			writeIdempotencyError(w, 500, "Idempotency key can't be saved")
+			return
+		}
+
+		if res.RowsAffected == 0 {
+			var stored IdempotencyRecord
+			db.Where("client = ? AND key = ?", record.Client, record.Key).First(&stored)
+			switch {
+			case stored.Fingerprint != record.Fingerprint:
+				writeIdempotencyError(w, 422, "Idempotency key is already used for another request")
+			case stored.StatusCode == 0:
+				writeIdempotencyError(w, 409, "Request with the same idempotency key is in progress")
+			default:
+				recordCacheRequest("idempotency", true)
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.StatusCode)
+				w.Write([]byte(stored.Body))
+			}
+			return
+		}
+
+		recordCacheRequest("idempotency", false)
+		recorder := &recordingResponseWriter{ResponseWriter: w, statusCode: 200}
+		// reservation is removed if handler panics, otherwise retries would get
+		// 409 until the key expires
+		completed := false
+		defer func() {
+			if !completed {
+				if err := db.Delete(&record).Error; err != nil {
+					log.WithFields(log.Fields{"module": "idempotency"}).Error(err)
+				}
+			}
+		}()
+		next(recorder, r)
+		completed = true
+
+		if recorder.statusCode >= 500 {
+			err = db.Delete(&record).Error
+		} else {
+			err = db.Model(&record).Updates(map[string]interface{}{"status_code": recorder.statusCode, "body": recorder.body.String()}).Error
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"module": "idempotency"}).Error(err)
+		}
+	}
+}
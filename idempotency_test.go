@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func postWithIdempotencyKey(key string, payload string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/locations/new", bytes.NewBufferString(payload))
+	req.Header.Set(IDEMPOTENCY_KEY_HEADER, key)
+	return executeRequest(req)
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	ClearDB()
+	payload := `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`
+
+	first := postWithIdempotencyKey("key-1", payload)
+	checkResponseCode(t, http.StatusOK, first.Code)
+
+	replay := postWithIdempotencyKey("key-1", payload)
+	checkResponseCode(t, http.StatusOK, replay.Code)
+	if replay.Body.String() != first.Body.String() {
+		t.Errorf("Expected replayed body '%s'. Got '%s'", first.Body.String(), replay.Body.String())
+	}
+	if replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected Idempotent-Replayed header to be set")
+	}
+
+	var count int
+	db.Model(&Location{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 location. Got %d", count)
+	}
+
+	other := postWithIdempotencyKey("key-1", `{"id": 2, "place": "Hermitage", "country": "Russia", "city": "Saint Petersburg", "distance": 5}`)
+	checkResponseCode(t, http.StatusUnprocessableEntity, other.Code)
+
+	// failed requests can be retried with the same key
+	checkResponseCode(t, http.StatusInternalServerError, postWithIdempotencyKey("key-2", payload).Code)
+	db.Unscoped().Delete(Location{})
+	checkResponseCode(t, http.StatusOK, postWithIdempotencyKey("key-2", payload).Code)
+}
+
+func TestIdempotencyKeyOfPanickedRequest(t *testing.T) {
+	ClearDB()
+	handler := withIdempotencyKey(func(w http.ResponseWriter, r *http.Request) {
+		panic("Handler failed")
+	})
+	req := httptest.NewRequest("POST", "/users/new", bytes.NewBufferString("{}"))
+	req.Header.Set(IDEMPOTENCY_KEY_HEADER, "panicked")
+	func() {
+		defer func() { recover() }()
+		handler(httptest.NewRecorder(), req)
+	}()
+
+	// retry isn't rejected as request in progress
+	var count int
+	db.Model(&IdempotencyRecord{}).Where("key = ?", "panicked").Count(&count)
+	if count != 0 {
+		t.Errorf("Expected reservation of panicked request to be removed. Got %d records", count)
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// larger client messages close connection
+	LIVE_AVG_MAX_MESSAGE_SIZE = 4096
+	// message must be written in this time, otherwise client is too slow and
+	// connection is closed
+	LIVE_AVG_WRITE_TIMEOUT = 10 * time.Second
+	// connection is closed if client doesn't answer pings or send messages
+	LIVE_AVG_PING_INTERVAL = 30 * time.Second
+	LIVE_AVG_READ_TIMEOUT  = 2 * LIVE_AVG_PING_INTERVAL
+	// subprotocol of connections, credentials may be sent as other subprotocols
+	LIVE_AVG_PROTOCOL = "live-avg"
+)
+
+// liveAvgRequest is a message of client. Params are query string parameters
+// of /locations/<id>/avg.
+type liveAvgRequest struct {
+	Action   string            `json:"action"`
+	ID       string            `json:"id"`
+	Location int               `json:"location"`
+	Params   map[string]string `json:"params"`
+}
+
+// liveAvgMessage is a message of server, either avg or error
+type liveAvgMessage struct {
+	Type     string   `json:"type"`
+	ID       string   `json:"id,omitempty"`
+	Location int      `json:"location,omitempty"`
+	Avg      *float64 `json:"avg,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type liveAvgSubscription struct {
+	location int
+	filter   avgFilter
+	// last sent value, the same value isn't sent again. They're used only by
+	// writer of connection.
+	sent      bool
+	lastAvg   float64
+	lastError string
+}
+
+// liveAvgConn is WebSocket connection with subscriptions to averages of
+// locations. Changed locations are collected in dirty until writer recomputes
+// them, so slow clients get latest values instead of all of them.
+type liveAvgConn struct {
+	id     int64
+	client string
+
+	mu            sync.Mutex
+	ws            *websocket.Conn
+	subscriptions map[string]*liveAvgSubscription
+	dirty         map[int]bool
+	replies       []liveAvgMessage
+
+	notify chan struct{}
+	// closed when reader stops
+	closed chan struct{}
+}
+
+// liveAvgHub tracks connections and marks their locations changed by events
+type liveAvgHub struct {
+	mu      sync.Mutex
+	conns   map[*liveAvgConn]bool
+	clients map[string]int
+	started bool
+}
+
+var liveAvg = &liveAvgHub{conns: make(map[*liveAvgConn]bool), clients: make(map[string]int)}
+
+var liveAvgUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024, Subprotocols: []string{LIVE_AVG_PROTOCOL}}
+
+// last id of connections, ids key rate limits of connections
+var liveAvgConnID int64
+
+// register checks connection limits and returns error response and its status
+// code if connection isn't allowed
+func (h *liveAvgHub) register(c *liveAvgConn) (interface{}, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.conns) >= LIVE_AVG_MAX_CONNECTIONS {
+		return map[string]string{"Error": "Too many connections"}, 503
+	}
+	if h.clients[c.client] >= LIVE_AVG_MAX_CONNECTIONS_PER_CLIENT {
+		return map[string]string{"Error": "Too many connections"}, 429
+	}
+	if !h.started {
+		h.started = true
+		go h.run()
+	}
+	h.conns[c] = true
+	h.clients[c.client]++
+	return nil, 200
+}
+
+func (h *liveAvgHub) unregister(c *liveAvgConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.conns, c)
+	if h.clients[c.client]--; h.clients[c.client] == 0 {
+		delete(h.clients, c.client)
+	}
+}
+
+// markDirty marks locations changed in all connections, nil marks all
+// locations
+func (h *liveAvgHub) markDirty(locations []int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.conns {
+		c.markDirty(locations)
+	}
+}
+
+// closeAll closes connections on shutdown, server doesn't track them after
+// upgrade
+func (h *liveAvgHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.conns {
+		c.mu.Lock()
+		if c.ws != nil {
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server is shutting down")
+			c.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(LIVE_AVG_WRITE_TIMEOUT))
+			c.ws.Close()
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (h *liveAvgHub) run() {
+	subscription := events.subscribe("")
+	for {
+		e, ok := <-subscription.events
+		if !ok {
+			// events were missed, so all averages are recomputed
+			subscription = events.subscribe("")
+			h.markDirty(nil)
+			continue
+		}
+		h.markDirty(getEventLocations(e))
+	}
+}
+
+// getEventLocations returns locations whose averages may be changed by event
+func getEventLocations(e Event) []int {
+	switch e.Entity {
+	case "locations":
+		return []int{e.EntityID}
+	case "visits":
+		var after, before Visit
+		json.Unmarshal(e.Data, &after)
+		locations := []int{after.Location}
+		// visit may be moved to another location
+		if e.before != nil {
+			json.Unmarshal(e.before, &before)
+			if before.Location != after.Location {
+				locations = append(locations, before.Location)
+			}
+		}
+		return locations
+	case "users":
+		db := InitDb()
+		defer db.Close()
+
+		var locations []int
+		if err := db.Model(&Visit{}).Where("user = ?", e.EntityID).Pluck("DISTINCT location", &locations).Error; err != nil {
+			log.WithFields(log.Fields{"module": "live_avg"}).Error(err)
+		}
+		return locations
+	}
+	return []int{}
+}
+
+func (c *liveAvgConn) markDirty(locations []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := false
+	for _, s := range c.subscriptions {
+		if locations == nil {
+			c.dirty[s.location], changed = true, true
+			continue
+		}
+		for _, location := range locations {
+			if s.location == location {
+				c.dirty[location], changed = true, true
+			}
+		}
+	}
+	if changed {
+		c.wake()
+	}
+}
+
+// wake notifies writer without waiting, it's called with mu locked
+func (c *liveAvgConn) wake() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// handle changes subscriptions by client message and returns false if client
+// sent too many messages without reading replies
+func (c *liveAvgConn) handle(req liveAvgRequest) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.replies) >= LIVE_AVG_MAX_SUBSCRIPTIONS {
+		return false
+	}
+	reply := func(message string) {
+		c.replies = append(c.replies, liveAvgMessage{Type: "error", ID: req.ID, Error: message})
+		c.wake()
+	}
+	switch req.Action {
+	case "subscribe":
+		if req.ID == "" || req.Location <= 0 {
+			reply("Bad message parameters")
+			return true
+		}
+		// every subscription computes average
+		if res := rateLimiter.Take("live_avg:"+strconv.FormatInt(c.id, 10), LIVE_AVG_SUBSCRIBE_RATE_LIMIT); !res.Allowed {
+			reply("Too many subscribe messages, retry after " + ceilSeconds(res.RetryAfter) + " seconds")
+			return true
+		}
+		if _, ok := c.subscriptions[req.ID]; !ok && len(c.subscriptions) >= LIVE_AVG_MAX_SUBSCRIPTIONS {
+			reply("Too many subscriptions")
+			return true
+		}
+		qsParams := url.Values{}
+		for name, value := range req.Params {
+			qsParams.Set(name, value)
+		}
+		c.subscriptions[req.ID] = &liveAvgSubscription{location: req.Location, filter: getAvgFilter(qsParams)}
+		c.dirty[req.Location] = true
+		c.wake()
+	case "unsubscribe":
+		if _, ok := c.subscriptions[req.ID]; !ok {
+			reply("Subscription not found")
+			return true
+		}
+		delete(c.subscriptions, req.ID)
+		c.replies = append(c.replies, liveAvgMessage{Type: "unsubscribed", ID: req.ID})
+		c.wake()
+	default:
+		reply("Unknown action")
+	}
+	return true
+}
+
+func (c *liveAvgConn) read() {
+	defer close(c.closed)
+
+	c.ws.SetReadLimit(LIVE_AVG_MAX_MESSAGE_SIZE)
+	c.ws.SetReadDeadline(time.Now().Add(LIVE_AVG_READ_TIMEOUT))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(LIVE_AVG_READ_TIMEOUT))
+	})
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.ws.SetReadDeadline(time.Now().Add(LIVE_AVG_READ_TIMEOUT))
+		var req liveAvgRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			req = liveAvgRequest{}
+		}
+		if !c.handle(req) {
+			return
+		}
+	}
+}
+
+func (c *liveAvgConn) send(message liveAvgMessage) error {
+	c.ws.SetWriteDeadline(time.Now().Add(LIVE_AVG_WRITE_TIMEOUT))
+	return c.ws.WriteJSON(message)
+}
+
+// flush sends replies and averages of dirty locations which have changed
+func (c *liveAvgConn) flush() error {
+	c.mu.Lock()
+	replies := c.replies
+	c.replies = nil
+	dirty := c.dirty
+	c.dirty = make(map[int]bool)
+	subscriptions := make(map[string]*liveAvgSubscription)
+	for id, s := range c.subscriptions {
+		if dirty[s.location] {
+			subscriptions[id] = s
+		}
+	}
+	c.mu.Unlock()
+
+	for _, message := range replies {
+		if err := c.send(message); err != nil {
+			return err
+		}
+	}
+	db := InitDb()
+	defer db.Close()
+	for id, s := range subscriptions {
+		avg, errRes, statusCode := getLocationAvg(db, strconv.Itoa(s.location), s.filter)
+		errMessage := ""
+		if statusCode != 200 {
+			errMessage = "Average can't be computed"
+			if res, ok := errRes.(map[string]string); ok {
+				errMessage = res["Error"]
+			}
+			avg = 0
+		}
+		if s.sent && s.lastAvg == avg && s.lastError == errMessage {
+			continue
+		}
+
+		c.mu.Lock()
+		current := c.subscriptions[id]
+		c.mu.Unlock()
+		if current != s {
+			// unsubscribed while average was computed
+			continue
+		}
+		message := liveAvgMessage{Type: "avg", ID: id, Location: s.location}
+		if errMessage != "" {
+			message.Type, message.Error = "error", errMessage
+		} else {
+			message.Avg = &avg
+		}
+		if err := c.send(message); err != nil {
+			return err
+		}
+		s.sent, s.lastAvg, s.lastError = true, avg, errMessage
+	}
+	return nil
+}
+
+func (c *liveAvgConn) write() {
+	ping := time.NewTicker(LIVE_AVG_PING_INTERVAL)
+	defer ping.Stop()
+	for {
+		select {
+		case <-c.notify:
+			if err := c.flush(); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(LIVE_AVG_WRITE_TIMEOUT)); err != nil {
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// getLiveLocationAvg serves WebSocket connection whose clients subscribe to
+// averages of locations. Averages are sent on subscription and when visits,
+// users or locations change them.
+func getLiveLocationAvg(w http.ResponseWriter, r *http.Request) {
+	c := &liveAvgConn{
+		id:            atomic.AddInt64(&liveAvgConnID, 1),
+		client:        getRateLimitClient(r),
+		subscriptions: make(map[string]*liveAvgSubscription),
+		dirty:         make(map[int]bool),
+		notify:        make(chan struct{}, 1),
+		closed:        make(chan struct{}),
+	}
+	if res, statusCode := liveAvg.register(c); statusCode != 200 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+	defer liveAvg.unregister(c)
+
+	ws, err := liveAvgUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// upgrader has responded with error
+		return
+	}
+	c.mu.Lock()
+	c.ws = ws
+	c.mu.Unlock()
+	defer ws.Close()
+
+	go c.read()
+	c.write()
+}
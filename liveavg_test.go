@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialLiveAvg(t *testing.T, server *httptest.Server) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	header.Set(API_KEY_HEADER, testApiKey)
+	return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/locations/avg/live", header)
+}
+
+func readLiveAvg(t *testing.T, ws *websocket.Conn) liveAvgMessage {
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message liveAvgMessage
+	if err := ws.ReadJSON(&message); err != nil {
+		t.Fatalf("Expected message. Got %v", err)
+	}
+	return message
+}
+
+func checkLiveAvg(t *testing.T, message liveAvgMessage, id string, avg float64) {
+	if message.Type != "avg" || message.ID != id || message.Avg == nil || *message.Avg != avg {
+		t.Errorf("Expected avg %v of subscription %s. Got %+v", avg, id, message)
+	}
+}
+
+func TestLiveLocationAvg(t *testing.T) {
+	ClearDB()
+	server := httptest.NewServer(r)
+	defer server.Close()
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/users/new", `{"id": 2, "email": "b@mail.com", "first_name": "B", "last_name": "B", "gender": "f", "birth_date": 631152000}`)
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Place", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 4}`)
+
+	ws, _, err := dialLiveAvg(t, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// current values are sent on subscription
+	ws.WriteJSON(liveAvgRequest{Action: "subscribe", ID: "all", Location: 1})
+	checkLiveAvg(t, readLiveAvg(t, ws), "all", 4)
+	ws.WriteJSON(liveAvgRequest{Action: "subscribe", ID: "men", Location: 1, Params: map[string]string{"gender": "m"}})
+	checkLiveAvg(t, readLiveAvg(t, ws), "men", 4)
+
+	// visit of woman doesn't change average of men, which isn't sent again
+	postJSON(t, "/visits/new", `{"id": 2, "location": 1, "user": 2, "visited_at": "1500000001", "mark": 2}`)
+	checkLiveAvg(t, readLiveAvg(t, ws), "all", 3)
+
+	// users change averages of locations they visited
+	postJSON(t, "/users/2", `{"gender": "m"}`)
+	checkLiveAvg(t, readLiveAvg(t, ws), "men", 3)
+
+	ws.WriteJSON(liveAvgRequest{Action: "unsubscribe", ID: "men"})
+	if message := readLiveAvg(t, ws); message.Type != "unsubscribed" || message.ID != "men" {
+		t.Errorf("Expected unsubscribed message. Got %+v", message)
+	}
+	req, _ := http.NewRequest("DELETE", "/locations/1", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	if message := readLiveAvg(t, ws); message.Type != "error" || message.ID != "all" || message.Error != "Location not found" {
+		t.Errorf("Expected error of deleted location. Got %+v", message)
+	}
+
+	for _, req := range []liveAvgRequest{
+		{Action: "subscribe", ID: "bad"},
+		{Action: "unsubscribe", ID: "men"},
+		{Action: "publish", ID: "all"},
+	} {
+		ws.WriteJSON(req)
+		if message := readLiveAvg(t, ws); message.Type != "error" || message.ID != req.ID {
+			t.Errorf("Expected error for %+v. Got %+v", req, message)
+		}
+	}
+}
+
+func TestLiveLocationAvgLimits(t *testing.T) {
+	server := httptest.NewServer(r)
+	defer server.Close()
+	defer func(connections, subscriptions, rate int) {
+		LIVE_AVG_MAX_CONNECTIONS_PER_CLIENT, LIVE_AVG_MAX_SUBSCRIPTIONS, LIVE_AVG_SUBSCRIBE_RATE_LIMIT = connections, subscriptions, rate
+	}(LIVE_AVG_MAX_CONNECTIONS_PER_CLIENT, LIVE_AVG_MAX_SUBSCRIPTIONS, LIVE_AVG_SUBSCRIBE_RATE_LIMIT)
+	LIVE_AVG_MAX_CONNECTIONS_PER_CLIENT, LIVE_AVG_MAX_SUBSCRIPTIONS, LIVE_AVG_SUBSCRIBE_RATE_LIMIT = 1, 1, 3
+	// connections of other tests are closed in background
+	waitFor(t, func() bool {
+		liveAvg.mu.Lock()
+		defer liveAvg.mu.Unlock()
+		return len(liveAvg.conns) == 0
+	})
+
+	ws, _, err := dialLiveAvg(t, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	_, res, err := dialLiveAvg(t, server)
+	if err == nil || res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected second connection to be refused. Got %v", err)
+	}
+
+	ws.WriteJSON(liveAvgRequest{Action: "subscribe", ID: "a", Location: 1})
+	readLiveAvg(t, ws)
+	ws.WriteJSON(liveAvgRequest{Action: "subscribe", ID: "b", Location: 1})
+	if message := readLiveAvg(t, ws); message.Error != "Too many subscriptions" {
+		t.Errorf("Expected subscriptions limit error. Got %+v", message)
+	}
+
+	// resubscribing computes average too, so it's rate limited
+	ws.WriteJSON(liveAvgRequest{Action: "subscribe", ID: "a", Location: 1})
+	readLiveAvg(t, ws)
+	ws.WriteJSON(liveAvgRequest{Action: "subscribe", ID: "a", Location: 1})
+	if message := readLiveAvg(t, ws); message.Type != "error" || !strings.HasPrefix(message.Error, "Too many subscribe messages") {
+		t.Errorf("Expected subscribe rate limit error. Got %+v", message)
+	}
+	ws.WriteJSON(liveAvgRequest{Action: "unsubscribe", ID: "a"})
+	if message := readLiveAvg(t, ws); message.Type != "unsubscribed" {
+		t.Errorf("Expected connection to stay open. Got %+v", message)
+	}
+}
+
+func TestLiveLocationAvgProtocolCredentials(t *testing.T) {
+	server := httptest.NewServer(r)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/locations/avg/live"
+
+	// browsers can't set headers of upgrade request
+	dialer := websocket.Dialer{Subprotocols: []string{LIVE_AVG_PROTOCOL, WS_API_KEY_PROTOCOL_PREFIX + testApiKey}}
+	ws, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if ws.Subprotocol() != LIVE_AVG_PROTOCOL {
+		t.Errorf("Expected %s subprotocol. Got %q", LIVE_AVG_PROTOCOL, ws.Subprotocol())
+	}
+
+	dialer.Subprotocols = []string{LIVE_AVG_PROTOCOL, WS_API_KEY_PROTOCOL_PREFIX + "wrong"}
+	if _, res, err := dialer.Dial(url, nil); err == nil || res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected wrong key to be refused. Got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	requestIDContextKey  contextKey = "request_id"
+	requestLogContextKey contextKey = "request_log"
+	// longer X-Request-ID headers of clients are replaced with generated id
+	MAX_REQUEST_ID_LENGTH = 128
+)
+
+// requestLog is filled by middlewares of router and is logged by RequestLogger
+type requestLog struct {
+	principal *Principal
+}
+
+func getRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDContextKey).(string)
+	return requestID
+}
+
+// setLogPrincipal passes authenticated principal to RequestLogger
+func setLogPrincipal(r *http.Request, p *Principal) {
+	if entry, ok := r.Context().Value(requestLogContextKey).(*requestLog); ok {
+		entry.principal = p
+	}
+}
+
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > MAX_REQUEST_ID_LENGTH {
+		return false
+	}
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// InitRequestDb is InitDb which logs SQL queries with id of request and
+// traces them as child spans of request span
+func InitRequestDb(r *http.Request) *gorm.DB {
+	return withRequest(InitDb(), r)
+}
+
+// InitMutationDb is InitRequestDb with pool of mutations
+func InitMutationDb(r *http.Request) *gorm.DB {
+	return withRequest(openDb(getMutationSqlDB()), r)
+}
+
+// withRequest sets logger and tracing of request to db
+func withRequest(db *gorm.DB, r *http.Request) *gorm.DB {
+	db.SetLogger(&GormLogger{RequestID: getRequestID(r)})
+	if isTraced(r) {
+		return db.Set(tracingContextKey, r.Context())
+	}
+	return db
+}
+
+// loggingResponseWriter counts status and size of response
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int
+}
+
+func (w *loggingResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *loggingResponseWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController flush streamed responses
+func (w *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack lets WebSocket connections take over connection of request
+func (w *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// RequestLogger sets X-Request-ID of request, taking it from client if it's
+// valid, and logs request with response status, size and duration
+func RequestLogger(targetMux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(REQUEST_ID_HEADER)
+		if !isValidRequestID(requestID) {
+			requestID = newRequestID()
+			r.Header.Set(REQUEST_ID_HEADER, requestID)
+		}
+		w.Header().Set(REQUEST_ID_HEADER, requestID)
+
+		entry := &requestLog{}
+		ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+		ctx = context.WithValue(ctx, requestLogContextKey, entry)
+		lw := &loggingResponseWriter{ResponseWriter: w, statusCode: 200}
+
+		targetMux.ServeHTTP(lw, r.WithContext(ctx))
+
+		requesterIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			requesterIP = r.RemoteAddr
+		}
+		fields := log.Fields{
+			"module":      "http",
+			"request_id":  requestID,
+			"method":      r.Method,
+			"uri":         r.RequestURI,
+			"ip":          requesterIP,
+			"user_agent":  r.UserAgent(),
+			"status":      lw.statusCode,
+			"bytes":       lw.bytes,
+			"duration_ms": time.Since(start).Seconds() * 1000,
+		}
+		if entry.principal != nil {
+			fields["principal"] = entry.principal.Type + ":" + entry.principal.Subject
+		}
+		log.WithFields(fields).Info("Request")
+	})
+}
+
+// rotatingFile is a log file which is renamed to <path>.1 when it reaches
+// maxSize bytes. Older files are shifted to <path>.2 and so on up to
+// maxBackups, the oldest one is removed.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	return f, f.open()
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if f.maxBackups > 0 {
+		os.Remove(f.path + "." + strconv.Itoa(f.maxBackups))
+		for i := f.maxBackups - 1; i > 0; i-- {
+			os.Rename(f.path+"."+strconv.Itoa(i), f.path+"."+strconv.Itoa(i+1))
+		}
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// openLogOutput returns writer for LOG_OUTPUT: "file", "stdout" or "both".
+// Returned closer is nil if log isn't written to file.
+func openLogOutput() (io.Writer, io.Closer, error) {
+	if LOG_OUTPUT == "stdout" {
+		return os.Stdout, nil, nil
+	}
+	if LOG_OUTPUT != "file" && LOG_OUTPUT != "both" {
+		return nil, nil, errors.New("LOG_OUTPUT must be file, stdout or both")
+	}
+	file, err := openRotatingFile(LOG_FILE_PATH, int64(LOG_MAX_SIZE_MB)<<20, LOG_MAX_BACKUPS)
+	if err != nil {
+		return nil, nil, err
+	}
+	if LOG_OUTPUT == "both" {
+		return io.MultiWriter(file, os.Stdout), file, nil
+	}
+	return file, file, nil
+}
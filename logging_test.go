@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestRequestLogger(t *testing.T) {
+	ClearDB()
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	req, _ := http.NewRequest("GET", "/users/1", nil)
+	req.Header.Set(API_KEY_HEADER, testApiKey)
+	response := httptest.NewRecorder()
+	RequestLogger(r).ServeHTTP(response, req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+
+	requestID := response.Header().Get(REQUEST_ID_HEADER)
+	if len(requestID) != 32 {
+		t.Errorf("Expected generated request id. Got '%s'", requestID)
+	}
+	var requestEntry *log.Entry
+	sqlLogged := false
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["module"] == "http" {
+			requestEntry = entry
+		}
+		if entry.Data["module"] == "gorm" && entry.Data["request_id"] == requestID {
+			sqlLogged = true
+		}
+	}
+	if requestEntry == nil {
+		t.Fatal("Expected request to be logged")
+	}
+	if requestEntry.Data["status"] != 404 || requestEntry.Data["request_id"] != requestID || requestEntry.Data["principal"] != "api_key:tests" {
+		t.Errorf("Unexpected request log fields %v", requestEntry.Data)
+	}
+	if !sqlLogged {
+		t.Errorf("Expected SQL queries to be logged with request id")
+	}
+
+	req, _ = http.NewRequest("GET", "/users/1", nil)
+	req.Header.Set(API_KEY_HEADER, testApiKey)
+	req.Header.Set(REQUEST_ID_HEADER, "client-id-1")
+	response = httptest.NewRecorder()
+	RequestLogger(r).ServeHTTP(response, req)
+	if id := response.Header().Get(REQUEST_ID_HEADER); id != "client-id-1" {
+		t.Errorf("Expected request id of client to be kept. Got '%s'", id)
+	}
+}
+
+func TestRequestLoggerLocationAggregates(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	for _, url := range []string{"/locations/1/avg", "/locations/1/avg?fromDate=1400000000", "/locations/1/stats"} {
+		hook.Reset()
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set(API_KEY_HEADER, testApiKey)
+		req.Header.Set(REQUEST_ID_HEADER, "client-id-2")
+		response := httptest.NewRecorder()
+		RequestLogger(r).ServeHTTP(response, req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		for _, entry := range hook.AllEntries() {
+			if entry.Data["module"] == "gorm" && entry.Data["request_id"] != "client-id-2" {
+				t.Errorf("Expected SQL query of %s to be logged with request id. Got %v", url, entry.Data)
+			}
+		}
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	f, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		f.Write([]byte(line))
+	}
+	f.Close()
+
+	for name, expected := range map[string]string{"test.log": "fourth\n", "test.log.1": "third\n", "test.log.2": "second\n"} {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		if string(data) != expected {
+			t.Errorf("Expected %s to contain %q. Got %q", name, expected, data)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 rotated files to be kept")
+	}
+}
@@ -1,29 +1,27 @@
 package main
 
 import (
-	"bytes"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	_ "github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 	"gopkg.in/validator.v2"
 )
 
 const (
 	DB_PATH       = "./data.db"
-	LOG_FILE_PATH = "log.log"
 	LOGGING_LEVEL = log.InfoLevel
 )
 
@@ -61,19 +59,76 @@ const (
 	UPDATE = 1
 )
 
-type GormLogger struct{}
+// GormLogger logs SQL queries, with id of request if db is opened with InitRequestDb
+type GormLogger struct {
+	RequestID string
+}
 
-func (*GormLogger) Print(v ...interface{}) {
+func (l *GormLogger) Print(v ...interface{}) {
+	fields := log.Fields{"module": "gorm"}
+	if l.RequestID != "" {
+		fields["request_id"] = l.RequestID
+	}
 	if v[0] == "sql" {
-		log.WithFields(log.Fields{"module": "gorm", "type": "sql"}).Print(v[3])
+		fields["type"] = "sql"
+		log.WithFields(fields).Print(v[3])
 	}
 	if v[0] == "log" {
-		log.WithFields(log.Fields{"module": "gorm", "type": "log"}).Print(v[2])
+		fields["type"] = "log"
+		log.WithFields(fields).Print(v[2])
 	}
 }
 
+// connection pools shared by all gorm DBs returned by InitDb and
+// InitMutationDb
+var (
+	sqlDB             *sql.DB
+	sqlDBOnce         sync.Once
+	mutationSqlDB     *sql.DB
+	mutationSqlDBOnce sync.Once
+)
+
+// sharedDB is sqlDB which isn't closed when gorm DB is closed
+type sharedDB struct {
+	*sql.DB
+}
+
+func (sharedDB) Close() error {
+	return nil
+}
+
+func getSqlDB() *sql.DB {
+	sqlDBOnce.Do(func() {
+		var err error
+		// wait for locks of concurrent transactions instead of failing
+		sqlDB, err = sql.Open("sqlite3", DB_PATH+"?_busy_timeout=5000")
+		if err != nil {
+			panic(err)
+		}
+	})
+	return sqlDB
+}
+
+// getMutationSqlDB returns pool of mutations. Their transactions take write
+// lock when they begin, otherwise they fail without waiting if they read
+// before writes of other connections.
+func getMutationSqlDB() *sql.DB {
+	mutationSqlDBOnce.Do(func() {
+		var err error
+		mutationSqlDB, err = sql.Open("sqlite3", DB_PATH+"?_busy_timeout=5000&_txlock=immediate")
+		if err != nil {
+			panic(err)
+		}
+	})
+	return mutationSqlDB
+}
+
 func InitDb() *gorm.DB {
-	db, err := gorm.Open("sqlite3", DB_PATH)
+	return openDb(getSqlDB())
+}
+
+func openDb(sqlDB *sql.DB) *gorm.DB {
+	db, err := gorm.Open("sqlite3", sharedDB{sqlDB})
 
 	db.SetLogger(&GormLogger{})
 
@@ -94,9 +149,13 @@ func check(e error) {
 }
 
 func getEntities(w http.ResponseWriter, r *http.Request) {
-	db := InitDb()
+	db := InitRequestDb(r)
 	defer db.Close()
 
+	if includeDeleted(r) {
+		db = db.Unscoped()
+	}
+
 	params := mux.Vars(r)
 
 	var res interface{}
@@ -132,6 +191,12 @@ func getOrUpdateEntity(entity string, id string, opType int, modelUpdates ...int
 	db := InitDb()
 	defer db.Close()
 
+	return findOrUpdateEntity(db, entity, id, opType, modelUpdates...)
+}
+
+// findOrUpdateEntity is getOrUpdateEntity which works in given db or transaction.
+// Entity is returned as it was before update.
+func findOrUpdateEntity(db *gorm.DB, entity string, id string, opType int, modelUpdates ...interface{}) (interface{}, int) {
 	statusCode := 200
 
 	var res interface{}
@@ -144,8 +209,8 @@ func getOrUpdateEntity(entity string, id string, opType int, modelUpdates ...int
 			statusCode = 404
 			break
 		}
-		if opType == UPDATE {
-			db.Model(&foundEntity).Updates(modelUpdates[0])
+		if opType == UPDATE && updateEntityFields(db, foundEntity, modelUpdates[0]) != nil {
+			res, statusCode = map[string]string{"Error": "Entity can't be saved"}, 500
 		}
 	case "visits":
 		var foundEntity Visit
@@ -155,8 +220,8 @@ func getOrUpdateEntity(entity string, id string, opType int, modelUpdates ...int
 			statusCode = 404
 			break
 		}
-		if opType == UPDATE {
-			db.Model(&foundEntity).Updates(modelUpdates[0])
+		if opType == UPDATE && updateEntityFields(db, foundEntity, modelUpdates[0]) != nil {
+			res, statusCode = map[string]string{"Error": "Entity can't be saved"}, 500
 		}
 	case "locations":
 		var foundEntity Location
@@ -166,8 +231,8 @@ func getOrUpdateEntity(entity string, id string, opType int, modelUpdates ...int
 			statusCode = 404
 			break
 		}
-		if opType == UPDATE {
-			db.Model(&foundEntity).Updates(modelUpdates[0])
+		if opType == UPDATE && updateEntityFields(db, foundEntity, modelUpdates[0]) != nil {
+			res, statusCode = map[string]string{"Error": "Entity can't be saved"}, 500
 		}
 	default:
 		res = map[string]string{"Error": "Entity type doesn't exist"}
@@ -183,116 +248,263 @@ func getOrUpdateEntity(entity string, id string, opType int, modelUpdates ...int
 	return res, statusCode
 }
 
+// updateEntityFields updates fields of entity and its mark aggregates
+func updateEntityFields(db *gorm.DB, entity interface{}, updates interface{}) error {
+	switch foundEntity := entity.(type) {
+	case User:
+		if err := applyUserMarks(db, foundEntity, -1); err != nil {
+			return err
+		}
+		if err := db.Model(&foundEntity).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := db.Where("id = ?", foundEntity.ID).First(&foundEntity).Error; err != nil {
+			return err
+		}
+		return applyUserMarks(db, foundEntity, 1)
+	case Visit:
+		if err := applyVisitMarks(db, foundEntity, -1); err != nil {
+			return err
+		}
+		if err := db.Model(&foundEntity).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := db.Where("id = ?", foundEntity.ID).First(&foundEntity).Error; err != nil {
+			return err
+		}
+		return applyVisitMarks(db, foundEntity, 1)
+	case Location:
+		return db.Model(&foundEntity).Updates(updates).Error
+	}
+	return nil
+}
+
 func createEntity(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 
-	db := InitDb()
-	defer db.Close()
-
 	w.Header().Set("Content-Type", "application/json; ")
 
-	body, err := ioutil.ReadAll(r.Body)
-	defer r.Body.Close()
-	check(err)
-
-	body_ := bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
+	body_, err := readRequestBody(r)
+	if err == nil {
+		err = checkReadOnlyFields(body_)
+	}
+	if err != nil {
+		res, statusCode := getBodyErrorResponse(err)
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
 
-	var errUnmarshal error
-	var errValidation error
 	entity, ok := params["entity"]
-	if ok {
-		entity = strings.ToLower(entity)
-		switch entity {
-		case "users":
-			var model User
-			errUnmarshal = json.Unmarshal(body_, &model)
-			errValidation = validator.Validate(model)
-			if errUnmarshal == nil && errValidation == nil {
-				db.Create(&model)
-				json.NewEncoder(w).Encode(model)
-			}
-		case "visits":
-			var model Visit
-			errUnmarshal = json.Unmarshal(body_, &model)
-			errValidation = validator.Validate(model)
-			if errUnmarshal == nil && errValidation == nil {
-				db.Create(&model)
-				json.NewEncoder(w).Encode(model)
-			}
-		case "locations":
-			var model Location
-			//model = model.(Location)
-			errUnmarshal = json.Unmarshal(body_, &model)
-			errValidation = validator.Validate(model)
-			if errUnmarshal == nil && errValidation == nil {
-				db.Create(&model)
-				json.NewEncoder(w).Encode(model)
-			}
-		default:
-			res := map[string]string{"Error": "Entity doesn't exist"}
-			json.NewEncoder(w).Encode(res)
-			return
-		}
-	} else {
+	if !ok {
 		res := map[string]string{"Error": "No entity specified"}
 		json.NewEncoder(w).Encode(res)
 		return
 	}
 
-	if errUnmarshal != nil || errValidation != nil {
-		w.WriteHeader(400)
-		fmt.Println(errValidation)
-		res := map[string]string{"Error": "Bad request body parameters"}
-		json.NewEncoder(w).Encode(res)
+	model, errRes, statusCode := saveNewEntity(r, strings.ToLower(entity), body_)
+	if errRes != nil {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(errRes)
+		return
 	}
+	w.Header().Set("ETag", getETag(model))
+	json.NewEncoder(w).Encode(model)
 }
 
-func deleteEntity(entity string, id string) (interface{}, int) {
-	db := InitDb()
-	defer db.Close()
+// saveNewEntity creates entity from request body. It returns created model,
+// or error response and its status code.
+func saveNewEntity(r *http.Request, entity string, body []byte) (interface{}, interface{}, int) {
+	var model interface{}
+	var errUnmarshal error
+	var errValidation error
+	var errSave error
+	switch entity {
+	case "users":
+		var user User
+		errUnmarshal = decodeStrict(body, &user)
+		errValidation = validator.Validate(user)
+		if errUnmarshal == nil && errValidation == nil {
+			user.Version = 1
+			errSave = runMutation(r, func(tx *gorm.DB) (*mutation, error) {
+				if err := checkNotDeleted(tx, entity, &User{}, user.ID); err != nil {
+					return nil, err
+				}
+				if err := tx.Create(&user).Error; err != nil {
+					return nil, err
+				}
+				if err := applyUserMarks(tx, user, 1); err != nil {
+					return nil, err
+				}
+				return &mutation{Entity: entity, ID: user.ID, Operation: OPERATION_CREATE, After: user}, nil
+			})
+		}
+		model = user
+	case "visits":
+		var visit Visit
+		errUnmarshal = decodeStrict(body, &visit)
+		errValidation = validator.Validate(visit)
+		if errUnmarshal == nil && errValidation == nil {
+			visit.Version = 1
+			errSave = runMutation(r, func(tx *gorm.DB) (*mutation, error) {
+				if err := checkNotDeleted(tx, entity, &Visit{}, visit.ID); err != nil {
+					return nil, err
+				}
+				if err := tx.Create(&visit).Error; err != nil {
+					return nil, err
+				}
+				if err := applyVisitMarks(tx, visit, 1); err != nil {
+					return nil, err
+				}
+				return &mutation{Entity: entity, ID: visit.ID, Operation: OPERATION_CREATE, After: visit}, nil
+			})
+		}
+		model = visit
+	case "locations":
+		var location Location
+		errUnmarshal = decodeStrict(body, &location)
+		errValidation = validator.Validate(location)
+		if errUnmarshal == nil && errValidation == nil {
+			location.Version = 1
+			errSave = runMutation(r, func(tx *gorm.DB) (*mutation, error) {
+				if err := checkNotDeleted(tx, entity, &Location{}, location.ID); err != nil {
+					return nil, err
+				}
+				if err := tx.Create(&location).Error; err != nil {
+					return nil, err
+				}
+				return &mutation{Entity: entity, ID: location.ID, Operation: OPERATION_CREATE, After: location}, nil
+			})
+		}
+		model = location
+	default:
+		// status code of unknown entity is 200 for compatibility
+		return nil, map[string]string{"Error": "Entity doesn't exist"}, 200
+	}
 
+	if errUnmarshal != nil || errValidation != nil {
+		fmt.Println(errValidation)
+		return nil, map[string]string{"Error": "Bad request body parameters"}, 400
+	} else if deletedErr, ok := errSave.(*deletedEntityError); ok {
+		message := fmt.Sprintf("Entity with this id is deleted, restore it with POST /%s/%d/restore", deletedErr.entity, deletedErr.id)
+		return nil, map[string]string{"Error": message}, 409
+	} else if errSave != nil {
+		return nil, map[string]string{"Error": "Entity can't be saved"}, 500
+	}
+	return model, nil, 200
+}
+
+func deleteEntity(r *http.Request, entity string, id string) (interface{}, int) {
 	statusCode := 200
 
 	var res interface{}
 	res = map[string]interface{}{"Success": true}
+	var errSave error
 	switch entity {
 	case "users":
-		var foundEntity User
-		db.Where("id = ?", id).Delete(foundEntity)
+		errSave = runMutation(r, func(tx *gorm.DB) (*mutation, error) {
+			var foundEntity User
+			tx.Where("id = ?", id).First(&foundEntity)
+			if (foundEntity == User{}) {
+				res, statusCode = map[string]string{"Error": "Entity not found"}, 404
+				return nil, nil
+			}
+			if errRes, code := checkIfMatch(r, foundEntity); code != 200 {
+				res, statusCode = errRes, code
+				return nil, nil
+			}
+			if err := applyUserMarks(tx, foundEntity, -1); err != nil {
+				return nil, err
+			}
+			if err := bumpVersion(tx, &foundEntity); err != nil {
+				return nil, err
+			}
+			if err := tx.Delete(&foundEntity).Error; err != nil {
+				return nil, err
+			}
+			return &mutation{Entity: entity, ID: foundEntity.ID, Operation: OPERATION_DELETE, Before: foundEntity}, nil
+		})
 	case "visits":
-		var foundEntity Visit
-		db.Where("id = ?", id).Delete(foundEntity)
+		errSave = runMutation(r, func(tx *gorm.DB) (*mutation, error) {
+			var foundEntity Visit
+			tx.Where("id = ?", id).First(&foundEntity)
+			if (foundEntity == Visit{}) {
+				res, statusCode = map[string]string{"Error": "Entity not found"}, 404
+				return nil, nil
+			}
+			if errRes, code := checkIfMatch(r, foundEntity); code != 200 {
+				res, statusCode = errRes, code
+				return nil, nil
+			}
+			if err := applyVisitMarks(tx, foundEntity, -1); err != nil {
+				return nil, err
+			}
+			if err := bumpVersion(tx, &foundEntity); err != nil {
+				return nil, err
+			}
+			if err := tx.Delete(&foundEntity).Error; err != nil {
+				return nil, err
+			}
+			return &mutation{Entity: entity, ID: foundEntity.ID, Operation: OPERATION_DELETE, Before: foundEntity}, nil
+		})
 	case "locations":
-		var foundEntity Location
-		db.Where("id = ?", id).Delete(foundEntity)
+		errSave = runMutation(r, func(tx *gorm.DB) (*mutation, error) {
+			var foundEntity Location
+			tx.Where("id = ?", id).First(&foundEntity)
+			if (foundEntity == Location{}) {
+				res, statusCode = map[string]string{"Error": "Entity not found"}, 404
+				return nil, nil
+			}
+			if errRes, code := checkIfMatch(r, foundEntity); code != 200 {
+				res, statusCode = errRes, code
+				return nil, nil
+			}
+			if err := bumpVersion(tx, &foundEntity); err != nil {
+				return nil, err
+			}
+			if err := tx.Delete(&foundEntity).Error; err != nil {
+				return nil, err
+			}
+			return &mutation{Entity: entity, ID: foundEntity.ID, Operation: OPERATION_DELETE, Before: foundEntity}, nil
+		})
 	default:
 		res = map[string]string{"Error": "Entity doesn't exist"}
 		statusCode = 404
 	}
+	if errSave != nil {
+		res = map[string]string{"Error": "Entity can't be deleted"}
+		statusCode = 500
+	}
 	return res, statusCode
 }
 
-func updateEntity(entity string, id string, rBody io.Reader) (interface{}, int) {
-	db := InitDb()
-	defer db.Close()
-
-	body, err := ioutil.ReadAll(rBody)
-	check(err)
-
-	body_ := bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
-
+// updateEntity updates entity with fields of request body. It returns response,
+// ETag of updated entity and status code.
+func updateEntity(r *http.Request, entity string, id string, body []byte) (interface{}, string, int) {
+	// updated fields are checked with strict decoding to the model
 	var errUnmarshal error
-	var modelUpdated interface{}
 	switch entity {
-	case "users", "visits", "locations":
-		errUnmarshal = json.Unmarshal(body_, &modelUpdated)
+	case "users":
+		errUnmarshal = decodeStrict(body, &User{})
+	case "visits":
+		errUnmarshal = decodeStrict(body, &Visit{})
+	case "locations":
+		errUnmarshal = decodeStrict(body, &Location{})
 	default:
 		res := map[string]string{"Error": "Entity doesn't exist"}
-		return res, 404
+		return res, "", 404
+	}
+
+	if errUnmarshal == nil {
+		errUnmarshal = checkReadOnlyFields(body)
+	}
+	var modelUpdated map[string]interface{}
+	if errUnmarshal == nil {
+		errUnmarshal = json.Unmarshal(body, &modelUpdated)
 	}
 
 	nullFields := false
-	for _, v := range modelUpdated.(map[string]interface{}) {
+	for _, v := range modelUpdated {
 		if v == nil {
 			nullFields = true
 		}
@@ -300,17 +512,39 @@ func updateEntity(entity string, id string, rBody io.Reader) (interface{}, int)
 
 	var statusCode int
 	var res interface{}
+	var etag string
 	if errUnmarshal != nil || nullFields {
 		statusCode = 400
 		res = map[string]string{"Error": "Bad request body parameters"}
 	} else {
-		res, statusCode = getOrUpdateEntity(entity, id, UPDATE, modelUpdated)
-		if statusCode == 200 {
+		modelUpdated["version"] = incrementVersion()
+		errSave := runMutation(r, func(tx *gorm.DB) (*mutation, error) {
+			before, code := findOrUpdateEntity(tx, entity, id, GET)
+			if code == 200 {
+				res, statusCode = checkIfMatch(r, before)
+			} else {
+				res, statusCode = before, code
+			}
+			if statusCode != 200 {
+				return nil, nil
+			}
+			if err := updateEntityFields(tx, before, modelUpdated); err != nil {
+				return nil, err
+			}
+			after, _ := findOrUpdateEntity(tx, entity, id, GET)
+			etag = getETag(after)
+			return &mutation{Entity: entity, ID: getModelID(before), Operation: OPERATION_UPDATE, Before: before, After: after}, nil
+		})
+		if errSave != nil {
+			statusCode = 500
+			res = map[string]string{"Error": "Entity can't be saved"}
+			etag = ""
+		} else if statusCode == 200 {
 			res = map[string]interface{}{}
 		}
 	}
 
-	return res, statusCode
+	return res, etag, statusCode
 
 }
 
@@ -334,11 +568,34 @@ func processEntity(w http.ResponseWriter, r *http.Request) {
 		entity = strings.ToLower(entity)
 		switch r.Method {
 		case http.MethodGet:
-			res, statusCode = getOrUpdateEntity(entity, id, GET)
+			db := InitRequestDb(r)
+			query := db
+			if includeDeleted(r) {
+				query = db.Unscoped()
+			}
+			res, statusCode = findOrUpdateEntity(query, entity, id, GET)
+			db.Close()
+			if statusCode == 200 {
+				etag := getETag(res)
+				w.Header().Set("ETag", etag)
+				if isNotModified(r, etag) {
+					w.WriteHeader(304)
+					return
+				}
+			}
 		case http.MethodPost:
-			res, statusCode = updateEntity(entity, id, r.Body)
+			body, err := readRequestBody(r)
+			if err != nil {
+				res, statusCode = getBodyErrorResponse(err)
+			} else {
+				var etag string
+				res, etag, statusCode = updateEntity(r, entity, id, body)
+				if etag != "" {
+					w.Header().Set("ETag", etag)
+				}
+			}
 		case http.MethodDelete:
-			res, statusCode = deleteEntity(entity, id)
+			res, statusCode = deleteEntity(r, entity, id)
 		}
 	} else {
 		res = map[string]string{"Error": "No entity specified"}
@@ -351,7 +608,7 @@ func processEntity(w http.ResponseWriter, r *http.Request) {
 }
 
 func getUserVisits(w http.ResponseWriter, r *http.Request) {
-	db := InitDb()
+	db := InitRequestDb(r)
 	defer db.Close()
 
 	w.Header().Set("Content-Type", "application/json")
@@ -366,30 +623,22 @@ func getUserVisits(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	qsError := true
-	var err error
 	qsParams := r.URL.Query()
 
-	fromDate := qsParams.Get("fromDate")
-	_, err = strconv.Atoi(fromDate)
-	if err != nil {
-		qsError = true
-	}
-
-	toDate := qsParams.Get("toDate")
-	_, err = strconv.Atoi(toDate)
-	if err != nil {
-		qsError = true
-	}
-
-	country := qsParams.Get("country")
-
-	toDistanceString := qsParams.Get("toDistance")
-	toDistance, err := strconv.Atoi(toDistanceString)
-	if err != nil {
-		qsError = true
-		toDistance = -1
+	// parameters are optional, but can't be empty
+	qsError := false
+	for _, name := range []string{"fromDate", "toDate", "country", "toDistance"} {
+		if values, ok := qsParams[name]; ok && values[0] == "" {
+			qsError = true
+		}
 	}
+	var f visitsFilter
+	var fromDateOk, toDateOk, toDistanceOk bool
+	f.fromDate, fromDateOk = getDateParam(qsParams, "fromDate")
+	f.toDate, toDateOk = getDateParam(qsParams, "toDate")
+	f.country = qsParams.Get("country")
+	f.toDistance, toDistanceOk = getIntParam(qsParams, "toDistance", -1)
+	qsError = qsError || !fromDateOk || !toDateOk || !toDistanceOk
 
 	if qsError {
 		w.WriteHeader(400)
@@ -397,114 +646,143 @@ func getUserVisits(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, statusCode := getOrUpdateEntity("users", id, GET)
+	res, statusCode := findOrUpdateEntity(db, "users", id, GET)
 	if statusCode != 200 {
-		json.NewEncoder(w).Encode(res)
 		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(res)
 		return
 	}
 
+	json.NewEncoder(w).Encode(filterUserVisits(db, id, f))
+}
+
+// visitsFilter is filter of visits by query string parameters of getUserVisits
+type visitsFilter struct {
+	fromDate   string
+	toDate     string
+	country    string
+	toDistance int
+}
+
+// filterUserVisits returns visits of user which match filter. Visits of
+// locations which don't exist are skipped.
+func filterUserVisits(db *gorm.DB, id string, f visitsFilter) []Visit {
 	var visits []Visit
 	db.Where("user = ?", id).Find(&visits)
 	visitsFiltered := make([]Visit, 0)
 	for _, v := range visits {
-		model, statusCode := getOrUpdateEntity("locations", strconv.Itoa(v.Location), GET)
-		var vLoc Location
-		vLoc = model.(Location)
+		model, statusCode := findOrUpdateEntity(db, "locations", strconv.Itoa(v.Location), GET)
 		if statusCode != 200 {
 			continue
 		}
-		if (country == "" || vLoc.Country == country) && (fromDate == "" || v.VisitedAt > fromDate) && (toDate == "" || v.VisitedAt < toDate) && (toDistance == -1 || vLoc.Distance < toDistance) {
+		vLoc := model.(Location)
+		if (f.country == "" || vLoc.Country == f.country) && (f.fromDate == "" || v.VisitedAt > f.fromDate) && (f.toDate == "" || v.VisitedAt < f.toDate) && (f.toDistance == -1 || vLoc.Distance < f.toDistance) {
 			visitsFiltered = append(visitsFiltered, v)
 		}
 	}
-	json.NewEncoder(w).Encode(visitsFiltered)
+	return visitsFiltered
 }
 
 func getUserAge(u User) int {
-	ts := time.Unix(int64(u.BirthDate), 0)
-	now := time.Now()
-	y1, M1, _ := ts.Date()
-	y2, M2, _ := now.Date()
-	years := y2 - y1
-	months := int(M2 - M1)
-	if months < 0 {
-		months += 12
-		years--
-	}
-	return years
+	return getAgeByBirthMonth(getUserBirthMonth(u))
 }
 
-func filterVisitsGetMarks(id string, fromDate string, toDate string, fromAge int, toAge int, gender string) (int, int) {
-	db := InitDb()
-	defer db.Close()
+type userVisit struct {
+	Visit Visit
+	User  User
+}
 
+func filterLocationVisits(db *gorm.DB, id string, f avgFilter) []userVisit {
 	var visits []Visit
 	db.Where("location = ?", id).Find(&visits)
-	marksSum := 0
-	marksCnt := 0
+	visitsFiltered := make([]userVisit, 0)
 	for _, v := range visits {
-		model, statusCode := getOrUpdateEntity("users", strconv.Itoa(v.User), GET)
-		var vUser User
-		vUser = model.(User)
+		model, statusCode := findOrUpdateEntity(db, "users", strconv.Itoa(v.User), GET)
 		if statusCode != 200 {
 			continue
 		}
-		var userAge int
-		if fromAge != -1 {
-			userAge = getUserAge(vUser)
-		}
-		if (gender == "" || vUser.Gender == gender) && (fromAge == -1 || userAge > fromAge) && (toAge == -1 || userAge < toAge) && (fromDate == "" || v.VisitedAt > fromDate) && (toDate == "" || v.VisitedAt < toDate) {
-			marksSum += v.Mark
-			marksCnt += 1
+		vUser := model.(User)
+		if f.matchesUser(vUser) && f.matchesVisit(v) {
+			visitsFiltered = append(visitsFiltered, userVisit{v, vUser})
 		}
 	}
-	return marksSum, marksCnt
+	return visitsFiltered
 }
 
-func getLocationAvgMark(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	params := mux.Vars(r)
-
-	id, ok := params["id"]
-	if !ok {
-		res := map[string]string{"Error": "No ID specified"}
-		w.WriteHeader(400)
-		json.NewEncoder(w).Encode(res)
-		return
+func filterVisitsGetMarks(db *gorm.DB, id string, f avgFilter) (int, int) {
+	marksSum := 0
+	marksCnt := 0
+	for _, uv := range filterLocationVisits(db, id, f) {
+		marksSum += uv.Visit.Mark
+		marksCnt += 1
 	}
+	return marksSum, marksCnt
+}
 
-	qsParams := r.URL.Query()
+// getAgeParam returns age from query string parameter or -1 if it isn't set
+func getAgeParam(qsParams url.Values, name string) int {
+	age, err := strconv.Atoi(qsParams.Get(name))
+	if err != nil {
+		return -1
+	}
+	return age
+}
 
-	fromDate := qsParams.Get("fromDate")
-	toDate := qsParams.Get("toDate")
-	gender := qsParams.Get("gender")
+// avgFilter is filter of visits by query string parameters of getLocationAvgMark
+type avgFilter struct {
+	fromDate string
+	toDate   string
+	fromAge  int
+	toAge    int
+	gender   string
+}
 
-	fromAgeString := qsParams.Get("fromAge")
-	fromAge, err := strconv.Atoi(fromAgeString)
-	if err != nil {
-		fromAge = -1
+func getAvgFilter(qsParams url.Values) avgFilter {
+	return avgFilter{
+		fromDate: qsParams.Get("fromDate"),
+		toDate:   qsParams.Get("toDate"),
+		fromAge:  getAgeParam(qsParams, "fromAge"),
+		toAge:    getAgeParam(qsParams, "toAge"),
+		gender:   qsParams.Get("gender"),
 	}
+}
 
-	toAgeString := qsParams.Get("toAge")
-	toAge, err := strconv.Atoi(toAgeString)
-	if err != nil {
-		toAge = -1
+// matchesUser checks gender and age of user. Age is computed only with
+// fromAge, toAge alone compares it as 0.
+func (f avgFilter) matchesUser(u User) bool {
+	var userAge int
+	if f.fromAge != -1 {
+		userAge = getUserAge(u)
 	}
+	return (f.gender == "" || u.Gender == f.gender) && (f.fromAge == -1 || userAge > f.fromAge) && (f.toAge == -1 || userAge < f.toAge)
+}
+
+// matchesVisit checks date of visit
+func (f avgFilter) matchesVisit(v Visit) bool {
+	return (f.fromDate == "" || v.VisitedAt > f.fromDate) && (f.toDate == "" || v.VisitedAt < f.toDate)
+}
 
-	locFoundRes, statusCode := getOrUpdateEntity("locations", id, GET)
+// getLocationAvg returns average mark of visits of location, or error
+// response and its status code
+func getLocationAvg(db *gorm.DB, id string, f avgFilter) (float64, interface{}, int) {
+	locFoundRes, statusCode := findOrUpdateEntity(db, "locations", id, GET)
 	if statusCode != 200 {
 		if statusCode == 404 {
 			// change "Entity not found" to "Location not found"
 			locFoundRes = map[string]string{"Error": "Location not found"}
 		}
-		w.WriteHeader(statusCode)
-		json.NewEncoder(w).Encode(locFoundRes)
-		return
+		return 0, locFoundRes, statusCode
 	}
 
-	marksSum, marksCnt := filterVisitsGetMarks(id, fromDate, toDate, fromAge, toAge, gender)
+	var marksSum, marksCnt int
+	// averages without date filters are served from aggregates
+	recordCacheRequest("location_marks", f.fromDate == "" && f.toDate == "")
+	if f.fromDate == "" && f.toDate == "" {
+		// without date filters marks can be taken from precomputed aggregates
+		marksSum, marksCnt = getLocationMarks(db, id, f.fromAge, f.toAge, f.gender)
+	} else {
+		marksSum, marksCnt = filterVisitsGetMarks(db, id, f)
+	}
 
 	var avg float64
 	if marksCnt == 0 {
@@ -512,32 +790,46 @@ func getLocationAvgMark(w http.ResponseWriter, r *http.Request) {
 	} else {
 		avg = float64(marksSum) / float64(marksCnt)
 	}
-	res := make(map[string]interface{})
-	res["avg"] = math.Round(avg*10000) / 10000
-
-	json.NewEncoder(w).Encode(res)
+	return math.Round(avg*10000) / 10000, nil, 200
 }
 
-func RequestLogger(targetMux http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+func getLocationAvgMark(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+
+	id, ok := params["id"]
+	if !ok {
+		res := map[string]string{"Error": "No ID specified"}
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
 
-		targetMux.ServeHTTP(w, r)
+	db := InitRequestDb(r)
+	defer db.Close()
 
-		// log request by who(IP address)
-		requesterIP := r.RemoteAddr
+	avg, errRes, statusCode := getLocationAvg(db, id, getAvgFilter(r.URL.Query()))
+	if statusCode != 200 {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(errRes)
+		return
+	}
+	res := make(map[string]interface{})
+	res["avg"] = avg
 
-		log.Printf(
-			"%s\t\t%s\t\t%s\t\t%v",
-			r.Method,
-			r.RequestURI,
-			requesterIP,
-			time.Since(start),
-		)
-	})
+	json.NewEncoder(w).Encode(res)
 }
 
 func CreateDbIfNotExists() error {
+	if err := createDb(); err != nil {
+		return err
+	}
+	return MigrateDb()
+}
+
+// createDb creates database with original schema if it doesn't exist
+func createDb() error {
 	if _, err := os.Stat(DB_PATH); err == nil {
 		return nil
 	} else if os.IsNotExist(err) {
@@ -566,45 +858,165 @@ func ClearDB() {
 	db := InitDb()
 	defer db.Close()
 
-	db.Delete(User{})
-	db.Delete(Location{})
-	db.Delete(Visit{})
+	db.Unscoped().Delete(User{})
+	db.Unscoped().Delete(Location{})
+	db.Unscoped().Delete(Visit{})
+	db.Delete(LocationMarks{})
 }
 
 func SetupHandlers() *mux.Router {
 	r := mux.NewRouter()
+	r.HandleFunc("/healthz", getHealth).Methods("GET")
+	r.HandleFunc("/readyz", getReadiness).Methods("GET")
+	r.HandleFunc("/version", getVersion).Methods("GET")
+	r.HandleFunc("/openapi.json", getOpenAPISpec).Methods("GET")
+	r.HandleFunc("/docs", getSwaggerUI).Methods("GET")
+	r.HandleFunc("/docs/{file}", getSwaggerUIFile).Methods("GET")
+	r.HandleFunc("/audit", getAuditLog).Methods("GET")
+	r.HandleFunc("/outbox", getOutboxLag).Methods("GET")
+	if METRICS_ADDR == "" {
+		r.HandleFunc("/metrics", serveMetrics).Methods("GET")
+	}
+	r.HandleFunc("/graphql", serveGraphQL(newGqlSchema())).Methods("GET", "POST")
+	r.HandleFunc("/events", getEvents).Methods("GET")
+	r.HandleFunc("/webhooks", getWebhooks).Methods("GET")
+	r.HandleFunc("/webhooks/new", createWebhook).Methods("POST")
+	r.HandleFunc("/webhooks/dead_letters", getWebhookDeadLetters).Methods("GET")
+	r.HandleFunc("/webhooks/{id}", deleteWebhook).Methods("DELETE")
 	r.HandleFunc("/{entity}", getEntities).Methods("GET")
-	r.HandleFunc("/{entity}/new", createEntity).Methods("POST")
+	r.HandleFunc("/{entity}/new", withIdempotencyKey(createEntity)).Methods("POST")
+	r.HandleFunc("/locations/top", getTopLocations).Methods("GET")
 	// get, update or delete
-	r.HandleFunc("/{entity}/{id}", processEntity)
-	r.HandleFunc("/users/{id}/visits", getUserVisits)
-	r.HandleFunc("/locations/{id}/avg", getLocationAvgMark)
+	r.HandleFunc("/{entity}/{id}", processEntity).Methods("GET", "POST", "DELETE")
+	r.HandleFunc("/{entity}/{id}/restore", restoreEntity).Methods("POST")
+	r.HandleFunc("/users/{id}/visits", getUserVisits).Methods("GET")
+	r.HandleFunc("/users/{id}/stats", getUserStats).Methods("GET")
+	r.HandleFunc("/users/{id}/recommendations", getUserRecommendations).Methods("GET")
+	r.HandleFunc("/locations/{id}/avg", getLocationAvgMark).Methods("GET")
+	r.HandleFunc("/locations/avg/live", getLiveLocationAvg).Methods("GET")
+	r.HandleFunc("/locations/{id}/stats", getLocationStats).Methods("GET")
+	r.Use(TracingMiddleware, MetricsMiddleware, IPRateLimitMiddleware, AuthMiddleware, RateLimitMiddleware, BodyLimitMiddleware, AuthorizationMiddleware)
+	// middlewares aren't run for requests without route, they're only counted
+	r.NotFoundHandler = MetricsMiddleware(http.NotFoundHandler())
+	r.MethodNotAllowedHandler = MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
 	return r
 }
 
-func main() {
-	file, err := os.OpenFile(LOG_FILE_PATH, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModeAppend)
+// commands are run instead of server when binary is started with command name
+// as the first argument
+var commands = map[string]func(args []string) error{
+	"serve":   runServeCommand,
+	"apikey":  runApiKeyCommand,
+	"purge":   runPurgeCommand,
+	"user":    runUserCommand,
+	"visits":  runVisitsCommand,
+	"avg":     runAvgCommand,
+	"import":  runImportCommand,
+	"export":  runExportCommand,
+	"migrate": runMigrateCommand,
+	"reset":   runResetCommand,
+}
+
+// runServeCommand starts the server, it's run if no command is given
+func runServeCommand(args []string) error {
+	logOutput, logFile, err := openLogOutput()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if logFile != nil {
+		defer logFile.Close()
 	}
 
-	defer file.Close()
-
-	DBCreationErr := CreateDbIfNotExists()
-	if DBCreationErr != nil {
-		log.Fatal(DBCreationErr)
-		panic(DBCreationErr)
+	if CLEAR_DB_ON_START {
+		ClearDB()
 	}
 
-	ClearDB()
+	go runAuditLogPruning()
+	if METRICS_ADDR != "" {
+		go serveAdminMetrics()
+	}
 
-	log.SetOutput(file)
+	log.SetOutput(logOutput)
 	log.SetFormatter(&log.JSONFormatter{})
 	log.SetLevel(LOGGING_LEVEL)
 
+	if err := initTracing(); err != nil {
+		return err
+	}
+	defer stopTracer()
+
+	sinks, webhooks, err := initOutbox()
+	if err != nil {
+		return err
+	}
+	startOutboxDispatcher(sinks)
+	if webhooks {
+		if err := startWebhookWorkers(); err != nil {
+			return err
+		}
+	}
+	go runOutboxPruning()
+
 	r := SetupHandlers()
 
+	server := &http.Server{Addr: ":8000", Handler: RequestLogger(r)}
+	// SSE responses and WebSockets don't finish by themselves
+	server.RegisterOnShutdown(events.closeAll)
+	server.RegisterOnShutdown(liveAvg.closeAll)
+	var grpcServer *grpc.Server
+	if GRPC_ADDR != "" {
+		grpcServer = newGrpcServer(r)
+		if err := serveGrpc(grpcServer); err != nil {
+			return err
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		shutdownOnSignal(server)
+		if grpcServer != nil {
+			stopGrpcServer(grpcServer)
+		}
+		close(stopped)
+	}()
+
 	log.Info("Server started")
-	log.Fatal(http.ListenAndServe(":8000", RequestLogger(r)))
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	// wait for requests in progress
+	<-stopped
+	log.Info("Server stopped")
+	return nil
+}
+
+func main() {
+	name, args := "serve", []string{}
+	if len(os.Args) > 1 && commands[os.Args[1]] != nil {
+		name, args = os.Args[1], os.Args[2:]
+	}
+	if name != "serve" {
+		// don't mix SQL logs with command output
+		log.SetLevel(log.WarnLevel)
+	}
 
+	setupDb := CreateDbIfNotExists
+	if name == "migrate" {
+		// migrate command applies migrations itself
+		setupDb = createDb
+	}
+	DBCreationErr := setupDb()
+	if DBCreationErr != nil {
+		log.Fatal(DBCreationErr)
+		panic(DBCreationErr)
+	}
+
+	if err := commands[name](args); err != nil {
+		if name == "serve" {
+			log.Fatal(err)
+		}
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
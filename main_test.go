@@ -14,6 +14,7 @@ import (
 
 var r *mux.Router
 var db *gorm.DB
+var testApiKey string
 
 func checkResponseCode(t *testing.T, expected, actual int) {
 	if expected != actual {
@@ -22,6 +23,9 @@ func checkResponseCode(t *testing.T, expected, actual int) {
 }
 
 func executeRequest(req *http.Request) *httptest.ResponseRecorder {
+	if req.Header.Get(API_KEY_HEADER) == "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set(API_KEY_HEADER, testApiKey)
+	}
 	rr := httptest.NewRecorder()
 	r.ServeHTTP(rr, req)
 
@@ -34,6 +38,19 @@ func TestMain(m *testing.M) {
 		panic(DBCreationErr)
 	}
 
+	var err error
+	testApiKey, _, err = CreateApiKey("tests", ROLE_ADMIN, 0)
+	if err != nil {
+		panic(err)
+	}
+
+	// tests make many requests with the same key, rate limits are tested separately
+	RATE_LIMIT_READS, RATE_LIMIT_WRITES, RATE_LIMIT_EXPENSIVE, RATE_LIMIT_IP = 0, 0, 0, 0
+
+	if err := startWebhookWorkers(); err != nil {
+		panic(err)
+	}
+
 	r = SetupHandlers()
 	db = InitDb()
 	db.LogMode(false)
@@ -291,6 +308,51 @@ func TestGetUserVisitsWithNullArgsInQueryString(t *testing.T) {
 		t.Errorf("Expected the 'error' key of the response to be set to 'Bad query string parameters'. Got '%s'", m["error"])
 	}
 }
+func TestGetUserVisitsFilters(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/locations/new", `{"id": 2, "place": "Louvre", "country": "France", "city": "Paris", "distance": 30}`)
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+	postJSON(t, "/visits/new", `{"id": 2, "location": 2, "user": 1, "visited_at": "1400000000", "mark": 3}`)
+
+	for query, count := range map[string]int{
+		"":                       2,
+		"?country=Russia":        1,
+		"?fromDate=1450000000":   1,
+		"?toDate=1450000000":     1,
+		"?toDistance=20":         1,
+		"?toDistance=5":          0,
+		"?country=Russia&toDate": -1,
+		"?toDistance=far":        -1,
+	} {
+		req, _ := http.NewRequest("GET", "/users/1/visits"+query, nil)
+		response := executeRequest(req)
+		if count == -1 {
+			checkResponseCode(t, http.StatusBadRequest, response.Code)
+			continue
+		}
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var visits []Visit
+		json.Unmarshal(response.Body.Bytes(), &visits)
+		if len(visits) != count {
+			t.Errorf("Expected %d visits of query '%s'. Got %d", count, query, len(visits))
+		}
+	}
+
+	// visits of deleted locations are skipped
+	req, _ := http.NewRequest("DELETE", "/locations/2", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("GET", "/users/1/visits", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var visits []Visit
+	json.Unmarshal(response.Body.Bytes(), &visits)
+	if len(visits) != 1 || visits[0].ID != 1 {
+		t.Errorf("Expected only visit of existing location. Got %+v", visits)
+	}
+}
+
 func TestGetUserVisitsNonExistingUser(t *testing.T) {
 	req, _ := http.NewRequest("GET", `/users/99999/visits`, nil)
 	response := executeRequest(req)
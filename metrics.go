@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// Metrics are exposed at /metrics in Prometheus text format
+
+// metricsRegistry has metrics of the app, Go runtime and process
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by route and response status.",
+	}, []string{"method", "route", "status"})
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "http_request_duration_seconds",
+		Help: "Duration of HTTP requests by route and response status.",
+	}, []string{"method", "route", "status"})
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "db_query_duration_seconds",
+		Help: "Duration of database queries made with gorm by operation.",
+	}, []string{"operation"})
+	cacheRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "Number of cache lookups by cache and result: location_marks aggregates of averages and idempotency for create retries.",
+	}, []string{"cache", "result"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		httpRequestsTotal,
+		httpRequestDuration,
+		dbQueryDuration,
+		cacheRequestsTotal,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// route label of requests which don't match any route
+const UNMATCHED_ROUTE = "unmatched"
+
+// MetricsMiddleware counts requests and their durations by route path template
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := UNMATCHED_ROUTE
+		if current := mux.CurrentRoute(r); current != nil {
+			route, _ = current.GetPathTemplate()
+		}
+
+		lw := &loggingResponseWriter{ResponseWriter: w, statusCode: 200}
+		next.ServeHTTP(lw, r)
+
+		status := strconv.Itoa(lw.statusCode)
+		httpRequestsTotal.WithLabelValues(r.Method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// recordCacheRequest counts hit or miss of cache
+func recordCacheRequest(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequestsTotal.WithLabelValues(cache, result).Inc()
+}
+
+const metricsStartKey = "metrics:start"
+
+// registerQueryMetrics measures duration of gorm callback. processor returns
+// new processor for every registration.
+func registerQueryMetrics(processor func() *gorm.CallbackProcessor, callbackName string, operation string) {
+	processor().Before(callbackName).Register("metrics:before_"+operation, func(scope *gorm.Scope) {
+		scope.Set(metricsStartKey, time.Now())
+	})
+	processor().After(callbackName).Register("metrics:after_"+operation, func(scope *gorm.Scope) {
+		if start, ok := scope.Get(metricsStartKey); ok {
+			dbQueryDuration.WithLabelValues(operation).Observe(time.Since(start.(time.Time)).Seconds())
+		}
+	})
+}
+
+func init() {
+	registerQueryMetrics(gorm.DefaultCallback.Create, "gorm:create", "create")
+	registerQueryMetrics(gorm.DefaultCallback.Query, "gorm:query", "query")
+	registerQueryMetrics(gorm.DefaultCallback.RowQuery, "gorm:row_query", "row_query")
+	registerQueryMetrics(gorm.DefaultCallback.Update, "gorm:update", "update")
+	registerQueryMetrics(gorm.DefaultCallback.Delete, "gorm:delete", "delete")
+}
+
+var metricsHandlerOnce sync.Once
+var metricsHandler http.Handler
+
+// getMetricsHandler returns handler of metrics registry. Stats of database
+// connection pools are registered on first call, because pools are opened lazily.
+func getMetricsHandler() http.Handler {
+	metricsHandlerOnce.Do(func() {
+		metricsRegistry.MustRegister(
+			collectors.NewDBStatsCollector(getSqlDB(), "sqlite"),
+			collectors.NewDBStatsCollector(getMutationSqlDB(), "sqlite_mutations"),
+		)
+		metricsHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+	})
+	return metricsHandler
+}
+
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	getMetricsHandler().ServeHTTP(w, r)
+}
+
+// serveAdminMetrics serves /metrics on METRICS_ADDR without authentication
+func serveAdminMetrics() {
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("/metrics", serveMetrics)
+	log.Fatal(http.ListenAndServe(METRICS_ADDR, adminMux))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	req, _ := http.NewRequest("GET", "/locations/1/avg", nil)
+	executeRequest(req)
+	req, _ = http.NewRequest("GET", "/locations/1/avg?fromDate=1400000000", nil)
+	executeRequest(req)
+	for i := 0; i < 2; i++ {
+		req, _ = http.NewRequest("POST", "/users/new", strings.NewReader(`{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`))
+		req.Header.Set(IDEMPOTENCY_KEY_HEADER, "metrics-key")
+		checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	}
+	req, _ = http.NewRequest("GET", "/no/such/route/here", nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+	req, _ = http.NewRequest("DELETE", "/metrics", nil)
+	checkResponseCode(t, http.StatusMethodNotAllowed, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	body := response.Body.String()
+	for _, expected := range []string{
+		`http_requests_total{method="POST",route="/{entity}/new",status="200"}`,
+		`http_request_duration_seconds_bucket{method="GET",route="/locations/{id}/avg",status="200",le="+Inf"}`,
+		`db_query_duration_seconds_count{operation="create"}`,
+		`cache_requests_total{cache="location_marks",result="hit"}`,
+		`cache_requests_total{cache="location_marks",result="miss"}`,
+		`cache_requests_total{cache="idempotency",result="hit"}`,
+		`cache_requests_total{cache="idempotency",result="miss"}`,
+		`http_requests_total{method="GET",route="unmatched",status="404"}`,
+		`http_requests_total{method="DELETE",route="unmatched",status="405"}`,
+		`go_sql_open_connections{db_name="sqlite"}`,
+		`go_sql_open_connections{db_name="sqlite_mutations"}`,
+		"go_goroutines ",
+		"process_start_time_seconds ",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain '%s'", expected)
+		}
+	}
+
+	readerKey, _, _ := CreateApiKey("reader", ROLE_READER, 0)
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	req.Header.Set(API_KEY_HEADER, readerKey)
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+}
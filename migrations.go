@@ -0,0 +1,239 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// migration changes the schema of an existing database. Migrations are applied
+// in order and the number of applied ones is kept in schema_migrations table.
+type migration func(db *gorm.DB) error
+
+var migrations = []migration{
+	migrateLocationMarks,
+	migrateVisitsIndexes,
+	migrateApiKeys,
+	migrateApiKeysRoles,
+	migrateAuditLog,
+	migrateSoftDelete,
+	migrateVersions,
+	migrateIdempotencyKeys,
+	migrateWebhooks,
+	migrateOutbox,
+	migrateWebhookCursors,
+}
+
+const schemaMigrationsCreationQuery = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+version INTEGER NOT NULL
+);
+`
+
+func getSchemaVersion(db *gorm.DB) (int, error) {
+	if !db.HasTable("schema_migrations") {
+		return 0, nil
+	}
+	var version struct{ Version int }
+	err := db.Raw("SELECT COALESCE(MAX(version), 0) AS version FROM schema_migrations").Scan(&version).Error
+	return version.Version, err
+}
+
+// getMigrationName returns name of function of migration, e.g. migrateOutbox
+func getMigrationName(i int) string {
+	name := runtime.FuncForPC(reflect.ValueOf(migrations[i]).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func MigrateDb() error {
+	db := InitDb()
+	defer db.Close()
+
+	return migrateDb(db)
+}
+
+// migrateDb applies migrations which aren't applied to db yet
+func migrateDb(db *gorm.DB) error {
+	if err := db.Exec(schemaMigrationsCreationQuery).Error; err != nil {
+		return err
+	}
+
+	version, err := getSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx := db.Begin()
+		if err := migrations[i](tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", i+1).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit().Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrations use only SQL, so they don't change with models.
+
+// location_marks are filled from visits of existing users, birth year and
+// month are taken in local time like in getUserBirthMonth
+func migrateLocationMarks(db *gorm.DB) error {
+	return db.Exec(`
+CREATE TABLE location_marks (
+location INT(32),
+gender VARCHAR(1),
+birth_year INT(32),
+birth_month INT(32),
+marks_sum INT(32),
+marks_cnt INT(32),
+PRIMARY KEY (location, gender, birth_year, birth_month)
+);
+INSERT INTO location_marks (location, gender, birth_year, birth_month, marks_sum, marks_cnt)
+SELECT visits.location, users.gender,
+CAST(strftime('%Y', CAST(users.birth_date AS INTEGER), 'unixepoch', 'localtime') AS INTEGER),
+CAST(strftime('%m', CAST(users.birth_date AS INTEGER), 'unixepoch', 'localtime') AS INTEGER),
+SUM(visits.mark), COUNT(*)
+FROM visits JOIN users ON users.id = visits.user
+GROUP BY 1, 2, 3, 4;
+`).Error
+}
+
+func migrateVisitsIndexes(db *gorm.DB) error {
+	return db.Exec(`
+CREATE INDEX visits_user ON visits (user);
+CREATE INDEX visits_location ON visits (location);
+`).Error
+}
+
+func migrateApiKeys(db *gorm.DB) error {
+	return db.Exec(`
+CREATE TABLE api_keys (
+id INTEGER PRIMARY KEY AUTOINCREMENT,
+name VARCHAR(100),
+key_hash VARCHAR(64) UNIQUE,
+created_at INT(32)
+);
+`).Error
+}
+
+// keys created before roles were introduced get the least privileged role,
+// they're upgraded with "apikey role" command
+func migrateApiKeysRoles(db *gorm.DB) error {
+	return db.Exec(`
+ALTER TABLE api_keys ADD COLUMN role VARCHAR(10) NOT NULL DEFAULT 'reader';
+ALTER TABLE api_keys ADD COLUMN user_id INT(32) NOT NULL DEFAULT 0;
+`).Error
+}
+
+func migrateAuditLog(db *gorm.DB) error {
+	return db.Exec(`
+CREATE TABLE audit_log (
+id INTEGER PRIMARY KEY AUTOINCREMENT,
+actor VARCHAR(100),
+request_id VARCHAR(100),
+entity VARCHAR(20),
+entity_id INT(32),
+operation VARCHAR(10),
+timestamp INT(32),
+before TEXT,
+after TEXT
+);
+CREATE INDEX audit_log_entity ON audit_log (entity, entity_id);
+CREATE INDEX audit_log_timestamp ON audit_log (timestamp);
+`).Error
+}
+
+// nothing is deleted yet, so location_marks don't change
+func migrateSoftDelete(db *gorm.DB) error {
+	return db.Exec(`
+ALTER TABLE users ADD COLUMN deleted_at DATETIME;
+ALTER TABLE locations ADD COLUMN deleted_at DATETIME;
+ALTER TABLE visits ADD COLUMN deleted_at DATETIME;
+`).Error
+}
+
+func migrateVersions(db *gorm.DB) error {
+	return db.Exec(`
+ALTER TABLE users ADD COLUMN version INT(32) NOT NULL DEFAULT 1;
+ALTER TABLE locations ADD COLUMN version INT(32) NOT NULL DEFAULT 1;
+ALTER TABLE visits ADD COLUMN version INT(32) NOT NULL DEFAULT 1;
+`).Error
+}
+
+func migrateIdempotencyKeys(db *gorm.DB) error {
+	return db.Exec(`
+CREATE TABLE idempotency_keys (
+client VARCHAR(100) NOT NULL,
+key VARCHAR(255) NOT NULL,
+fingerprint VARCHAR(64),
+status_code INT(32),
+body TEXT,
+created_at INT(32),
+PRIMARY KEY (client, key)
+);
+CREATE INDEX idempotency_keys_created_at ON idempotency_keys (created_at);
+`).Error
+}
+
+func migrateWebhooks(db *gorm.DB) error {
+	return db.Exec(`
+CREATE TABLE webhooks (
+id INTEGER PRIMARY KEY AUTOINCREMENT,
+url VARCHAR(2048) NOT NULL,
+entity VARCHAR(20) NOT NULL DEFAULT '',
+secret VARCHAR(255) NOT NULL,
+created_at INT(32)
+);
+CREATE TABLE webhook_dead_letters (
+id INTEGER PRIMARY KEY AUTOINCREMENT,
+webhook_id INT(32),
+event_id INT(32),
+payload TEXT,
+attempts INT(32),
+error TEXT,
+created_at INT(32)
+);
+CREATE INDEX webhook_dead_letters_webhook_id ON webhook_dead_letters (webhook_id);
+`).Error
+}
+
+func migrateOutbox(db *gorm.DB) error {
+	return db.Exec(`
+CREATE TABLE outbox (
+id INTEGER PRIMARY KEY AUTOINCREMENT,
+event_id INT(32),
+entity VARCHAR(20),
+payload TEXT,
+created_at INT(32)
+);
+CREATE TABLE outbox_cursors (
+sink VARCHAR(50) PRIMARY KEY,
+last_id INT(32) NOT NULL DEFAULT 0,
+attempts INT(32) NOT NULL DEFAULT 0,
+last_error TEXT,
+next_attempt_at INTEGER NOT NULL DEFAULT 0,
+updated_at INT(32)
+);
+`).Error
+}
+
+// migrateWebhookCursors replaces cursor of webhook sink with cursors of every
+// webhook, which continue from it
+func migrateWebhookCursors(db *gorm.DB) error {
+	return db.Exec(`
+INSERT INTO outbox_cursors (sink, last_id, last_error, updated_at)
+SELECT 'webhook:' || id, COALESCE((SELECT last_id FROM outbox_cursors WHERE sink = 'webhook'),
+(SELECT COALESCE(MAX(id), 0) FROM outbox)), '', strftime('%s', 'now')
+FROM webhooks;
+DELETE FROM outbox_cursors WHERE sink = 'webhook';
+`).Error
+}
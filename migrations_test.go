@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+func TestMigrateOriginalSchema(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "migrations")
+	defer os.RemoveAll(dir)
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// database created before migrations
+	err = db.Exec(tablesCreationQuery + `
+INSERT INTO users (id, email, last_name, first_name, gender, birth_date) VALUES (1, 'a@mail.com', 'A', 'A', 'm', '631152000');
+INSERT INTO locations (id, place, country, city, distance) VALUES (1, 'Red Square', 'Russia', 'Moscow', 10);
+INSERT INTO visits (id, location, user, visited_at, mark) VALUES (1, 1, 1, '1500000000', 5), (2, 1, 1, '1500000001', 3), (3, 1, 2, '1500000002', 4);
+`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := migrateDb(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if version, _ := getSchemaVersion(db); version != len(migrations) {
+		t.Errorf("Expected schema version %d. Got %d", len(migrations), version)
+	}
+
+	// marks of visits of existing users are aggregated
+	year, month := getUserBirthMonth(User{BirthDate: 631152000})
+	var marks []LocationMarks
+	db.Find(&marks)
+	expected := LocationMarks{Location: 1, Gender: "m", BirthYear: year, BirthMonth: month, MarksSum: 8, MarksCnt: 2}
+	if len(marks) != 1 || marks[0] != expected {
+		t.Errorf("Expected location marks %+v. Got %+v", expected, marks)
+	}
+}
+
+func TestMigrateWebhookCursors(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "migrations")
+	defer os.RemoveAll(dir)
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// database with cursor of webhook sink
+	db.Exec(tablesCreationQuery + schemaMigrationsCreationQuery)
+	for i := 0; i < len(migrations)-1; i++ {
+		if err := migrations[i](db); err != nil {
+			t.Fatal(err)
+		}
+		db.Exec("INSERT INTO schema_migrations (version) VALUES (?)", i+1)
+	}
+	err = db.Exec(`
+INSERT INTO webhooks (id, url, secret) VALUES (1, 'http://example.com', 'secret'), (2, 'http://example.com', 'secret');
+INSERT INTO outbox_cursors (sink, last_id, last_error) VALUES ('webhook', 5, '');
+`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateDb(db); err != nil {
+		t.Fatal(err)
+	}
+	var cursors []OutboxCursor
+	db.Order("sink").Find(&cursors)
+	if len(cursors) != 2 || cursors[0].Sink != "webhook:1" || cursors[1].Sink != "webhook:2" ||
+		cursors[0].LastID != 5 || cursors[1].LastID != 5 {
+		t.Errorf("Expected cursors of webhooks continuing from webhook sink. Got %+v", cursors)
+	}
+}
+
+func TestMigrateApiKeysRoles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "migrations")
+	defer os.RemoveAll(dir)
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// database with key created before roles
+	db.Exec(tablesCreationQuery + schemaMigrationsCreationQuery)
+	for i := 0; reflect.ValueOf(migrations[i]).Pointer() != reflect.ValueOf(migrateApiKeysRoles).Pointer(); i++ {
+		if err := migrations[i](db); err != nil {
+			t.Fatal(err)
+		}
+		db.Exec("INSERT INTO schema_migrations (version) VALUES (?)", i+1)
+	}
+	if err := db.Exec("INSERT INTO api_keys (name, key_hash, created_at) VALUES ('old', 'hash', 0)").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateDb(db); err != nil {
+		t.Fatal(err)
+	}
+	var apiKey ApiKey
+	db.First(&apiKey)
+	if apiKey.Role != ROLE_READER {
+		t.Errorf("Expected old key to get %s role. Got %s", ROLE_READER, apiKey.Role)
+	}
+}
+
+func TestMigrateCommand(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "migrations")
+	defer os.RemoveAll(dir)
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Exec(tablesCreationQuery).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	cliOutput = &out
+	defer func() { cliOutput = os.Stdout }()
+	if err := runMigrations(db, true); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := getSchemaVersion(db); version != 0 || db.HasTable("location_marks") {
+		t.Errorf("Expected dry run not to apply migrations. Got version %d", version)
+	}
+	if !strings.Contains(out.String(), "Pending migration 1: migrateLocationMarks\n") || !strings.Contains(out.String(), "at version 0 of") {
+		t.Errorf("Expected pending migrations to be printed. Got %q", out.String())
+	}
+
+	out.Reset()
+	if err := runMigrations(db, false); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := getSchemaVersion(db); version != len(migrations) {
+		t.Errorf("Expected schema version %d. Got %d", len(migrations), version)
+	}
+	last := fmt.Sprintf("Applied migration %d: %s\n", len(migrations), getMigrationName(len(migrations)-1))
+	if !strings.Contains(out.String(), last) {
+		t.Errorf("Expected applied migrations to be printed. Got %q", out.String())
+	}
+
+	out.Reset()
+	runMigrations(db, true)
+	if strings.Contains(out.String(), "Pending") {
+		t.Errorf("Expected no pending migrations. Got %q", out.String())
+	}
+}
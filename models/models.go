@@ -0,0 +1,52 @@
+// Package models contains entities of the API, shared by server and client
+package models
+
+import (
+	"time"
+)
+
+// DeletedAt of models is set for soft deleted entities, gorm excludes them from
+// queries unless Unscoped is used. Version is incremented on every change.
+
+type User struct {
+	ID        int        `json:"id,omitempty"`
+	Email     string     `json:"email" validate:"nonzero"`
+	FirstName string     `json:"first_name" validate:"nonzero"`
+	LastName  string     `json:"last_name" validate:"nonzero"`
+	Gender    string     `json:"gender" validate:"nonzero"`
+	BirthDate int        `json:"birth_date" validate:"nonzero"`
+	Version   int        `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type Location struct {
+	ID        int        `json:"id,omitempty"`
+	Place     string     `json:"place"`
+	Country   string     `json:"country"`
+	City      string     `json:"city"`
+	Distance  int        `json:"distance"`
+	Version   int        `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type Visit struct {
+	ID        int        `json:"id,omitempty"`
+	Location  int        `json:"location" validate:"nonzero"`
+	User      int        `json:"user" validate:"nonzero"`
+	VisitedAt string     `json:"visited_at" validate:"nonzero"`
+	Mark      int        `json:"mark" validate:"nonzero"`
+	Version   int        `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (User) TableName() string {
+	return "users"
+}
+
+func (Visit) TableName() string {
+	return "visits"
+}
+
+func (Location) TableName() string {
+	return "locations"
+}
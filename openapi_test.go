@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+type openapiSchema struct {
+	Required   []string
+	Properties map[string]struct {
+		ReadOnly bool
+	}
+}
+
+type openapiParameter struct {
+	Ref  string `json:"$ref"`
+	Name string
+	In   string
+}
+
+type openapiDocument struct {
+	Paths      map[string]map[string]json.RawMessage
+	Components struct {
+		Schemas    map[string]openapiSchema
+		Parameters map[string]openapiParameter
+	}
+}
+
+// getOpenAPISpec returns spec served by API
+func readOpenAPISpec(t *testing.T) openapiDocument {
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var spec openapiDocument
+	if err := json.Unmarshal(response.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// getParameters returns "in name" of parameters of operation, including
+// parameters of its path
+func (spec openapiDocument) getParameters(path string, method string) map[string]bool {
+	parameters := make(map[string]bool)
+	for _, key := range []string{"parameters", method} {
+		var operation struct {
+			Parameters []openapiParameter
+		}
+		raw := spec.Paths[path][key]
+		if key == "parameters" {
+			json.Unmarshal(raw, &operation.Parameters)
+		} else {
+			json.Unmarshal(raw, &operation)
+		}
+		for _, parameter := range operation.Parameters {
+			if parameter.Ref != "" {
+				parameter = spec.Components.Parameters[strings.TrimPrefix(parameter.Ref, "#/components/parameters/")]
+			}
+			parameters[parameter.In+" "+parameter.Name] = true
+		}
+	}
+	return parameters
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	spec := readOpenAPISpec(t)
+
+	// routes of SetupHandlers and operations of spec must match
+	routes := make(map[string]bool)
+	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, _ := route.GetPathTemplate()
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("Route %s should be limited to methods", template)
+		}
+		for _, method := range methods {
+			routes[method+" "+template] = true
+			if _, ok := spec.Paths[template][strings.ToLower(method)]; !ok {
+				t.Errorf("Route %s %s isn't in OpenAPI spec", method, template)
+			}
+		}
+		return nil
+	})
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			if method != "parameters" && !routes[strings.ToUpper(method)+" "+path] {
+				t.Errorf("Operation %s %s of OpenAPI spec isn't routed", method, path)
+			}
+		}
+	}
+
+	// model schemas must have fields of models, required fields are the ones
+	// validated as nonzero
+	for _, model := range []interface{}{User{}, Location{}, Visit{}} {
+		modelType := reflect.TypeOf(model)
+		schema, ok := spec.Components.Schemas[modelType.Name()]
+		if !ok {
+			t.Errorf("Schema of %s isn't in OpenAPI spec", modelType.Name())
+			continue
+		}
+		var fields, required []string
+		for i := 0; i < modelType.NumField(); i++ {
+			field := modelType.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			fields = append(fields, name)
+			if field.Tag.Get("validate") == "nonzero" {
+				required = append(required, name)
+			}
+		}
+		var properties []string
+		for name, property := range schema.Properties {
+			properties = append(properties, name)
+			isReadOnly := false
+			for _, field := range readOnlyFields {
+				isReadOnly = isReadOnly || field == name
+			}
+			if property.ReadOnly != isReadOnly {
+				t.Errorf("readOnly of %s.%s in OpenAPI spec should be %v", modelType.Name(), name, isReadOnly)
+			}
+		}
+		sort.Strings(fields)
+		sort.Strings(properties)
+		sort.Strings(required)
+		sort.Strings(schema.Required)
+		if !reflect.DeepEqual(fields, properties) {
+			t.Errorf("Expected properties of %s in OpenAPI spec to be %v. Got %v", modelType.Name(), fields, properties)
+		}
+		if !reflect.DeepEqual(required, schema.Required) {
+			t.Errorf("Expected required fields of %s in OpenAPI spec to be %v. Got %v", modelType.Name(), required, schema.Required)
+		}
+	}
+}
+
+func TestSwaggerUI(t *testing.T) {
+	response := executePublicRequest("GET", "/docs")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if !strings.Contains(response.Body.String(), "/openapi.json") {
+		t.Errorf("Expected Swagger UI page to load /openapi.json")
+	}
+	if strings.Contains(response.Body.String(), "https://") {
+		t.Errorf("Expected Swagger UI page to load only files of server")
+	}
+
+	for file, contentType := range map[string]string{"swagger-ui.css": "text/css", "swagger-ui-bundle.js": "javascript"} {
+		response = executePublicRequest("GET", "/docs/"+file)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		if !strings.Contains(response.Header().Get("Content-Type"), contentType) || response.Body.Len() == 0 {
+			t.Errorf("Expected %s to be served as %s. Got %s", file, contentType, response.Header().Get("Content-Type"))
+		}
+	}
+	checkResponseCode(t, http.StatusNotFound, executePublicRequest("GET", "/docs/index.html").Code)
+}
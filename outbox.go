@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// outbox entries read from database at once
+	OUTBOX_BATCH_SIZE = 100
+	// outbox is checked with this interval in case wake up was missed, e.g.
+	// entries were written by CLI commands
+	OUTBOX_POLL_INTERVAL = time.Second
+)
+
+// OutboxEntry is an event written in the same transaction as the change
+type OutboxEntry struct {
+	ID        int
+	EventID   int
+	Entity    string
+	Payload   string
+	CreatedAt int
+}
+
+func (OutboxEntry) TableName() string {
+	return "outbox"
+}
+
+// OutboxCursor is delivery state of sink. Entries up to LastID are delivered,
+// the next one failed Attempts times and is retried at NextAttemptAt (Unix
+// time in milliseconds).
+type OutboxCursor struct {
+	Sink          string `gorm:"primary_key"`
+	LastID        int
+	Attempts      int
+	LastError     string
+	NextAttemptAt int64
+	UpdatedAt     int
+}
+
+func (OutboxCursor) TableName() string {
+	return "outbox_cursors"
+}
+
+// OutboxSink delivers events of outbox. Failed deliveries are retried until
+// they succeed, so events may be delivered more than once.
+type OutboxSink interface {
+	Deliver(e Event) error
+}
+
+// outboxRetryPolicy is implemented by sinks which skip events after some
+// attempts instead of retrying them until they're delivered
+type outboxRetryPolicy interface {
+	// RetryDelay returns delay before the next attempt
+	RetryDelay(attempts int) time.Duration
+	// GiveUp is called after failed attempt and returns true if event is skipped
+	GiveUp(e Event, attempts int, err error) bool
+}
+
+// writerSink writes events as JSON lines
+type writerSink struct {
+	w io.Writer
+}
+
+func (s *writerSink) Deliver(e Event) error {
+	return json.NewEncoder(s.w).Encode(e)
+}
+
+// initOutbox returns sinks of OUTBOX_SINKS: "webhook", "stdout" or "file",
+// separated by commas, and whether webhooks are enabled. Webhooks have sinks
+// of their own, which are started with startWebhookWorkers.
+func initOutbox() (map[string]OutboxSink, bool, error) {
+	sinks := make(map[string]OutboxSink)
+	webhooks := false
+	for _, name := range strings.Split(OUTBOX_SINKS, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+			continue
+		case "webhook":
+			webhooks = true
+		case "stdout":
+			sinks[name] = &writerSink{os.Stdout}
+		case "file":
+			file, err := openRotatingFile(OUTBOX_FILE_PATH, int64(LOG_MAX_SIZE_MB)<<20, LOG_MAX_BACKUPS)
+			if err != nil {
+				return nil, false, err
+			}
+			sinks[name] = &writerSink{file}
+		default:
+			return nil, false, errors.New("OUTBOX_SINKS must be webhook, stdout or file")
+		}
+	}
+	return sinks, webhooks, nil
+}
+
+func writeOutbox(tx *gorm.DB, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&OutboxEntry{EventID: e.ID, Entity: e.Entity, Payload: string(payload), CreatedAt: e.Timestamp}).Error
+}
+
+// outboxWorker has channels which wake up and stop worker of sink
+type outboxWorker struct {
+	notify chan struct{}
+	stop   chan struct{}
+}
+
+// outboxDispatcher keeps workers of running sinks by their names
+var outboxDispatcher = struct {
+	sync.Mutex
+	workers map[string]*outboxWorker
+	// workers of webhooks are started and stopped with them
+	webhooks bool
+}{workers: make(map[string]*outboxWorker)}
+
+// wakeOutbox notifies workers about committed entries without waiting
+func wakeOutbox() {
+	outboxDispatcher.Lock()
+	defer outboxDispatcher.Unlock()
+
+	for _, worker := range outboxDispatcher.workers {
+		select {
+		case worker.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// startOutboxDispatcher starts worker for each sink. Workers deliver entries
+// in order and independently, so failing sink doesn't delay others.
+func startOutboxDispatcher(sinks map[string]OutboxSink) {
+	for name, sink := range sinks {
+		startOutboxWorker(name, sink)
+	}
+}
+
+// startOutboxWorker starts worker of sink unless it's running
+func startOutboxWorker(name string, sink OutboxSink) {
+	outboxDispatcher.Lock()
+	defer outboxDispatcher.Unlock()
+
+	if _, ok := outboxDispatcher.workers[name]; ok {
+		return
+	}
+	worker := &outboxWorker{notify: make(chan struct{}, 1), stop: make(chan struct{})}
+	outboxDispatcher.workers[name] = worker
+	go runOutboxWorker(name, sink, worker)
+}
+
+// stopOutboxWorker stops worker of sink after delivery in progress
+func stopOutboxWorker(name string) {
+	outboxDispatcher.Lock()
+	defer outboxDispatcher.Unlock()
+
+	if worker, ok := outboxDispatcher.workers[name]; ok {
+		close(worker.stop)
+		delete(outboxDispatcher.workers, name)
+	}
+}
+
+// getOutboxSinks returns sorted names of running sinks
+func getOutboxSinks() []string {
+	outboxDispatcher.Lock()
+	defer outboxDispatcher.Unlock()
+
+	sinks := make([]string, 0, len(outboxDispatcher.workers))
+	for name := range outboxDispatcher.workers {
+		sinks = append(sinks, name)
+	}
+	sort.Strings(sinks)
+	return sinks
+}
+
+func runOutboxWorker(name string, sink OutboxSink, worker *outboxWorker) {
+	for {
+		wait := deliverOutbox(name, sink, worker.stop)
+		select {
+		case <-worker.notify:
+		case <-time.After(wait):
+		case <-worker.stop:
+			return
+		}
+	}
+}
+
+// getOutboxRetryDelay doubles OUTBOX_RETRY_DELAY_MS after each attempt up to
+// OUTBOX_MAX_RETRY_DELAY_MS
+func getOutboxRetryDelay(attempts int) time.Duration {
+	delay := time.Duration(OUTBOX_RETRY_DELAY_MS) * time.Millisecond
+	maxDelay := time.Duration(OUTBOX_MAX_RETRY_DELAY_MS) * time.Millisecond
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// deliverOutbox delivers entries after cursor of sink until worker is stopped
+// and returns time to wait before the next check. SQLite commits transactions
+// one by one, so entries with lower ids than delivered ones aren't committed
+// later.
+func deliverOutbox(name string, sink OutboxSink, stop chan struct{}) time.Duration {
+	db := InitDb()
+	defer db.Close()
+	db.LogMode(false)
+
+	var cursor OutboxCursor
+	if err := db.Where(OutboxCursor{Sink: name}).FirstOrInit(&cursor).Error; err != nil {
+		log.WithFields(log.Fields{"module": "outbox", "sink": name}).Error(err)
+		return OUTBOX_POLL_INTERVAL
+	}
+	if wait := time.Until(time.Unix(0, cursor.NextAttemptAt*int64(time.Millisecond))); wait > 0 {
+		return wait
+	}
+
+	for {
+		var entries []OutboxEntry
+		if err := db.Where("id > ?", cursor.LastID).Order("id").Limit(OUTBOX_BATCH_SIZE).Find(&entries).Error; err != nil {
+			log.WithFields(log.Fields{"module": "outbox", "sink": name}).Error(err)
+			return OUTBOX_POLL_INTERVAL
+		}
+		for _, entry := range entries {
+			select {
+			case <-stop:
+				return OUTBOX_POLL_INTERVAL
+			default:
+			}
+			var e Event
+			err := json.Unmarshal([]byte(entry.Payload), &e)
+			if err == nil {
+				err = sink.Deliver(e)
+			}
+			if err != nil {
+				cursor.Attempts++
+				log.WithFields(log.Fields{"module": "outbox", "sink": name, "event_id": e.ID,
+					"attempt": cursor.Attempts}).Warn(err)
+				policy, ok := sink.(outboxRetryPolicy)
+				if !ok || !policy.GiveUp(e, cursor.Attempts, err) {
+					delay := getOutboxRetryDelay(cursor.Attempts)
+					if ok {
+						delay = policy.RetryDelay(cursor.Attempts)
+					}
+					cursor.LastError = err.Error()
+					cursor.NextAttemptAt = time.Now().Add(delay).UnixNano() / int64(time.Millisecond)
+					saveOutboxCursor(db, &cursor)
+					return delay
+				}
+			}
+			cursor.LastID, cursor.Attempts, cursor.LastError, cursor.NextAttemptAt = entry.ID, 0, "", 0
+			if !saveOutboxCursor(db, &cursor) {
+				return OUTBOX_POLL_INTERVAL
+			}
+		}
+		if len(entries) < OUTBOX_BATCH_SIZE {
+			return OUTBOX_POLL_INTERVAL
+		}
+	}
+}
+
+func saveOutboxCursor(db *gorm.DB, cursor *OutboxCursor) bool {
+	cursor.UpdatedAt = int(time.Now().Unix())
+	if err := db.Save(cursor).Error; err != nil {
+		log.WithFields(log.Fields{"module": "outbox", "sink": cursor.Sink}).Error(err)
+		return false
+	}
+	return true
+}
+
+// PruneOutbox removes entries delivered to all running sinks and registered
+// webhooks. Cursors of webhooks start at the last entry when they're created,
+// so entries are removed if there are no sinks and webhooks.
+func PruneOutbox() error {
+	outboxDispatcher.Lock()
+	var sinks []string
+	for name := range outboxDispatcher.workers {
+		if !strings.HasPrefix(name, WEBHOOK_SINK_PREFIX) {
+			sinks = append(sinks, name)
+		}
+	}
+	webhooks := outboxDispatcher.webhooks
+	outboxDispatcher.Unlock()
+	if len(sinks) == 0 && !webhooks {
+		return nil
+	}
+
+	db := InitDb()
+	defer db.Close()
+
+	var count int
+	if err := db.Model(&OutboxCursor{}).Where("sink IN (?)", sinks).Count(&count).Error; err != nil {
+		return err
+	}
+	if count < len(sinks) {
+		// nothing was delivered to some sink yet
+		return nil
+	}
+	cursors := "sink IN (?)"
+	if webhooks {
+		cursors += " OR sink IN (SELECT '" + WEBHOOK_SINK_PREFIX + "' || id FROM webhooks)"
+	}
+	// cursors are read in the same statement, so cursor of webhook created
+	// meanwhile isn't missed
+	return db.Exec(`DELETE FROM outbox WHERE id <= COALESCE(
+(SELECT MIN(last_id) FROM outbox_cursors WHERE `+cursors+`), (SELECT MAX(id) FROM outbox))`, sinks).Error
+}
+
+func runOutboxPruning() {
+	for {
+		if err := PruneOutbox(); err != nil {
+			log.WithFields(log.Fields{"module": "outbox"}).Error(err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// getOutboxLag shows delivery state and lag of running sinks
+func getOutboxLag(w http.ResponseWriter, r *http.Request) {
+	db := InitRequestDb(r)
+	defer db.Close()
+
+	sinks := getOutboxSinks()
+
+	var last OutboxEntry
+	db.Order("id desc").First(&last)
+
+	res := make([]map[string]interface{}, 0, len(sinks))
+	for _, name := range sinks {
+		var cursor OutboxCursor
+		db.Where(OutboxCursor{Sink: name}).FirstOrInit(&cursor)
+		var lag int
+		db.Model(&OutboxEntry{}).Where("id > ?", cursor.LastID).Count(&lag)
+		oldestPendingSeconds := 0
+		var oldest OutboxEntry
+		if lag > 0 && db.Where("id > ?", cursor.LastID).Order("id").First(&oldest).Error == nil {
+			oldestPendingSeconds = int(time.Now().Unix()) - oldest.CreatedAt
+		}
+		res = append(res, map[string]interface{}{
+			"sink":                   name,
+			"last_id":                cursor.LastID,
+			"lag":                    lag,
+			"oldest_pending_seconds": oldestPendingSeconds,
+			"attempts":               cursor.Attempts,
+			"last_error":             cursor.LastError,
+			"next_attempt_at":        cursor.NextAttemptAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"last_id": last.ID, "sinks": res})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// waitForOutbox waits until all outbox entries are delivered to sink
+func waitForOutbox(t *testing.T, sink string) {
+	waitFor(t, func() bool {
+		var last OutboxEntry
+		var cursor OutboxCursor
+		db.Order("id desc").First(&last)
+		db.Where(OutboxCursor{Sink: sink}).FirstOrInit(&cursor)
+		return cursor.LastID >= last.ID
+	})
+}
+
+// testSink fails deliveries while failing is set
+type testSink struct {
+	mu      sync.Mutex
+	failing bool
+	events  []Event
+}
+
+func (s *testSink) Deliver(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return errors.New("Sink is down")
+	}
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *testSink) setFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+func (s *testSink) getEvents() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+func getOutboxSinkLag(t *testing.T, sink string) map[string]interface{} {
+	req, _ := http.NewRequest("GET", "/outbox", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var res struct {
+		LastID int `json:"last_id"`
+		Sinks  []map[string]interface{}
+	}
+	json.Unmarshal(response.Body.Bytes(), &res)
+	for _, s := range res.Sinks {
+		if s["sink"] == sink {
+			return s
+		}
+	}
+	t.Fatalf("Expected sink %s in %s", sink, response.Body.String())
+	return nil
+}
+
+func TestOutbox(t *testing.T) {
+	ClearDB()
+	defer func(delay int) { OUTBOX_RETRY_DELAY_MS = delay }(OUTBOX_RETRY_DELAY_MS)
+	OUTBOX_RETRY_DELAY_MS = 1
+
+	// sink started later gets entries written before it
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Place", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	var entry OutboxEntry
+	db.Order("id desc").First(&entry)
+	var record AuditRecord
+	db.Order("id desc").First(&record)
+	if entry.EventID != record.ID || entry.Entity != "locations" {
+		t.Errorf("Expected outbox entry of audited change. Got %+v", entry)
+	}
+
+	sink := &testSink{failing: true}
+	startOutboxDispatcher(map[string]OutboxSink{"test": sink})
+	waitFor(t, func() bool {
+		lag := getOutboxSinkLag(t, "test")
+		return lag["attempts"].(float64) >= 2
+	})
+	lag := getOutboxSinkLag(t, "test")
+	if lag["lag"].(float64) == 0 || lag["last_error"] != "Sink is down" {
+		t.Errorf("Expected lag and error of failing sink. Got %v", lag)
+	}
+
+	// failed entry is retried and the next ones are delivered in order
+	postJSON(t, "/locations/1", `{"distance": 20}`)
+	sink.setFailing(false)
+	waitForOutbox(t, "test")
+	received := sink.getEvents()
+	if n := len(received); n < 2 || received[n-2].ID != record.ID || received[n-1].Type != EVENT_UPDATED {
+		t.Errorf("Expected created and updated location events in order. Got %+v", received)
+	}
+	for i := 1; i < len(received); i++ {
+		if received[i].ID <= received[i-1].ID {
+			t.Errorf("Expected events ordered by id. Got %+v", received)
+		}
+	}
+	lag = getOutboxSinkLag(t, "test")
+	if lag["lag"] != float64(0) || lag["attempts"] != float64(0) || lag["last_error"] != "" {
+		t.Errorf("Expected no lag after delivery. Got %v", lag)
+	}
+
+	// delivered entries are pruned
+	if err := PruneOutbox(); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	db.Model(&OutboxEntry{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected delivered entries to be pruned. Got %d", count)
+	}
+}
+
+func TestOutboxRollback(t *testing.T) {
+	ClearDB()
+	var before int
+	db.Model(&OutboxEntry{}).Count(&before)
+
+	// entry isn't written if change fails
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Place", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	req, _ := http.NewRequest("POST", "/locations/1", strings.NewReader(`{"distance": 20}`))
+	req.Header.Set("If-Match", `"5"`)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusPreconditionFailed, response.Code)
+	var after int
+	db.Model(&OutboxEntry{}).Count(&after)
+	if after > before+1 {
+		t.Errorf("Expected only entry of created location. Got %d new entries", after-before)
+	}
+}
@@ -0,0 +1,1327 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: rest_app.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type User struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Id        int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Email     string                 `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	FirstName string                 `protobuf:"bytes,3,opt,name=first_name,json=firstName,proto3" json:"first_name,omitempty"`
+	LastName  string                 `protobuf:"bytes,4,opt,name=last_name,json=lastName,proto3" json:"last_name,omitempty"`
+	// "f" or "m"
+	Gender string `protobuf:"bytes,5,opt,name=gender,proto3" json:"gender,omitempty"`
+	// unix timestamp
+	BirthDate     int64 `protobuf:"varint,6,opt,name=birth_date,json=birthDate,proto3" json:"birth_date,omitempty"`
+	Version       int32 `protobuf:"varint,7,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *User) Reset() {
+	*x = User{}
+	mi := &file_rest_app_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *User) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*User) ProtoMessage() {}
+
+func (x *User) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use User.ProtoReflect.Descriptor instead.
+func (*User) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *User) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *User) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *User) GetFirstName() string {
+	if x != nil {
+		return x.FirstName
+	}
+	return ""
+}
+
+func (x *User) GetLastName() string {
+	if x != nil {
+		return x.LastName
+	}
+	return ""
+}
+
+func (x *User) GetGender() string {
+	if x != nil {
+		return x.Gender
+	}
+	return ""
+}
+
+func (x *User) GetBirthDate() int64 {
+	if x != nil {
+		return x.BirthDate
+	}
+	return 0
+}
+
+func (x *User) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type Location struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Place         string                 `protobuf:"bytes,2,opt,name=place,proto3" json:"place,omitempty"`
+	Country       string                 `protobuf:"bytes,3,opt,name=country,proto3" json:"country,omitempty"`
+	City          string                 `protobuf:"bytes,4,opt,name=city,proto3" json:"city,omitempty"`
+	Distance      int32                  `protobuf:"varint,5,opt,name=distance,proto3" json:"distance,omitempty"`
+	Version       int32                  `protobuf:"varint,6,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Location) Reset() {
+	*x = Location{}
+	mi := &file_rest_app_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Location) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Location) ProtoMessage() {}
+
+func (x *Location) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Location.ProtoReflect.Descriptor instead.
+func (*Location) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Location) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Location) GetPlace() string {
+	if x != nil {
+		return x.Place
+	}
+	return ""
+}
+
+func (x *Location) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *Location) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *Location) GetDistance() int32 {
+	if x != nil {
+		return x.Distance
+	}
+	return 0
+}
+
+func (x *Location) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type Visit struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Id       int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Location int32                  `protobuf:"varint,2,opt,name=location,proto3" json:"location,omitempty"`
+	User     int32                  `protobuf:"varint,3,opt,name=user,proto3" json:"user,omitempty"`
+	// unix timestamp
+	VisitedAt     string `protobuf:"bytes,4,opt,name=visited_at,json=visitedAt,proto3" json:"visited_at,omitempty"`
+	Mark          int32  `protobuf:"varint,5,opt,name=mark,proto3" json:"mark,omitempty"`
+	Version       int32  `protobuf:"varint,6,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Visit) Reset() {
+	*x = Visit{}
+	mi := &file_rest_app_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Visit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Visit) ProtoMessage() {}
+
+func (x *Visit) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Visit.ProtoReflect.Descriptor instead.
+func (*Visit) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Visit) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Visit) GetLocation() int32 {
+	if x != nil {
+		return x.Location
+	}
+	return 0
+}
+
+func (x *Visit) GetUser() int32 {
+	if x != nil {
+		return x.User
+	}
+	return 0
+}
+
+func (x *Visit) GetVisitedAt() string {
+	if x != nil {
+		return x.VisitedAt
+	}
+	return ""
+}
+
+func (x *Visit) GetMark() int32 {
+	if x != nil {
+		return x.Mark
+	}
+	return 0
+}
+
+func (x *Visit) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type UserFields struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Email         *string                `protobuf:"bytes,1,opt,name=email,proto3,oneof" json:"email,omitempty"`
+	FirstName     *string                `protobuf:"bytes,2,opt,name=first_name,json=firstName,proto3,oneof" json:"first_name,omitempty"`
+	LastName      *string                `protobuf:"bytes,3,opt,name=last_name,json=lastName,proto3,oneof" json:"last_name,omitempty"`
+	Gender        *string                `protobuf:"bytes,4,opt,name=gender,proto3,oneof" json:"gender,omitempty"`
+	BirthDate     *int64                 `protobuf:"varint,5,opt,name=birth_date,json=birthDate,proto3,oneof" json:"birth_date,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserFields) Reset() {
+	*x = UserFields{}
+	mi := &file_rest_app_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserFields) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserFields) ProtoMessage() {}
+
+func (x *UserFields) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserFields.ProtoReflect.Descriptor instead.
+func (*UserFields) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *UserFields) GetEmail() string {
+	if x != nil && x.Email != nil {
+		return *x.Email
+	}
+	return ""
+}
+
+func (x *UserFields) GetFirstName() string {
+	if x != nil && x.FirstName != nil {
+		return *x.FirstName
+	}
+	return ""
+}
+
+func (x *UserFields) GetLastName() string {
+	if x != nil && x.LastName != nil {
+		return *x.LastName
+	}
+	return ""
+}
+
+func (x *UserFields) GetGender() string {
+	if x != nil && x.Gender != nil {
+		return *x.Gender
+	}
+	return ""
+}
+
+func (x *UserFields) GetBirthDate() int64 {
+	if x != nil && x.BirthDate != nil {
+		return *x.BirthDate
+	}
+	return 0
+}
+
+type LocationFields struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Place         *string                `protobuf:"bytes,1,opt,name=place,proto3,oneof" json:"place,omitempty"`
+	Country       *string                `protobuf:"bytes,2,opt,name=country,proto3,oneof" json:"country,omitempty"`
+	City          *string                `protobuf:"bytes,3,opt,name=city,proto3,oneof" json:"city,omitempty"`
+	Distance      *int32                 `protobuf:"varint,4,opt,name=distance,proto3,oneof" json:"distance,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LocationFields) Reset() {
+	*x = LocationFields{}
+	mi := &file_rest_app_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LocationFields) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LocationFields) ProtoMessage() {}
+
+func (x *LocationFields) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LocationFields.ProtoReflect.Descriptor instead.
+func (*LocationFields) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *LocationFields) GetPlace() string {
+	if x != nil && x.Place != nil {
+		return *x.Place
+	}
+	return ""
+}
+
+func (x *LocationFields) GetCountry() string {
+	if x != nil && x.Country != nil {
+		return *x.Country
+	}
+	return ""
+}
+
+func (x *LocationFields) GetCity() string {
+	if x != nil && x.City != nil {
+		return *x.City
+	}
+	return ""
+}
+
+func (x *LocationFields) GetDistance() int32 {
+	if x != nil && x.Distance != nil {
+		return *x.Distance
+	}
+	return 0
+}
+
+type VisitFields struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Location      *int32                 `protobuf:"varint,1,opt,name=location,proto3,oneof" json:"location,omitempty"`
+	User          *int32                 `protobuf:"varint,2,opt,name=user,proto3,oneof" json:"user,omitempty"`
+	VisitedAt     *string                `protobuf:"bytes,3,opt,name=visited_at,json=visitedAt,proto3,oneof" json:"visited_at,omitempty"`
+	Mark          *int32                 `protobuf:"varint,4,opt,name=mark,proto3,oneof" json:"mark,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VisitFields) Reset() {
+	*x = VisitFields{}
+	mi := &file_rest_app_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VisitFields) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VisitFields) ProtoMessage() {}
+
+func (x *VisitFields) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VisitFields.ProtoReflect.Descriptor instead.
+func (*VisitFields) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *VisitFields) GetLocation() int32 {
+	if x != nil && x.Location != nil {
+		return *x.Location
+	}
+	return 0
+}
+
+func (x *VisitFields) GetUser() int32 {
+	if x != nil && x.User != nil {
+		return *x.User
+	}
+	return 0
+}
+
+func (x *VisitFields) GetVisitedAt() string {
+	if x != nil && x.VisitedAt != nil {
+		return *x.VisitedAt
+	}
+	return ""
+}
+
+func (x *VisitFields) GetMark() int32 {
+	if x != nil && x.Mark != nil {
+		return *x.Mark
+	}
+	return 0
+}
+
+type GetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_rest_app_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+// version isn't checked if it's 0, otherwise request fails with
+// FAILED_PRECONDITION if entity was modified after it
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Version       int32                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_rest_app_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *DeleteRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_rest_app_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{8}
+}
+
+type UpdateUserRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Fields        *UserFields            `protobuf:"bytes,2,opt,name=fields,proto3" json:"fields,omitempty"`
+	Version       int32                  `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateUserRequest) Reset() {
+	*x = UpdateUserRequest{}
+	mi := &file_rest_app_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateUserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateUserRequest) ProtoMessage() {}
+
+func (x *UpdateUserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateUserRequest.ProtoReflect.Descriptor instead.
+func (*UpdateUserRequest) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *UpdateUserRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *UpdateUserRequest) GetFields() *UserFields {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *UpdateUserRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type UpdateLocationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Fields        *LocationFields        `protobuf:"bytes,2,opt,name=fields,proto3" json:"fields,omitempty"`
+	Version       int32                  `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateLocationRequest) Reset() {
+	*x = UpdateLocationRequest{}
+	mi := &file_rest_app_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateLocationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateLocationRequest) ProtoMessage() {}
+
+func (x *UpdateLocationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateLocationRequest.ProtoReflect.Descriptor instead.
+func (*UpdateLocationRequest) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *UpdateLocationRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *UpdateLocationRequest) GetFields() *LocationFields {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *UpdateLocationRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type UpdateVisitRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Fields        *VisitFields           `protobuf:"bytes,2,opt,name=fields,proto3" json:"fields,omitempty"`
+	Version       int32                  `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateVisitRequest) Reset() {
+	*x = UpdateVisitRequest{}
+	mi := &file_rest_app_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateVisitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateVisitRequest) ProtoMessage() {}
+
+func (x *UpdateVisitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateVisitRequest.ProtoReflect.Descriptor instead.
+func (*UpdateVisitRequest) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *UpdateVisitRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *UpdateVisitRequest) GetFields() *VisitFields {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *UpdateVisitRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type ListRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRequest) Reset() {
+	*x = ListRequest{}
+	mi := &file_rest_app_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRequest) ProtoMessage() {}
+
+func (x *ListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRequest.ProtoReflect.Descriptor instead.
+func (*ListRequest) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{12}
+}
+
+type UserVisitsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	FromDate      int64                  `protobuf:"varint,2,opt,name=from_date,json=fromDate,proto3" json:"from_date,omitempty"`
+	ToDate        int64                  `protobuf:"varint,3,opt,name=to_date,json=toDate,proto3" json:"to_date,omitempty"`
+	Country       string                 `protobuf:"bytes,4,opt,name=country,proto3" json:"country,omitempty"`
+	ToDistance    int32                  `protobuf:"varint,5,opt,name=to_distance,json=toDistance,proto3" json:"to_distance,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserVisitsRequest) Reset() {
+	*x = UserVisitsRequest{}
+	mi := &file_rest_app_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserVisitsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserVisitsRequest) ProtoMessage() {}
+
+func (x *UserVisitsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserVisitsRequest.ProtoReflect.Descriptor instead.
+func (*UserVisitsRequest) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *UserVisitsRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *UserVisitsRequest) GetFromDate() int64 {
+	if x != nil {
+		return x.FromDate
+	}
+	return 0
+}
+
+func (x *UserVisitsRequest) GetToDate() int64 {
+	if x != nil {
+		return x.ToDate
+	}
+	return 0
+}
+
+func (x *UserVisitsRequest) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *UserVisitsRequest) GetToDistance() int32 {
+	if x != nil {
+		return x.ToDistance
+	}
+	return 0
+}
+
+type UserVisitsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Visits        []*Visit               `protobuf:"bytes,1,rep,name=visits,proto3" json:"visits,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserVisitsResponse) Reset() {
+	*x = UserVisitsResponse{}
+	mi := &file_rest_app_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserVisitsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserVisitsResponse) ProtoMessage() {}
+
+func (x *UserVisitsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserVisitsResponse.ProtoReflect.Descriptor instead.
+func (*UserVisitsResponse) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *UserVisitsResponse) GetVisits() []*Visit {
+	if x != nil {
+		return x.Visits
+	}
+	return nil
+}
+
+type LocationAvgRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	FromDate      int64                  `protobuf:"varint,2,opt,name=from_date,json=fromDate,proto3" json:"from_date,omitempty"`
+	ToDate        int64                  `protobuf:"varint,3,opt,name=to_date,json=toDate,proto3" json:"to_date,omitempty"`
+	FromAge       int32                  `protobuf:"varint,4,opt,name=from_age,json=fromAge,proto3" json:"from_age,omitempty"`
+	ToAge         int32                  `protobuf:"varint,5,opt,name=to_age,json=toAge,proto3" json:"to_age,omitempty"`
+	Gender        string                 `protobuf:"bytes,6,opt,name=gender,proto3" json:"gender,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LocationAvgRequest) Reset() {
+	*x = LocationAvgRequest{}
+	mi := &file_rest_app_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LocationAvgRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LocationAvgRequest) ProtoMessage() {}
+
+func (x *LocationAvgRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LocationAvgRequest.ProtoReflect.Descriptor instead.
+func (*LocationAvgRequest) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *LocationAvgRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *LocationAvgRequest) GetFromDate() int64 {
+	if x != nil {
+		return x.FromDate
+	}
+	return 0
+}
+
+func (x *LocationAvgRequest) GetToDate() int64 {
+	if x != nil {
+		return x.ToDate
+	}
+	return 0
+}
+
+func (x *LocationAvgRequest) GetFromAge() int32 {
+	if x != nil {
+		return x.FromAge
+	}
+	return 0
+}
+
+func (x *LocationAvgRequest) GetToAge() int32 {
+	if x != nil {
+		return x.ToAge
+	}
+	return 0
+}
+
+func (x *LocationAvgRequest) GetGender() string {
+	if x != nil {
+		return x.Gender
+	}
+	return ""
+}
+
+type LocationAvgResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Avg           float64                `protobuf:"fixed64,1,opt,name=avg,proto3" json:"avg,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LocationAvgResponse) Reset() {
+	*x = LocationAvgResponse{}
+	mi := &file_rest_app_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LocationAvgResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LocationAvgResponse) ProtoMessage() {}
+
+func (x *LocationAvgResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_rest_app_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LocationAvgResponse.ProtoReflect.Descriptor instead.
+func (*LocationAvgResponse) Descriptor() ([]byte, []int) {
+	return file_rest_app_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *LocationAvgResponse) GetAvg() float64 {
+	if x != nil {
+		return x.Avg
+	}
+	return 0
+}
+
+var File_rest_app_proto protoreflect.FileDescriptor
+
+const file_rest_app_proto_rawDesc = "" +
+	"\n" +
+	"\x0erest_app.proto\x12\n" +
+	"restapp.v1\"\xb9\x01\n" +
+	"\x04User\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x14\n" +
+	"\x05email\x18\x02 \x01(\tR\x05email\x12\x1d\n" +
+	"\n" +
+	"first_name\x18\x03 \x01(\tR\tfirstName\x12\x1b\n" +
+	"\tlast_name\x18\x04 \x01(\tR\blastName\x12\x16\n" +
+	"\x06gender\x18\x05 \x01(\tR\x06gender\x12\x1d\n" +
+	"\n" +
+	"birth_date\x18\x06 \x01(\x03R\tbirthDate\x12\x18\n" +
+	"\aversion\x18\a \x01(\x05R\aversion\"\x94\x01\n" +
+	"\bLocation\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x14\n" +
+	"\x05place\x18\x02 \x01(\tR\x05place\x12\x18\n" +
+	"\acountry\x18\x03 \x01(\tR\acountry\x12\x12\n" +
+	"\x04city\x18\x04 \x01(\tR\x04city\x12\x1a\n" +
+	"\bdistance\x18\x05 \x01(\x05R\bdistance\x12\x18\n" +
+	"\aversion\x18\x06 \x01(\x05R\aversion\"\x94\x01\n" +
+	"\x05Visit\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x1a\n" +
+	"\blocation\x18\x02 \x01(\x05R\blocation\x12\x12\n" +
+	"\x04user\x18\x03 \x01(\x05R\x04user\x12\x1d\n" +
+	"\n" +
+	"visited_at\x18\x04 \x01(\tR\tvisitedAt\x12\x12\n" +
+	"\x04mark\x18\x05 \x01(\x05R\x04mark\x12\x18\n" +
+	"\aversion\x18\x06 \x01(\x05R\aversion\"\xef\x01\n" +
+	"\n" +
+	"UserFields\x12\x19\n" +
+	"\x05email\x18\x01 \x01(\tH\x00R\x05email\x88\x01\x01\x12\"\n" +
+	"\n" +
+	"first_name\x18\x02 \x01(\tH\x01R\tfirstName\x88\x01\x01\x12 \n" +
+	"\tlast_name\x18\x03 \x01(\tH\x02R\blastName\x88\x01\x01\x12\x1b\n" +
+	"\x06gender\x18\x04 \x01(\tH\x03R\x06gender\x88\x01\x01\x12\"\n" +
+	"\n" +
+	"birth_date\x18\x05 \x01(\x03H\x04R\tbirthDate\x88\x01\x01B\b\n" +
+	"\x06_emailB\r\n" +
+	"\v_first_nameB\f\n" +
+	"\n" +
+	"_last_nameB\t\n" +
+	"\a_genderB\r\n" +
+	"\v_birth_date\"\xb0\x01\n" +
+	"\x0eLocationFields\x12\x19\n" +
+	"\x05place\x18\x01 \x01(\tH\x00R\x05place\x88\x01\x01\x12\x1d\n" +
+	"\acountry\x18\x02 \x01(\tH\x01R\acountry\x88\x01\x01\x12\x17\n" +
+	"\x04city\x18\x03 \x01(\tH\x02R\x04city\x88\x01\x01\x12\x1f\n" +
+	"\bdistance\x18\x04 \x01(\x05H\x03R\bdistance\x88\x01\x01B\b\n" +
+	"\x06_placeB\n" +
+	"\n" +
+	"\b_countryB\a\n" +
+	"\x05_cityB\v\n" +
+	"\t_distance\"\xb2\x01\n" +
+	"\vVisitFields\x12\x1f\n" +
+	"\blocation\x18\x01 \x01(\x05H\x00R\blocation\x88\x01\x01\x12\x17\n" +
+	"\x04user\x18\x02 \x01(\x05H\x01R\x04user\x88\x01\x01\x12\"\n" +
+	"\n" +
+	"visited_at\x18\x03 \x01(\tH\x02R\tvisitedAt\x88\x01\x01\x12\x17\n" +
+	"\x04mark\x18\x04 \x01(\x05H\x03R\x04mark\x88\x01\x01B\v\n" +
+	"\t_locationB\a\n" +
+	"\x05_userB\r\n" +
+	"\v_visited_atB\a\n" +
+	"\x05_mark\"\x1c\n" +
+	"\n" +
+	"GetRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\"9\n" +
+	"\rDeleteRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x05R\aversion\"\x10\n" +
+	"\x0eDeleteResponse\"m\n" +
+	"\x11UpdateUserRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12.\n" +
+	"\x06fields\x18\x02 \x01(\v2\x16.restapp.v1.UserFieldsR\x06fields\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x05R\aversion\"u\n" +
+	"\x15UpdateLocationRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x122\n" +
+	"\x06fields\x18\x02 \x01(\v2\x1a.restapp.v1.LocationFieldsR\x06fields\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x05R\aversion\"o\n" +
+	"\x12UpdateVisitRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12/\n" +
+	"\x06fields\x18\x02 \x01(\v2\x17.restapp.v1.VisitFieldsR\x06fields\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x05R\aversion\"\r\n" +
+	"\vListRequest\"\x94\x01\n" +
+	"\x11UserVisitsRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x1b\n" +
+	"\tfrom_date\x18\x02 \x01(\x03R\bfromDate\x12\x17\n" +
+	"\ato_date\x18\x03 \x01(\x03R\x06toDate\x12\x18\n" +
+	"\acountry\x18\x04 \x01(\tR\acountry\x12\x1f\n" +
+	"\vto_distance\x18\x05 \x01(\x05R\n" +
+	"toDistance\"?\n" +
+	"\x12UserVisitsResponse\x12)\n" +
+	"\x06visits\x18\x01 \x03(\v2\x11.restapp.v1.VisitR\x06visits\"\xa4\x01\n" +
+	"\x12LocationAvgRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x1b\n" +
+	"\tfrom_date\x18\x02 \x01(\x03R\bfromDate\x12\x17\n" +
+	"\ato_date\x18\x03 \x01(\x03R\x06toDate\x12\x19\n" +
+	"\bfrom_age\x18\x04 \x01(\x05R\afromAge\x12\x15\n" +
+	"\x06to_age\x18\x05 \x01(\x05R\x05toAge\x12\x16\n" +
+	"\x06gender\x18\x06 \x01(\tR\x06gender\"'\n" +
+	"\x13LocationAvgResponse\x12\x10\n" +
+	"\x03avg\x18\x01 \x01(\x01R\x03avg2\xd2\b\n" +
+	"\aRestApp\x123\n" +
+	"\aGetUser\x12\x16.restapp.v1.GetRequest\x1a\x10.restapp.v1.User\x120\n" +
+	"\n" +
+	"CreateUser\x12\x10.restapp.v1.User\x1a\x10.restapp.v1.User\x12=\n" +
+	"\n" +
+	"UpdateUser\x12\x1d.restapp.v1.UpdateUserRequest\x1a\x10.restapp.v1.User\x12C\n" +
+	"\n" +
+	"DeleteUser\x12\x19.restapp.v1.DeleteRequest\x1a\x1a.restapp.v1.DeleteResponse\x128\n" +
+	"\tListUsers\x12\x17.restapp.v1.ListRequest\x1a\x10.restapp.v1.User0\x01\x12;\n" +
+	"\vGetLocation\x12\x16.restapp.v1.GetRequest\x1a\x14.restapp.v1.Location\x12<\n" +
+	"\x0eCreateLocation\x12\x14.restapp.v1.Location\x1a\x14.restapp.v1.Location\x12I\n" +
+	"\x0eUpdateLocation\x12!.restapp.v1.UpdateLocationRequest\x1a\x14.restapp.v1.Location\x12G\n" +
+	"\x0eDeleteLocation\x12\x19.restapp.v1.DeleteRequest\x1a\x1a.restapp.v1.DeleteResponse\x12@\n" +
+	"\rListLocations\x12\x17.restapp.v1.ListRequest\x1a\x14.restapp.v1.Location0\x01\x125\n" +
+	"\bGetVisit\x12\x16.restapp.v1.GetRequest\x1a\x11.restapp.v1.Visit\x123\n" +
+	"\vCreateVisit\x12\x11.restapp.v1.Visit\x1a\x11.restapp.v1.Visit\x12@\n" +
+	"\vUpdateVisit\x12\x1e.restapp.v1.UpdateVisitRequest\x1a\x11.restapp.v1.Visit\x12D\n" +
+	"\vDeleteVisit\x12\x19.restapp.v1.DeleteRequest\x1a\x1a.restapp.v1.DeleteResponse\x12:\n" +
+	"\n" +
+	"ListVisits\x12\x17.restapp.v1.ListRequest\x1a\x11.restapp.v1.Visit0\x01\x12N\n" +
+	"\rGetUserVisits\x12\x1d.restapp.v1.UserVisitsRequest\x1a\x1e.restapp.v1.UserVisitsResponse\x12Q\n" +
+	"\x0eGetLocationAvg\x12\x1e.restapp.v1.LocationAvgRequest\x1a\x1f.restapp.v1.LocationAvgResponseB\rZ\vrest_app/pbb\x06proto3"
+
+var (
+	file_rest_app_proto_rawDescOnce sync.Once
+	file_rest_app_proto_rawDescData []byte
+)
+
+func file_rest_app_proto_rawDescGZIP() []byte {
+	file_rest_app_proto_rawDescOnce.Do(func() {
+		file_rest_app_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_rest_app_proto_rawDesc), len(file_rest_app_proto_rawDesc)))
+	})
+	return file_rest_app_proto_rawDescData
+}
+
+var file_rest_app_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
+var file_rest_app_proto_goTypes = []any{
+	(*User)(nil),                  // 0: restapp.v1.User
+	(*Location)(nil),              // 1: restapp.v1.Location
+	(*Visit)(nil),                 // 2: restapp.v1.Visit
+	(*UserFields)(nil),            // 3: restapp.v1.UserFields
+	(*LocationFields)(nil),        // 4: restapp.v1.LocationFields
+	(*VisitFields)(nil),           // 5: restapp.v1.VisitFields
+	(*GetRequest)(nil),            // 6: restapp.v1.GetRequest
+	(*DeleteRequest)(nil),         // 7: restapp.v1.DeleteRequest
+	(*DeleteResponse)(nil),        // 8: restapp.v1.DeleteResponse
+	(*UpdateUserRequest)(nil),     // 9: restapp.v1.UpdateUserRequest
+	(*UpdateLocationRequest)(nil), // 10: restapp.v1.UpdateLocationRequest
+	(*UpdateVisitRequest)(nil),    // 11: restapp.v1.UpdateVisitRequest
+	(*ListRequest)(nil),           // 12: restapp.v1.ListRequest
+	(*UserVisitsRequest)(nil),     // 13: restapp.v1.UserVisitsRequest
+	(*UserVisitsResponse)(nil),    // 14: restapp.v1.UserVisitsResponse
+	(*LocationAvgRequest)(nil),    // 15: restapp.v1.LocationAvgRequest
+	(*LocationAvgResponse)(nil),   // 16: restapp.v1.LocationAvgResponse
+}
+var file_rest_app_proto_depIdxs = []int32{
+	3,  // 0: restapp.v1.UpdateUserRequest.fields:type_name -> restapp.v1.UserFields
+	4,  // 1: restapp.v1.UpdateLocationRequest.fields:type_name -> restapp.v1.LocationFields
+	5,  // 2: restapp.v1.UpdateVisitRequest.fields:type_name -> restapp.v1.VisitFields
+	2,  // 3: restapp.v1.UserVisitsResponse.visits:type_name -> restapp.v1.Visit
+	6,  // 4: restapp.v1.RestApp.GetUser:input_type -> restapp.v1.GetRequest
+	0,  // 5: restapp.v1.RestApp.CreateUser:input_type -> restapp.v1.User
+	9,  // 6: restapp.v1.RestApp.UpdateUser:input_type -> restapp.v1.UpdateUserRequest
+	7,  // 7: restapp.v1.RestApp.DeleteUser:input_type -> restapp.v1.DeleteRequest
+	12, // 8: restapp.v1.RestApp.ListUsers:input_type -> restapp.v1.ListRequest
+	6,  // 9: restapp.v1.RestApp.GetLocation:input_type -> restapp.v1.GetRequest
+	1,  // 10: restapp.v1.RestApp.CreateLocation:input_type -> restapp.v1.Location
+	10, // 11: restapp.v1.RestApp.UpdateLocation:input_type -> restapp.v1.UpdateLocationRequest
+	7,  // 12: restapp.v1.RestApp.DeleteLocation:input_type -> restapp.v1.DeleteRequest
+	12, // 13: restapp.v1.RestApp.ListLocations:input_type -> restapp.v1.ListRequest
+	6,  // 14: restapp.v1.RestApp.GetVisit:input_type -> restapp.v1.GetRequest
+	2,  // 15: restapp.v1.RestApp.CreateVisit:input_type -> restapp.v1.Visit
+	11, // 16: restapp.v1.RestApp.UpdateVisit:input_type -> restapp.v1.UpdateVisitRequest
+	7,  // 17: restapp.v1.RestApp.DeleteVisit:input_type -> restapp.v1.DeleteRequest
+	12, // 18: restapp.v1.RestApp.ListVisits:input_type -> restapp.v1.ListRequest
+	13, // 19: restapp.v1.RestApp.GetUserVisits:input_type -> restapp.v1.UserVisitsRequest
+	15, // 20: restapp.v1.RestApp.GetLocationAvg:input_type -> restapp.v1.LocationAvgRequest
+	0,  // 21: restapp.v1.RestApp.GetUser:output_type -> restapp.v1.User
+	0,  // 22: restapp.v1.RestApp.CreateUser:output_type -> restapp.v1.User
+	0,  // 23: restapp.v1.RestApp.UpdateUser:output_type -> restapp.v1.User
+	8,  // 24: restapp.v1.RestApp.DeleteUser:output_type -> restapp.v1.DeleteResponse
+	0,  // 25: restapp.v1.RestApp.ListUsers:output_type -> restapp.v1.User
+	1,  // 26: restapp.v1.RestApp.GetLocation:output_type -> restapp.v1.Location
+	1,  // 27: restapp.v1.RestApp.CreateLocation:output_type -> restapp.v1.Location
+	1,  // 28: restapp.v1.RestApp.UpdateLocation:output_type -> restapp.v1.Location
+	8,  // 29: restapp.v1.RestApp.DeleteLocation:output_type -> restapp.v1.DeleteResponse
+	1,  // 30: restapp.v1.RestApp.ListLocations:output_type -> restapp.v1.Location
+	2,  // 31: restapp.v1.RestApp.GetVisit:output_type -> restapp.v1.Visit
+	2,  // 32: restapp.v1.RestApp.CreateVisit:output_type -> restapp.v1.Visit
+	2,  // 33: restapp.v1.RestApp.UpdateVisit:output_type -> restapp.v1.Visit
+	8,  // 34: restapp.v1.RestApp.DeleteVisit:output_type -> restapp.v1.DeleteResponse
+	2,  // 35: restapp.v1.RestApp.ListVisits:output_type -> restapp.v1.Visit
+	14, // 36: restapp.v1.RestApp.GetUserVisits:output_type -> restapp.v1.UserVisitsResponse
+	16, // 37: restapp.v1.RestApp.GetLocationAvg:output_type -> restapp.v1.LocationAvgResponse
+	21, // [21:38] is the sub-list for method output_type
+	4,  // [4:21] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_rest_app_proto_init() }
+func file_rest_app_proto_init() {
+	if File_rest_app_proto != nil {
+		return
+	}
+	file_rest_app_proto_msgTypes[3].OneofWrappers = []any{}
+	file_rest_app_proto_msgTypes[4].OneofWrappers = []any{}
+	file_rest_app_proto_msgTypes[5].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_rest_app_proto_rawDesc), len(file_rest_app_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   17,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_rest_app_proto_goTypes,
+		DependencyIndexes: file_rest_app_proto_depIdxs,
+		MessageInfos:      file_rest_app_proto_msgTypes,
+	}.Build()
+	File_rest_app_proto = out.File
+	file_rest_app_proto_goTypes = nil
+	file_rest_app_proto_depIdxs = nil
+}
@@ -0,0 +1,747 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.1
+// - protoc             (unknown)
+// source: rest_app.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	RestApp_GetUser_FullMethodName        = "/restapp.v1.RestApp/GetUser"
+	RestApp_CreateUser_FullMethodName     = "/restapp.v1.RestApp/CreateUser"
+	RestApp_UpdateUser_FullMethodName     = "/restapp.v1.RestApp/UpdateUser"
+	RestApp_DeleteUser_FullMethodName     = "/restapp.v1.RestApp/DeleteUser"
+	RestApp_ListUsers_FullMethodName      = "/restapp.v1.RestApp/ListUsers"
+	RestApp_GetLocation_FullMethodName    = "/restapp.v1.RestApp/GetLocation"
+	RestApp_CreateLocation_FullMethodName = "/restapp.v1.RestApp/CreateLocation"
+	RestApp_UpdateLocation_FullMethodName = "/restapp.v1.RestApp/UpdateLocation"
+	RestApp_DeleteLocation_FullMethodName = "/restapp.v1.RestApp/DeleteLocation"
+	RestApp_ListLocations_FullMethodName  = "/restapp.v1.RestApp/ListLocations"
+	RestApp_GetVisit_FullMethodName       = "/restapp.v1.RestApp/GetVisit"
+	RestApp_CreateVisit_FullMethodName    = "/restapp.v1.RestApp/CreateVisit"
+	RestApp_UpdateVisit_FullMethodName    = "/restapp.v1.RestApp/UpdateVisit"
+	RestApp_DeleteVisit_FullMethodName    = "/restapp.v1.RestApp/DeleteVisit"
+	RestApp_ListVisits_FullMethodName     = "/restapp.v1.RestApp/ListVisits"
+	RestApp_GetUserVisits_FullMethodName  = "/restapp.v1.RestApp/GetUserVisits"
+	RestApp_GetLocationAvg_FullMethodName = "/restapp.v1.RestApp/GetLocationAvg"
+)
+
+// RestAppClient is the client API for RestApp service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// RestApp is the same API as REST endpoints. Requests are authenticated with
+// "x-api-key" or "authorization" metadata.
+type RestAppClient interface {
+	GetUser(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*User, error)
+	CreateUser(ctx context.Context, in *User, opts ...grpc.CallOption) (*User, error)
+	UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*User, error)
+	DeleteUser(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// ListUsers streams all users ordered by id
+	ListUsers(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[User], error)
+	GetLocation(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Location, error)
+	CreateLocation(ctx context.Context, in *Location, opts ...grpc.CallOption) (*Location, error)
+	UpdateLocation(ctx context.Context, in *UpdateLocationRequest, opts ...grpc.CallOption) (*Location, error)
+	DeleteLocation(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	ListLocations(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Location], error)
+	GetVisit(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Visit, error)
+	CreateVisit(ctx context.Context, in *Visit, opts ...grpc.CallOption) (*Visit, error)
+	UpdateVisit(ctx context.Context, in *UpdateVisitRequest, opts ...grpc.CallOption) (*Visit, error)
+	DeleteVisit(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	ListVisits(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Visit], error)
+	GetUserVisits(ctx context.Context, in *UserVisitsRequest, opts ...grpc.CallOption) (*UserVisitsResponse, error)
+	GetLocationAvg(ctx context.Context, in *LocationAvgRequest, opts ...grpc.CallOption) (*LocationAvgResponse, error)
+}
+
+type restAppClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRestAppClient(cc grpc.ClientConnInterface) RestAppClient {
+	return &restAppClient{cc}
+}
+
+func (c *restAppClient) GetUser(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, RestApp_GetUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) CreateUser(ctx context.Context, in *User, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, RestApp_CreateUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, RestApp_UpdateUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) DeleteUser(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, RestApp_DeleteUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) ListUsers(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[User], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &RestApp_ServiceDesc.Streams[0], RestApp_ListUsers_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListRequest, User]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type RestApp_ListUsersClient = grpc.ServerStreamingClient[User]
+
+func (c *restAppClient) GetLocation(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Location, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Location)
+	err := c.cc.Invoke(ctx, RestApp_GetLocation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) CreateLocation(ctx context.Context, in *Location, opts ...grpc.CallOption) (*Location, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Location)
+	err := c.cc.Invoke(ctx, RestApp_CreateLocation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) UpdateLocation(ctx context.Context, in *UpdateLocationRequest, opts ...grpc.CallOption) (*Location, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Location)
+	err := c.cc.Invoke(ctx, RestApp_UpdateLocation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) DeleteLocation(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, RestApp_DeleteLocation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) ListLocations(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Location], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &RestApp_ServiceDesc.Streams[1], RestApp_ListLocations_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListRequest, Location]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type RestApp_ListLocationsClient = grpc.ServerStreamingClient[Location]
+
+func (c *restAppClient) GetVisit(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Visit, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Visit)
+	err := c.cc.Invoke(ctx, RestApp_GetVisit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) CreateVisit(ctx context.Context, in *Visit, opts ...grpc.CallOption) (*Visit, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Visit)
+	err := c.cc.Invoke(ctx, RestApp_CreateVisit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) UpdateVisit(ctx context.Context, in *UpdateVisitRequest, opts ...grpc.CallOption) (*Visit, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Visit)
+	err := c.cc.Invoke(ctx, RestApp_UpdateVisit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) DeleteVisit(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, RestApp_DeleteVisit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) ListVisits(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Visit], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &RestApp_ServiceDesc.Streams[2], RestApp_ListVisits_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListRequest, Visit]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type RestApp_ListVisitsClient = grpc.ServerStreamingClient[Visit]
+
+func (c *restAppClient) GetUserVisits(ctx context.Context, in *UserVisitsRequest, opts ...grpc.CallOption) (*UserVisitsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserVisitsResponse)
+	err := c.cc.Invoke(ctx, RestApp_GetUserVisits_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restAppClient) GetLocationAvg(ctx context.Context, in *LocationAvgRequest, opts ...grpc.CallOption) (*LocationAvgResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LocationAvgResponse)
+	err := c.cc.Invoke(ctx, RestApp_GetLocationAvg_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RestAppServer is the server API for RestApp service.
+// All implementations must embed UnimplementedRestAppServer
+// for forward compatibility.
+//
+// RestApp is the same API as REST endpoints. Requests are authenticated with
+// "x-api-key" or "authorization" metadata.
+type RestAppServer interface {
+	GetUser(context.Context, *GetRequest) (*User, error)
+	CreateUser(context.Context, *User) (*User, error)
+	UpdateUser(context.Context, *UpdateUserRequest) (*User, error)
+	DeleteUser(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// ListUsers streams all users ordered by id
+	ListUsers(*ListRequest, grpc.ServerStreamingServer[User]) error
+	GetLocation(context.Context, *GetRequest) (*Location, error)
+	CreateLocation(context.Context, *Location) (*Location, error)
+	UpdateLocation(context.Context, *UpdateLocationRequest) (*Location, error)
+	DeleteLocation(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	ListLocations(*ListRequest, grpc.ServerStreamingServer[Location]) error
+	GetVisit(context.Context, *GetRequest) (*Visit, error)
+	CreateVisit(context.Context, *Visit) (*Visit, error)
+	UpdateVisit(context.Context, *UpdateVisitRequest) (*Visit, error)
+	DeleteVisit(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	ListVisits(*ListRequest, grpc.ServerStreamingServer[Visit]) error
+	GetUserVisits(context.Context, *UserVisitsRequest) (*UserVisitsResponse, error)
+	GetLocationAvg(context.Context, *LocationAvgRequest) (*LocationAvgResponse, error)
+	mustEmbedUnimplementedRestAppServer()
+}
+
+// UnimplementedRestAppServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRestAppServer struct{}
+
+func (UnimplementedRestAppServer) GetUser(context.Context, *GetRequest) (*User, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedRestAppServer) CreateUser(context.Context, *User) (*User, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateUser not implemented")
+}
+func (UnimplementedRestAppServer) UpdateUser(context.Context, *UpdateUserRequest) (*User, error) {
+	return nil, status.Error(codes.Unimplemented, "method UpdateUser not implemented")
+}
+func (UnimplementedRestAppServer) DeleteUser(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method DeleteUser not implemented")
+}
+func (UnimplementedRestAppServer) ListUsers(*ListRequest, grpc.ServerStreamingServer[User]) error {
+	return status.Error(codes.Unimplemented, "method ListUsers not implemented")
+}
+func (UnimplementedRestAppServer) GetLocation(context.Context, *GetRequest) (*Location, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetLocation not implemented")
+}
+func (UnimplementedRestAppServer) CreateLocation(context.Context, *Location) (*Location, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateLocation not implemented")
+}
+func (UnimplementedRestAppServer) UpdateLocation(context.Context, *UpdateLocationRequest) (*Location, error) {
+	return nil, status.Error(codes.Unimplemented, "method UpdateLocation not implemented")
+}
+func (UnimplementedRestAppServer) DeleteLocation(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method DeleteLocation not implemented")
+}
+func (UnimplementedRestAppServer) ListLocations(*ListRequest, grpc.ServerStreamingServer[Location]) error {
+	return status.Error(codes.Unimplemented, "method ListLocations not implemented")
+}
+func (UnimplementedRestAppServer) GetVisit(context.Context, *GetRequest) (*Visit, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetVisit not implemented")
+}
+func (UnimplementedRestAppServer) CreateVisit(context.Context, *Visit) (*Visit, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateVisit not implemented")
+}
+func (UnimplementedRestAppServer) UpdateVisit(context.Context, *UpdateVisitRequest) (*Visit, error) {
+	return nil, status.Error(codes.Unimplemented, "method UpdateVisit not implemented")
+}
+func (UnimplementedRestAppServer) DeleteVisit(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method DeleteVisit not implemented")
+}
+func (UnimplementedRestAppServer) ListVisits(*ListRequest, grpc.ServerStreamingServer[Visit]) error {
+	return status.Error(codes.Unimplemented, "method ListVisits not implemented")
+}
+func (UnimplementedRestAppServer) GetUserVisits(context.Context, *UserVisitsRequest) (*UserVisitsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetUserVisits not implemented")
+}
+func (UnimplementedRestAppServer) GetLocationAvg(context.Context, *LocationAvgRequest) (*LocationAvgResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetLocationAvg not implemented")
+}
+func (UnimplementedRestAppServer) mustEmbedUnimplementedRestAppServer() {}
+func (UnimplementedRestAppServer) testEmbeddedByValue()                 {}
+
+// UnsafeRestAppServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RestAppServer will
+// result in compilation errors.
+type UnsafeRestAppServer interface {
+	mustEmbedUnimplementedRestAppServer()
+}
+
+func RegisterRestAppServer(s grpc.ServiceRegistrar, srv RestAppServer) {
+	// If the following call panics, it indicates UnimplementedRestAppServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&RestApp_ServiceDesc, srv)
+}
+
+func _RestApp_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_GetUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).GetUser(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_CreateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(User)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).CreateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_CreateUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).CreateUser(ctx, req.(*User))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_UpdateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).UpdateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_UpdateUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).UpdateUser(ctx, req.(*UpdateUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).DeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_DeleteUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).DeleteUser(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_ListUsers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RestAppServer).ListUsers(m, &grpc.GenericServerStream[ListRequest, User]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type RestApp_ListUsersServer = grpc.ServerStreamingServer[User]
+
+func _RestApp_GetLocation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).GetLocation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_GetLocation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).GetLocation(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_CreateLocation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Location)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).CreateLocation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_CreateLocation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).CreateLocation(ctx, req.(*Location))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_UpdateLocation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateLocationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).UpdateLocation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_UpdateLocation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).UpdateLocation(ctx, req.(*UpdateLocationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_DeleteLocation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).DeleteLocation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_DeleteLocation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).DeleteLocation(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_ListLocations_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RestAppServer).ListLocations(m, &grpc.GenericServerStream[ListRequest, Location]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type RestApp_ListLocationsServer = grpc.ServerStreamingServer[Location]
+
+func _RestApp_GetVisit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).GetVisit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_GetVisit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).GetVisit(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_CreateVisit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Visit)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).CreateVisit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_CreateVisit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).CreateVisit(ctx, req.(*Visit))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_UpdateVisit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateVisitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).UpdateVisit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_UpdateVisit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).UpdateVisit(ctx, req.(*UpdateVisitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_DeleteVisit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).DeleteVisit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_DeleteVisit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).DeleteVisit(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_ListVisits_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RestAppServer).ListVisits(m, &grpc.GenericServerStream[ListRequest, Visit]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type RestApp_ListVisitsServer = grpc.ServerStreamingServer[Visit]
+
+func _RestApp_GetUserVisits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserVisitsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).GetUserVisits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_GetUserVisits_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).GetUserVisits(ctx, req.(*UserVisitsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestApp_GetLocationAvg_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LocationAvgRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestAppServer).GetLocationAvg(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestApp_GetLocationAvg_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestAppServer).GetLocationAvg(ctx, req.(*LocationAvgRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RestApp_ServiceDesc is the grpc.ServiceDesc for RestApp service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RestApp_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "restapp.v1.RestApp",
+	HandlerType: (*RestAppServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetUser",
+			Handler:    _RestApp_GetUser_Handler,
+		},
+		{
+			MethodName: "CreateUser",
+			Handler:    _RestApp_CreateUser_Handler,
+		},
+		{
+			MethodName: "UpdateUser",
+			Handler:    _RestApp_UpdateUser_Handler,
+		},
+		{
+			MethodName: "DeleteUser",
+			Handler:    _RestApp_DeleteUser_Handler,
+		},
+		{
+			MethodName: "GetLocation",
+			Handler:    _RestApp_GetLocation_Handler,
+		},
+		{
+			MethodName: "CreateLocation",
+			Handler:    _RestApp_CreateLocation_Handler,
+		},
+		{
+			MethodName: "UpdateLocation",
+			Handler:    _RestApp_UpdateLocation_Handler,
+		},
+		{
+			MethodName: "DeleteLocation",
+			Handler:    _RestApp_DeleteLocation_Handler,
+		},
+		{
+			MethodName: "GetVisit",
+			Handler:    _RestApp_GetVisit_Handler,
+		},
+		{
+			MethodName: "CreateVisit",
+			Handler:    _RestApp_CreateVisit_Handler,
+		},
+		{
+			MethodName: "UpdateVisit",
+			Handler:    _RestApp_UpdateVisit_Handler,
+		},
+		{
+			MethodName: "DeleteVisit",
+			Handler:    _RestApp_DeleteVisit_Handler,
+		},
+		{
+			MethodName: "GetUserVisits",
+			Handler:    _RestApp_GetUserVisits_Handler,
+		},
+		{
+			MethodName: "GetLocationAvg",
+			Handler:    _RestApp_GetLocationAvg_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListUsers",
+			Handler:       _RestApp_ListUsers_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListLocations",
+			Handler:       _RestApp_ListLocations_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListVisits",
+			Handler:       _RestApp_ListVisits_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "rest_app.proto",
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RateLimitResult is a state of client bucket after request
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// time until bucket is full again
+	Reset time.Duration
+	// time until next request is allowed, set if request isn't allowed
+	RetryAfter time.Duration
+}
+
+// RateLimiter is a token bucket storage. Buckets hold up to limit tokens and
+// are refilled with limit tokens per minute.
+type RateLimiter interface {
+	// Take takes a token from bucket with key
+	Take(key string, limit int) RateLimitResult
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// memoryRateLimiter keeps buckets in memory of the process
+type memoryRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	// buckets are checked for removal when their count reaches sweepSize
+	sweepSize int
+}
+
+func newMemoryRateLimiter() *memoryRateLimiter {
+	return &memoryRateLimiter{buckets: make(map[string]*tokenBucket), sweepSize: 10000}
+}
+
+func refillBucket(b *tokenBucket, limit int, now time.Time) {
+	b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.updated).Minutes()*float64(limit))
+	b.updated = now
+}
+
+func (l *memoryRateLimiter) Take(key string, limit int) RateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.sweepSize {
+			l.sweep(now)
+		}
+		b = &tokenBucket{tokens: float64(limit), updated: now}
+		l.buckets[key] = b
+	}
+	refillBucket(b, limit, now)
+
+	tokenDuration := time.Minute / time.Duration(limit)
+	res := RateLimitResult{Limit: limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) * float64(tokenDuration))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((float64(limit) - b.tokens) * float64(tokenDuration))
+	return res
+}
+
+// sweep removes buckets which aren't used for a minute, these are full anyway
+func (l *memoryRateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) > time.Minute {
+			delete(l.buckets, key)
+		}
+	}
+	if len(l.buckets) >= l.sweepSize {
+		l.sweepSize *= 2
+	}
+}
+
+var rateLimiter RateLimiter = newMemoryRateLimiter()
+
+// routes which read many records and have separate rate limit
+var expensiveRoutes = map[string]bool{
+	"/users/{id}/visits":          true,
+	"/users/{id}/stats":           true,
+	"/users/{id}/recommendations": true,
+	"/locations/{id}/avg":         true,
+	"/locations/avg/live":         true,
+	"/locations/{id}/stats":       true,
+	"/locations/top":              true,
+	"/graphql":                    true,
+}
+
+// getRateLimit returns requests class and its limit per minute
+func getRateLimit(r *http.Request) (string, int) {
+	if route := mux.CurrentRoute(r); route != nil {
+		template, _ := route.GetPathTemplate()
+		if expensiveRoutes[template] {
+			return "expensive", RATE_LIMIT_EXPENSIVE
+		}
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return "reads", RATE_LIMIT_READS
+	}
+	return "writes", RATE_LIMIT_WRITES
+}
+
+// getRateLimitClient returns API key id for clients authenticated with API
+// key and remote IP address for others
+func getRateLimitClient(r *http.Request) string {
+	if p := getPrincipal(r); p != nil && p.Type == "api_key" {
+		return "key:" + strconv.Itoa(p.ApiKeyID)
+	}
+	return "ip:" + getRemoteIP(r)
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func getRemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host
+}
+
+func writeRateLimitHeaders(w http.ResponseWriter, res RateLimitResult) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", ceilSeconds(res.Reset))
+}
+
+func writeTooManyRequests(w http.ResponseWriter, res RateLimitResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+	w.WriteHeader(429)
+	json.NewEncoder(w).Encode(map[string]string{"Error": "Too many requests"})
+}
+
+// set in context of gRPC calls which were limited by takeIPRateLimit and of
+// local CLI requests
+const ipRateLimitedContextKey contextKey = "ip_rate_limited"
+
+// takeIPRateLimit takes token of IP address, it's done before authentication
+func takeIPRateLimit(r *http.Request) RateLimitResult {
+	if RATE_LIMIT_IP <= 0 || r.Context().Value(ipRateLimitedContextKey) != nil {
+		return RateLimitResult{Allowed: true}
+	}
+	return rateLimiter.Take("all:ip:"+getRemoteIP(r), RATE_LIMIT_IP)
+}
+
+// IPRateLimitMiddleware limits all requests from IP address before they're
+// authenticated, so requests with bad credentials and guessing of API keys
+// are limited too and don't make lookups of API keys
+func IPRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicRoute(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if res := takeIPRateLimit(r); !res.Allowed {
+			writeRateLimitHeaders(w, res)
+			writeTooManyRequests(w, res)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RateLimitMiddleware limits requests of each client with token buckets,
+// separately for reads, writes and expensive reads
+func RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class, limit := getRateLimit(r)
+		if limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		res := rateLimiter.Take(class+":"+getRateLimitClient(r), limit)
+		writeRateLimitHeaders(w, res)
+		if !res.Allowed {
+			writeTooManyRequests(w, res)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	RATE_LIMIT_READS, RATE_LIMIT_EXPENSIVE = 3, 1
+	rateLimiter = newMemoryRateLimiter()
+	defer func() {
+		RATE_LIMIT_READS, RATE_LIMIT_EXPENSIVE = 0, 0
+	}()
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "/users", nil)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		if response.Header().Get("RateLimit-Limit") != "3" {
+			t.Errorf("Expected RateLimit-Limit header to be set to '3'. Got '%s'", response.Header().Get("RateLimit-Limit"))
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/users", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusTooManyRequests, response.Code)
+	if response.Header().Get("Retry-After") == "" || response.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Expected Retry-After header and RateLimit-Remaining header set to '0'. Got %v", response.Header())
+	}
+
+	// expensive requests and writes have their own limits
+	req, _ = http.NewRequest("GET", "/locations/1/avg", nil)
+	response = executeRequest(req)
+	if response.Code == http.StatusTooManyRequests {
+		t.Errorf("Expected the first expensive request to be allowed")
+	}
+	req, _ = http.NewRequest("GET", "/locations/1/avg", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusTooManyRequests, response.Code)
+
+	// other clients aren't limited
+	readerKey, _, _ := CreateApiKey("reader", ROLE_READER, 0)
+	req, _ = http.NewRequest("GET", "/users", nil)
+	req.Header.Set(API_KEY_HEADER, readerKey)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
+
+func TestIPRateLimit(t *testing.T) {
+	RATE_LIMIT_IP = 2
+	rateLimiter = newMemoryRateLimiter()
+	defer func() {
+		RATE_LIMIT_IP = 0
+	}()
+
+	// requests with bad credentials are limited before authentication
+	for _, expected := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		req, _ := http.NewRequest("GET", "/users", nil)
+		req.Header.Set(API_KEY_HEADER, "bad key")
+		response := executeRequest(req)
+		checkResponseCode(t, expected, response.Code)
+	}
+	req, _ := http.NewRequest("GET", "/users", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusTooManyRequests, response.Code)
+
+	// health checks aren't limited
+	response = executePublicRequest("GET", "/healthz")
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// LocationRecommendation is a location user hasn't visited. Score is an
+// average mark of the location from similar users weighted by their similarity.
+type LocationRecommendation struct {
+	Location
+	Score        float64 `json:"score"`
+	SimilarUsers int     `json:"similar_users"`
+}
+
+// Similar users are users who visited the same locations as the user. Their
+// similarity is 1 - 2 * (average difference of marks for common locations) / MAX_MARK,
+// so users whose marks differ by more than a half of the scale aren't considered
+// similar. Weight of similar user is similarity multiplied by number of common
+// locations. Whole query is computed in SQLite using visits indexes on user and location.
+const recommendationsQuery = `
+WITH user_marks AS (
+	SELECT location, AVG(mark) AS mark FROM visits
+	WHERE user = ? AND deleted_at IS NULL
+	GROUP BY location
+),
+similar_users AS (
+	SELECT visits.user AS user,
+	(1 - 2 * AVG(ABS(visits.mark - user_marks.mark)) / ?) * COUNT(*) AS weight
+	FROM visits
+	JOIN user_marks ON user_marks.location = visits.location
+	JOIN users ON users.id = visits.user
+	WHERE visits.user != ? AND visits.deleted_at IS NULL AND users.deleted_at IS NULL
+	GROUP BY visits.user
+)
+SELECT locations.*,
+SUM(similar_users.weight * visits.mark) / SUM(similar_users.weight) AS score,
+COUNT(DISTINCT visits.user) AS similar_users
+FROM visits
+JOIN similar_users ON similar_users.user = visits.user
+JOIN locations ON locations.id = visits.location
+WHERE similar_users.weight > 0
+AND visits.deleted_at IS NULL AND locations.deleted_at IS NULL
+AND visits.location NOT IN (SELECT location FROM user_marks)
+AND (? = '' OR locations.country = ?)
+AND (? = -1 OR locations.distance < ?)
+GROUP BY locations.id
+ORDER BY score DESC, similar_users DESC, locations.id
+LIMIT ?
+`
+
+func getUserRecommendations(w http.ResponseWriter, r *http.Request) {
+	db := InitRequestDb(r)
+	defer db.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+
+	id, ok := params["id"]
+	if !ok {
+		res := map[string]string{"Error": "No ID specified"}
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	qsParams := r.URL.Query()
+	country := qsParams.Get("country")
+	toDistance, toDistanceOk := getIntParam(qsParams, "toDistance", -1)
+	limit, limitOk := getIntParam(qsParams, "limit", DEFAULT_LIMIT)
+	if !toDistanceOk || !limitOk || limit < 1 || limit > MAX_LIMIT {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"Error": "Bad query string parameters"})
+		return
+	}
+
+	userFoundRes, statusCode := findOrUpdateEntity(db, "users", id, GET)
+	if statusCode != 200 {
+		if statusCode == 404 {
+			userFoundRes = map[string]string{"Error": "User not found"}
+		}
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(userFoundRes)
+		return
+	}
+
+	recommendations := make([]LocationRecommendation, 0)
+	db.Raw(recommendationsQuery, id, float64(MAX_MARK), id, country, country, toDistance, toDistance, limit).
+		Scan(&recommendations)
+
+	for i := range recommendations {
+		recommendations[i].Score = roundStat(recommendations[i].Score)
+	}
+
+	json.NewEncoder(w).Encode(recommendations)
+}
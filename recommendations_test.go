@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestGetUserRecommendations(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/locations/new", `{"id": 2, "place": "Hermitage", "country": "Russia", "city": "Saint Petersburg", "distance": 5}`)
+	postJSON(t, "/locations/new", `{"id": 3, "place": "Louvre", "country": "France", "city": "Paris", "distance": 3}`)
+	postJSON(t, "/locations/new", `{"id": 4, "place": "Kremlin", "country": "Russia", "city": "Moscow", "distance": 1}`)
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/users/new", `{"id": 2, "email": "b@mail.com", "first_name": "B", "last_name": "B", "gender": "f", "birth_date": 946684800}`)
+	postJSON(t, "/users/new", `{"id": 3, "email": "c@mail.com", "first_name": "C", "last_name": "C", "gender": "f", "birth_date": 946684800}`)
+	// user 2 has the same taste as user 1, user 3 has the opposite one
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+	postJSON(t, "/visits/new", `{"id": 2, "location": 1, "user": 2, "visited_at": "1500000000", "mark": 5}`)
+	postJSON(t, "/visits/new", `{"id": 3, "location": 1, "user": 3, "visited_at": "1500000000", "mark": 1}`)
+	postJSON(t, "/visits/new", `{"id": 4, "location": 2, "user": 2, "visited_at": "1500000000", "mark": 5}`)
+	postJSON(t, "/visits/new", `{"id": 5, "location": 2, "user": 3, "visited_at": "1500000000", "mark": 1}`)
+	postJSON(t, "/visits/new", `{"id": 6, "location": 3, "user": 2, "visited_at": "1500000000", "mark": 2}`)
+	postJSON(t, "/visits/new", `{"id": 7, "location": 3, "user": 3, "visited_at": "1500000000", "mark": 5}`)
+	postJSON(t, "/visits/new", `{"id": 8, "location": 4, "user": 3, "visited_at": "1500000000", "mark": 5}`)
+
+	getRecommendations := func(query string) []LocationRecommendation {
+		req, _ := http.NewRequest("GET", "/users/1/recommendations"+query, nil)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var recommendations []LocationRecommendation
+		json.Unmarshal(response.Body.Bytes(), &recommendations)
+		return recommendations
+	}
+
+	recommendations := getRecommendations("")
+	if len(recommendations) != 2 || recommendations[0].ID != 2 || recommendations[1].ID != 3 {
+		t.Errorf("Expected recommended locations 2 and 3. Got %+v", recommendations)
+	}
+
+	recommendations = getRecommendations("?country=France")
+	if len(recommendations) != 1 || recommendations[0].ID != 3 {
+		t.Errorf("Expected recommended location 3. Got %+v", recommendations)
+	}
+
+	recommendations = getRecommendations("?toDistance=4")
+	if len(recommendations) != 1 || recommendations[0].ID != 3 {
+		t.Errorf("Expected recommended location 3. Got %+v", recommendations)
+	}
+
+	req, _ := http.NewRequest("GET", "/users/5/recommendations", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+const OPERATION_RESTORE = "restore"
+
+// includeDeleted checks if soft deleted entities are requested. Only admins
+// may request them, see AuthorizationMiddleware.
+func includeDeleted(r *http.Request) bool {
+	return r.URL.Query().Get("includeDeleted") == "true"
+}
+
+func restoreEntity(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	entity := strings.ToLower(params["entity"])
+	id := params["id"]
+
+	statusCode := 200
+	var res interface{}
+	res = map[string]interface{}{"Success": true}
+	notFound := func() (*mutation, error) {
+		res, statusCode = map[string]string{"Error": "Deleted entity not found"}, 404
+		return nil, nil
+	}
+
+	errSave := runMutation(r, func(tx *gorm.DB) (*mutation, error) {
+		deleted := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id)
+		switch entity {
+		case "users":
+			var foundEntity User
+			deleted.First(&foundEntity)
+			if (foundEntity == User{}) {
+				return notFound()
+			}
+			restored := foundEntity
+			restored.DeletedAt = nil
+			restored.Version++
+			if err := restoreDeleted(tx, &restored); err != nil {
+				return nil, err
+			}
+			if err := applyUserMarks(tx, restored, 1); err != nil {
+				return nil, err
+			}
+			return &mutation{Entity: entity, ID: restored.ID, Operation: OPERATION_RESTORE, Before: foundEntity, After: restored}, nil
+		case "visits":
+			var foundEntity Visit
+			deleted.First(&foundEntity)
+			if (foundEntity == Visit{}) {
+				return notFound()
+			}
+			restored := foundEntity
+			restored.DeletedAt = nil
+			restored.Version++
+			if err := restoreDeleted(tx, &restored); err != nil {
+				return nil, err
+			}
+			if err := applyVisitMarks(tx, restored, 1); err != nil {
+				return nil, err
+			}
+			return &mutation{Entity: entity, ID: restored.ID, Operation: OPERATION_RESTORE, Before: foundEntity, After: restored}, nil
+		case "locations":
+			var foundEntity Location
+			deleted.First(&foundEntity)
+			if (foundEntity == Location{}) {
+				return notFound()
+			}
+			restored := foundEntity
+			restored.DeletedAt = nil
+			restored.Version++
+			if err := restoreDeleted(tx, &restored); err != nil {
+				return nil, err
+			}
+			return &mutation{Entity: entity, ID: restored.ID, Operation: OPERATION_RESTORE, Before: foundEntity, After: restored}, nil
+		default:
+			res, statusCode = map[string]string{"Error": "Entity doesn't exist"}, 404
+			return nil, nil
+		}
+	})
+	if errSave != nil {
+		res, statusCode = map[string]string{"Error": "Entity can't be restored"}, 500
+	}
+
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(res)
+}
+
+// deletedEntityError is returned by creates with id of soft deleted entity,
+// which should be restored instead
+type deletedEntityError struct {
+	entity string
+	id     int
+}
+
+func (e *deletedEntityError) Error() string {
+	return fmt.Sprintf("deleted entity %s/%d exists", e.entity, e.id)
+}
+
+// checkNotDeleted returns deletedEntityError if entity with id is soft
+// deleted. Entities without id get new ids.
+func checkNotDeleted(tx *gorm.DB, entity string, model interface{}, id int) error {
+	if id == 0 {
+		return nil
+	}
+	var count int
+	if err := tx.Unscoped().Model(model).Where("id = ? AND deleted_at IS NOT NULL", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count != 0 {
+		return &deletedEntityError{entity, id}
+	}
+	return nil
+}
+
+// restoreDeleted clears deleted_at and increments version of entity
+func restoreDeleted(tx *gorm.DB, model interface{}) error {
+	if err := bumpVersion(tx, model); err != nil {
+		return err
+	}
+	return tx.Unscoped().Model(model).Update("deleted_at", nil).Error
+}
+
+// PurgeDeletedEntities removes entities soft deleted more than days ago and
+// returns number of removed entities. Aggregates of removed locations are
+// removed too, marks of deleted users and visits are already removed.
+func PurgeDeletedEntities(days int) (int64, error) {
+	db := openDb(getMutationSqlDB())
+	defer db.Close()
+
+	before := time.Now().AddDate(0, 0, -days)
+	tx := db.Begin()
+	err := tx.Exec("DELETE FROM location_marks WHERE location IN (SELECT id FROM locations WHERE deleted_at < ?)", before).Error
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	var purged int64
+	for _, model := range []interface{}{&User{}, &Location{}, &Visit{}} {
+		res := tx.Unscoped().Where("deleted_at < ?", before).Delete(model)
+		if res.Error != nil {
+			tx.Rollback()
+			return 0, res.Error
+		}
+		purged += res.RowsAffected
+	}
+	return purged, tx.Commit().Error
+}
+
+// runPurgeCommand removes soft deleted entities: "purge <days>"
+func runPurgeCommand(args []string) error {
+	usage := errors.New("usage: purge <days>")
+	if len(args) != 1 {
+		return usage
+	}
+	days, err := strconv.Atoi(args[0])
+	if err != nil || days < 0 {
+		return usage
+	}
+	purged, err := PurgeDeletedEntities(days)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d entities deleted more than %d days ago\n", purged, days)
+	return nil
+}
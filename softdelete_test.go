@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+
+	req, _ := http.NewRequest("DELETE", "/users/1", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("DELETE", "/users/1", nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+	req, _ = http.NewRequest("GET", "/users/1", nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+	if _, cnt := getLocationMarks(InitDb(), "1", -1, -1, ""); cnt != 0 {
+		t.Errorf("Expected visits of deleted user not to be counted. Got %d", cnt)
+	}
+
+	req, _ = http.NewRequest("GET", "/users/1?includeDeleted=true", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var user User
+	json.Unmarshal(response.Body.Bytes(), &user)
+	if user.DeletedAt == nil {
+		t.Errorf("Expected deleted_at of deleted user to be set")
+	}
+
+	req, _ = http.NewRequest("POST", "/users/new", strings.NewReader(`{"id": 1, "email": "b@mail.com", "first_name": "B", "last_name": "B", "gender": "f", "birth_date": 631152000}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusConflict, response.Code)
+	if !strings.Contains(response.Body.String(), "POST /users/1/restore") {
+		t.Errorf("Expected error to point to restore endpoint. Got %s", response.Body.String())
+	}
+
+	readerKey, _, _ := CreateApiKey("reader", ROLE_READER, 0)
+	req, _ = http.NewRequest("GET", "/users?includeDeleted=true", nil)
+	req.Header.Set(API_KEY_HEADER, readerKey)
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+
+	postJSON(t, "/users/1/restore", "")
+	req, _ = http.NewRequest("GET", "/users/1", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	if _, cnt := getLocationMarks(InitDb(), "1", -1, -1, ""); cnt != 1 {
+		t.Errorf("Expected visits of restored user to be counted. Got %d", cnt)
+	}
+	req, _ = http.NewRequest("POST", "/users/1/restore", nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("DELETE", "/visits/2", nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+
+	checkBodyResponse(t, "/users/1", "", `{"deleted_at": "2020-01-01T00:00:00Z"}`, http.StatusBadRequest)
+}
+
+func TestPurgeDeletedEntities(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/locations/new", `{"id": 2, "place": "Hermitage", "country": "Russia", "city": "Saint Petersburg", "distance": 5}`)
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+	postJSON(t, "/visits/new", `{"id": 2, "location": 2, "user": 1, "visited_at": "1500000000", "mark": 4}`)
+	req, _ := http.NewRequest("DELETE", "/locations/1", nil)
+	executeRequest(req)
+	req, _ = http.NewRequest("DELETE", "/locations/2", nil)
+	executeRequest(req)
+	db.Unscoped().Model(&Location{}).Where("id = 1").Update("deleted_at", time.Now().AddDate(0, 0, -10))
+
+	purged, err := PurgeDeletedEntities(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 purged entity. Got %d", purged)
+	}
+	var count int
+	db.Unscoped().Model(&Location{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 location left. Got %d", count)
+	}
+	if _, cnt := getLocationMarks(InitDb(), "1", -1, -1, ""); cnt != 0 {
+		t.Errorf("Expected aggregates of purged location to be removed. Got %d visits", cnt)
+	}
+	if _, cnt := getLocationMarks(InitDb(), "2", -1, -1, ""); cnt != 1 {
+		t.Errorf("Expected aggregates of deleted location to be kept. Got %d visits", cnt)
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+const MAX_MARK = 5
+
+// MarksStats is a summary of visit marks. Histogram[i] is a number of visits
+// with mark i.
+type MarksStats struct {
+	Count      int               `json:"count"`
+	Mean       float64           `json:"mean"`
+	Median     float64           `json:"median"`
+	StdDev     float64           `json:"std_dev"`
+	Histogram  [MAX_MARK + 1]int `json:"histogram"`
+	FirstVisit string            `json:"first_visit,omitempty"`
+	LastVisit  string            `json:"last_visit,omitempty"`
+}
+
+func roundStat(x float64) float64 {
+	return math.Round(x*10000) / 10000
+}
+
+// getVisitTimestamp parses visited_at of visit, which is a unix timestamp
+func getVisitTimestamp(v Visit) (int, bool) {
+	ts, err := strconv.Atoi(v.VisitedAt)
+	return ts, err == nil
+}
+
+// updateFirstLastVisit sets first and last to visited_at of v if v was made
+// earlier than first or later than last
+func updateFirstLastVisit(v Visit, first *string, last *string) {
+	ts, ok := getVisitTimestamp(v)
+	if !ok {
+		return
+	}
+	if firstTs, err := strconv.Atoi(*first); err != nil || ts < firstTs {
+		*first = v.VisitedAt
+	}
+	if lastTs, err := strconv.Atoi(*last); err != nil || ts > lastTs {
+		*last = v.VisitedAt
+	}
+}
+
+func getMarksStats(visits []Visit) MarksStats {
+	var stats MarksStats
+	stats.Count = len(visits)
+	if stats.Count == 0 {
+		return stats
+	}
+
+	marks := make([]int, 0, len(visits))
+	sum := 0
+	for _, v := range visits {
+		marks = append(marks, v.Mark)
+		sum += v.Mark
+		if v.Mark >= 0 && v.Mark <= MAX_MARK {
+			stats.Histogram[v.Mark]++
+		}
+		updateFirstLastVisit(v, &stats.FirstVisit, &stats.LastVisit)
+	}
+
+	mean := float64(sum) / float64(stats.Count)
+	variance := 0.0
+	for _, m := range marks {
+		variance += (float64(m) - mean) * (float64(m) - mean)
+	}
+	variance /= float64(stats.Count)
+
+	sort.Ints(marks)
+	var median float64
+	if stats.Count%2 == 1 {
+		median = float64(marks[stats.Count/2])
+	} else {
+		median = float64(marks[stats.Count/2-1]+marks[stats.Count/2]) / 2
+	}
+
+	stats.Mean = roundStat(mean)
+	stats.Median = roundStat(median)
+	stats.StdDev = roundStat(math.Sqrt(variance))
+	return stats
+}
+
+// visit group keys for groupBy parameter of /locations/{id}/stats
+var locationStatsGroups = map[string]func(uv userVisit) string{
+	"gender": func(uv userVisit) string {
+		return uv.User.Gender
+	},
+	"ageBucket": func(uv userVisit) string {
+		age := getUserAge(uv.User) / 10 * 10
+		return strconv.Itoa(age) + "-" + strconv.Itoa(age+9)
+	},
+	"month": func(uv userVisit) string {
+		ts, ok := getVisitTimestamp(uv.Visit)
+		if !ok {
+			return "unknown"
+		}
+		return time.Unix(int64(ts), 0).UTC().Format("2006-01")
+	},
+}
+
+func getLocationStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+
+	id, ok := params["id"]
+	if !ok {
+		res := map[string]string{"Error": "No ID specified"}
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	qsParams := r.URL.Query()
+
+	filter := getAvgFilter(qsParams)
+
+	groupBy := qsParams.Get("groupBy")
+	groupKey, ok := locationStatsGroups[groupBy]
+	if groupBy != "" && !ok {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"Error": "Bad query string parameters"})
+		return
+	}
+
+	db := InitRequestDb(r)
+	defer db.Close()
+
+	locFoundRes, statusCode := findOrUpdateEntity(db, "locations", id, GET)
+	if statusCode != 200 {
+		if statusCode == 404 {
+			// change "Entity not found" to "Location not found"
+			locFoundRes = map[string]string{"Error": "Location not found"}
+		}
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(locFoundRes)
+		return
+	}
+
+	visits := filterLocationVisits(db, id, filter)
+
+	if groupBy == "" {
+		allVisits := make([]Visit, 0, len(visits))
+		for _, uv := range visits {
+			allVisits = append(allVisits, uv.Visit)
+		}
+		json.NewEncoder(w).Encode(getMarksStats(allVisits))
+		return
+	}
+
+	groupVisits := make(map[string][]Visit)
+	for _, uv := range visits {
+		key := groupKey(uv)
+		groupVisits[key] = append(groupVisits[key], uv.Visit)
+	}
+	groups := make(map[string]MarksStats)
+	for key, gv := range groupVisits {
+		groups[key] = getMarksStats(gv)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"groups": groups})
+}
+
+// UserStats is a summary of user visits
+type UserStats struct {
+	VisitsCount   int      `json:"visits_count"`
+	Countries     []string `json:"countries"`
+	Cities        []string `json:"cities"`
+	AvgMark       float64  `json:"avg_mark"`
+	TotalDistance int      `json:"total_distance"`
+	FirstVisit    string   `json:"first_visit,omitempty"`
+	LastVisit     string   `json:"last_visit,omitempty"`
+}
+
+// getDateParam returns date from query string parameter. Date must be a unix
+// timestamp if parameter is set.
+func getDateParam(qsParams url.Values, name string) (string, bool) {
+	date := qsParams.Get(name)
+	if date == "" {
+		return "", true
+	}
+	_, err := strconv.Atoi(date)
+	return date, err == nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func getUserStats(w http.ResponseWriter, r *http.Request) {
+	db := InitRequestDb(r)
+	defer db.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+
+	id, ok := params["id"]
+	if !ok {
+		res := map[string]string{"Error": "No ID specified"}
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	qsParams := r.URL.Query()
+	fromDate, fromDateOk := getDateParam(qsParams, "fromDate")
+	toDate, toDateOk := getDateParam(qsParams, "toDate")
+	if !fromDateOk || !toDateOk {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"Error": "Bad query string parameters"})
+		return
+	}
+
+	userFoundRes, statusCode := findOrUpdateEntity(db, "users", id, GET)
+	if statusCode != 200 {
+		if statusCode == 404 {
+			userFoundRes = map[string]string{"Error": "User not found"}
+		}
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(userFoundRes)
+		return
+	}
+
+	// visits of missing or deleted locations are skipped like in getUserVisits
+	var visits []Visit
+	query := db.Select("visits.*").
+		Joins("JOIN locations ON locations.id = visits.location AND locations.deleted_at IS NULL").
+		Where("visits.user = ?", id)
+	if fromDate != "" {
+		query = query.Where("visits.visited_at > ?", fromDate)
+	}
+	if toDate != "" {
+		query = query.Where("visits.visited_at < ?", toDate)
+	}
+	query.Find(&visits)
+
+	locationIds := make([]int, 0, len(visits))
+	for _, v := range visits {
+		locationIds = append(locationIds, v.Location)
+	}
+	var locations []Location
+	db.Where("id IN (?)", locationIds).Find(&locations)
+	locationsById := make(map[int]Location)
+	for _, l := range locations {
+		locationsById[l.ID] = l
+	}
+
+	stats := UserStats{VisitsCount: len(visits)}
+	countries := make(map[string]bool)
+	cities := make(map[string]bool)
+	marksSum := 0
+	for _, v := range visits {
+		marksSum += v.Mark
+		updateFirstLastVisit(v, &stats.FirstVisit, &stats.LastVisit)
+		l := locationsById[v.Location]
+		countries[l.Country] = true
+		cities[l.City] = true
+		stats.TotalDistance += l.Distance
+	}
+	stats.Countries = sortedKeys(countries)
+	stats.Cities = sortedKeys(cities)
+	if stats.VisitsCount > 0 {
+		stats.AvgMark = roundStat(float64(marksSum) / float64(stats.VisitsCount))
+	}
+
+	json.NewEncoder(w).Encode(stats)
+}
+
+const (
+	DEFAULT_LIMIT = 10
+	MAX_LIMIT     = 100
+)
+
+// LocationRank is a location with its marks summary in /locations/top
+type LocationRank struct {
+	Location
+	Avg         float64 `json:"avg"`
+	VisitsCount int     `json:"visits_count"`
+}
+
+// getIntParam returns integer from query string parameter or defaultValue if
+// parameter isn't set
+func getIntParam(qsParams url.Values, name string, defaultValue int) (int, bool) {
+	value := qsParams.Get(name)
+	if value == "" {
+		return defaultValue, true
+	}
+	res, err := strconv.Atoi(value)
+	return res, err == nil
+}
+
+// getAgeBirthDate returns the first timestamp of birth date for which user
+// age (see getUserAge) isn't greater than age. Users with birth date before
+// this timestamp are older than age.
+func getAgeBirthDate(age int) int64 {
+	y, M, _ := time.Now().Date()
+	return time.Date(y-age-1, M+1, 1, 0, 0, 0, 0, time.Local).Unix()
+}
+
+// whereUser filters users joined to query like avgFilter.matchesUser
+func (f avgFilter) whereUser(query *gorm.DB) *gorm.DB {
+	if f.gender != "" {
+		query = query.Where("users.gender = ?", f.gender)
+	}
+	if f.fromAge == -1 {
+		// toAge alone compares age 0
+		if f.toAge != -1 && f.toAge <= 0 {
+			query = query.Where("1 = 0")
+		}
+		return query
+	}
+	query = query.Where("CAST(users.birth_date AS INTEGER) < ?", getAgeBirthDate(f.fromAge))
+	if f.toAge != -1 {
+		query = query.Where("CAST(users.birth_date AS INTEGER) >= ?", getAgeBirthDate(f.toAge-1))
+	}
+	return query
+}
+
+// whereVisit filters visits of query like avgFilter.matchesVisit
+func (f avgFilter) whereVisit(query *gorm.DB) *gorm.DB {
+	if f.fromDate != "" {
+		query = query.Where("visits.visited_at > ?", f.fromDate)
+	}
+	if f.toDate != "" {
+		query = query.Where("visits.visited_at < ?", f.toDate)
+	}
+	return query
+}
+
+func getTopLocations(w http.ResponseWriter, r *http.Request) {
+	db := InitRequestDb(r)
+	defer db.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	qsParams := r.URL.Query()
+
+	orderBy := qsParams.Get("orderBy")
+	_, fromDateOk := getDateParam(qsParams, "fromDate")
+	_, toDateOk := getDateParam(qsParams, "toDate")
+	_, fromAgeOk := getIntParam(qsParams, "fromAge", -1)
+	_, toAgeOk := getIntParam(qsParams, "toAge", -1)
+	fromDistance, fromDistanceOk := getIntParam(qsParams, "fromDistance", -1)
+	toDistance, toDistanceOk := getIntParam(qsParams, "toDistance", -1)
+	minVisits, minVisitsOk := getIntParam(qsParams, "minVisits", 1)
+	limit, limitOk := getIntParam(qsParams, "limit", DEFAULT_LIMIT)
+	offset, offsetOk := getIntParam(qsParams, "offset", 0)
+
+	paramsOk := fromDateOk && toDateOk && fromAgeOk && toAgeOk && fromDistanceOk && toDistanceOk && minVisitsOk && limitOk && offsetOk
+	if !paramsOk || (orderBy != "" && orderBy != "avg" && orderBy != "visits") || limit < 1 || limit > MAX_LIMIT || offset < 0 {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"Error": "Bad query string parameters"})
+		return
+	}
+
+	query := db.Table("visits").
+		Select("locations.*, AVG(visits.mark) AS avg, COUNT(visits.id) AS visits_count").
+		Joins("JOIN locations ON locations.id = visits.location").
+		Joins("JOIN users ON users.id = visits.user").
+		Where("visits.deleted_at IS NULL AND locations.deleted_at IS NULL AND users.deleted_at IS NULL")
+
+	if country := qsParams.Get("country"); country != "" {
+		query = query.Where("locations.country = ?", country)
+	}
+	if city := qsParams.Get("city"); city != "" {
+		query = query.Where("locations.city = ?", city)
+	}
+	if fromDistance != -1 {
+		query = query.Where("locations.distance > ?", fromDistance)
+	}
+	if toDistance != -1 {
+		query = query.Where("locations.distance < ?", toDistance)
+	}
+	// visits are filtered like in /locations/<id>/avg
+	filter := getAvgFilter(qsParams)
+	query = filter.whereUser(filter.whereVisit(query))
+
+	order := "avg DESC, visits_count DESC"
+	if orderBy == "visits" {
+		order = "visits_count DESC, avg DESC"
+	}
+
+	ranks := make([]LocationRank, 0)
+	query.Group("locations.id").
+		Having("COUNT(visits.id) >= ?", minVisits).
+		Order(order + ", locations.id").
+		Limit(limit).
+		Offset(offset).
+		Scan(&ranks)
+
+	for i := range ranks {
+		ranks[i].Avg = roundStat(ranks[i].Avg)
+	}
+
+	json.NewEncoder(w).Encode(ranks)
+}
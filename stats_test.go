@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestGetLocationStats(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/users/new", `{"id": 2, "email": "b@mail.com", "first_name": "B", "last_name": "B", "gender": "f", "birth_date": 946684800}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+	postJSON(t, "/visits/new", `{"id": 2, "location": 1, "user": 2, "visited_at": "1400000000", "mark": 2}`)
+	postJSON(t, "/visits/new", `{"id": 3, "location": 1, "user": 2, "visited_at": "1450000000", "mark": 3}`)
+
+	req, _ := http.NewRequest("GET", "/locations/1/stats", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var stats MarksStats
+	json.Unmarshal(response.Body.Bytes(), &stats)
+	expected := MarksStats{
+		Count:      3,
+		Mean:       3.3333,
+		Median:     3,
+		StdDev:     1.2472,
+		Histogram:  [MAX_MARK + 1]int{0, 0, 1, 1, 0, 1},
+		FirstVisit: "1400000000",
+		LastVisit:  "1500000000",
+	}
+	if stats != expected {
+		t.Errorf("Expected stats %+v. Got %+v", expected, stats)
+	}
+
+	req, _ = http.NewRequest("GET", "/locations/1/stats?groupBy=gender", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var m map[string]map[string]MarksStats
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["groups"]["f"].Count != 2 || m["groups"]["m"].Count != 1 {
+		t.Errorf("Expected 2 visits of 'f' group and 1 visit of 'm' group. Got %+v", m["groups"])
+	}
+
+	req, _ = http.NewRequest("GET", "/locations/1/stats?groupBy=city", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestGetUserStats(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/locations/new", `{"id": 2, "place": "Hermitage", "country": "Russia", "city": "Saint Petersburg", "distance": 5}`)
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+	postJSON(t, "/visits/new", `{"id": 2, "location": 2, "user": 1, "visited_at": "1400000000", "mark": 2}`)
+	postJSON(t, "/visits/new", `{"id": 3, "location": 1, "user": 1, "visited_at": "1450000000", "mark": 4}`)
+
+	req, _ := http.NewRequest("GET", "/users/1/stats?toDate=1480000000", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var stats UserStats
+	json.Unmarshal(response.Body.Bytes(), &stats)
+	if stats.VisitsCount != 2 || stats.AvgMark != 3 || stats.TotalDistance != 15 {
+		t.Errorf("Expected 2 visits, average mark 3 and total distance 15. Got %+v", stats)
+	}
+	if len(stats.Countries) != 1 || len(stats.Cities) != 2 {
+		t.Errorf("Expected 1 country and 2 cities. Got %v and %v", stats.Countries, stats.Cities)
+	}
+	if stats.FirstVisit != "1400000000" || stats.LastVisit != "1450000000" {
+		t.Errorf("Expected first visit 1400000000 and last visit 1450000000. Got %s and %s", stats.FirstVisit, stats.LastVisit)
+	}
+
+	// visits of deleted locations aren't counted, like in /users/1/visits
+	req, _ = http.NewRequest("DELETE", "/locations/2", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("GET", "/users/1/stats", nil)
+	response = executeRequest(req)
+	stats = UserStats{}
+	json.Unmarshal(response.Body.Bytes(), &stats)
+	req, _ = http.NewRequest("GET", "/users/1/visits", nil)
+	var visits []Visit
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &visits)
+	if stats.VisitsCount != 2 || len(visits) != 2 || stats.AvgMark != 4.5 || len(stats.Cities) != 1 {
+		t.Errorf("Expected 2 visits of Moscow with average mark 4.5. Got %+v and %d visits", stats, len(visits))
+	}
+
+	req, _ = http.NewRequest("GET", "/users/1/stats?fromDate=abc", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("GET", "/users/2/stats", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
+
+func TestGetTopLocations(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/locations/new", `{"id": 2, "place": "Hermitage", "country": "Russia", "city": "Saint Petersburg", "distance": 5}`)
+	postJSON(t, "/locations/new", `{"id": 3, "place": "Louvre", "country": "France", "city": "Paris", "distance": 3}`)
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/users/new", `{"id": 2, "email": "b@mail.com", "first_name": "B", "last_name": "B", "gender": "f", "birth_date": 946684800}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 4}`)
+	postJSON(t, "/visits/new", `{"id": 2, "location": 1, "user": 2, "visited_at": "1400000000", "mark": 2}`)
+	postJSON(t, "/visits/new", `{"id": 3, "location": 2, "user": 2, "visited_at": "1450000000", "mark": 4}`)
+	postJSON(t, "/visits/new", `{"id": 4, "location": 2, "user": 1, "visited_at": "1450000000", "mark": 5}`)
+	postJSON(t, "/visits/new", `{"id": 5, "location": 3, "user": 1, "visited_at": "1450000000", "mark": 5}`)
+
+	getRanks := func(query string) []LocationRank {
+		req, _ := http.NewRequest("GET", "/locations/top"+query, nil)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var ranks []LocationRank
+		json.Unmarshal(response.Body.Bytes(), &ranks)
+		return ranks
+	}
+
+	ranks := getRanks("?minVisits=2")
+	if len(ranks) != 2 || ranks[0].ID != 2 || ranks[0].Avg != 4.5 || ranks[1].ID != 1 || ranks[1].VisitsCount != 2 {
+		t.Errorf("Expected locations 2 and 1 with at least 2 visits. Got %+v", ranks)
+	}
+
+	ranks = getRanks("?country=Russia&limit=1&offset=1")
+	if len(ranks) != 1 || ranks[0].ID != 1 {
+		t.Errorf("Expected location 1 on the second place in Russia. Got %+v", ranks)
+	}
+
+	for _, ages := range [][2]int{{20, -1}, {-1, 25}, {10, 40}} {
+		query := "?fromAge=" + strconv.Itoa(ages[0]) + "&toAge=" + strconv.Itoa(ages[1])
+		if ages[0] == -1 {
+			query = "?toAge=" + strconv.Itoa(ages[1])
+		} else if ages[1] == -1 {
+			query = "?fromAge=" + strconv.Itoa(ages[0])
+		}
+		for _, rank := range getRanks(query) {
+			_, cnt := filterVisitsGetMarks(InitDb(), strconv.Itoa(rank.ID), avgFilter{fromAge: ages[0], toAge: ages[1]})
+			if cnt != rank.VisitsCount {
+				t.Errorf("Expected %d visits of location %d for query %s. Got %d", cnt, rank.ID, query, rank.VisitsCount)
+			}
+		}
+	}
+
+	// ages and dates are filtered like in /locations/<id>/avg
+	for _, query := range []string{"", "?fromAge=20", "?toAge=25", "?toAge=0", "?fromAge=10&toAge=30", "?gender=f&toAge=40", "?fromDate=1420000000&toAge=30"} {
+		ranksById := make(map[int]LocationRank)
+		for _, rank := range getRanks(query) {
+			ranksById[rank.ID] = rank
+		}
+		for id := 1; id <= 3; id++ {
+			req, _ := http.NewRequest("GET", "/locations/"+strconv.Itoa(id)+"/avg"+query, nil)
+			response := executeRequest(req)
+			checkResponseCode(t, http.StatusOK, response.Code)
+			var res struct{ Avg float64 }
+			json.Unmarshal(response.Body.Bytes(), &res)
+			if res.Avg != ranksById[id].Avg {
+				t.Errorf("Expected top average %v of location %d for query '%s' to be %v like /avg", ranksById[id].Avg, id, query, res.Avg)
+			}
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/locations/top?orderBy=name", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
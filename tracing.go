@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing uses OpenTelemetry SDK. Spans are exported to OTLP/HTTP collector or
+// as JSON lines to stdout or file.
+
+const (
+	// gorm DBs opened with InitRequestDb keep request context with this key
+	tracingContextKey = "tracing:context"
+	tracingSpanKey    = "tracing:span"
+
+	TRACEPARENT_HEADER = "traceparent"
+)
+
+// propagator reads and writes W3C traceparent header
+var propagator = propagation.TraceContext{}
+
+type tracing struct {
+	provider *sdktrace.TracerProvider
+}
+
+// tracingState keeps tracing, its provider is nil if tracing is disabled. It's
+// replaced atomically, so requests in progress can use it while it's stopped.
+var tracingState atomic.Value
+
+// getTracer returns tracer of the app or nil if tracing is disabled
+func getTracer() trace.Tracer {
+	state, _ := tracingState.Load().(tracing)
+	if state.provider == nil {
+		return nil
+	}
+	return state.provider.Tracer("rest_app")
+}
+
+func startTracer(exporter sdktrace.SpanExporter) {
+	res := resource.NewSchemaless(
+		attribute.String("service.name", TRACING_SERVICE_NAME),
+		attribute.String("service.version", BUILD_COMMIT),
+	)
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	tracingState.Store(tracing{provider: provider})
+}
+
+// stopTracer exports remaining spans. Spans ended after it are dropped.
+func stopTracer() {
+	state, _ := tracingState.Load().(tracing)
+	if state.provider == nil {
+		return
+	}
+	tracingState.Store(tracing{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := state.provider.Shutdown(ctx); err != nil {
+		log.WithFields(log.Fields{"module": "tracing"}).Error(err)
+	}
+}
+
+// TracingMiddleware starts server span of request, continuing trace of
+// traceparent header if it's set. Requests of unsampled traces aren't recorded.
+func TracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracer := getTracer()
+		if tracer == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			route, _ = current.GetPathTemplate()
+		}
+		ctx, span := tracer.Start(ctx, r.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("user_agent.original", r.UserAgent()),
+		)
+		if requestID := r.Header.Get(REQUEST_ID_HEADER); requestID != "" {
+			span.SetAttributes(attribute.String("request_id", requestID))
+		}
+		propagator.Inject(ctx, propagation.HeaderCarrier(w.Header()))
+
+		lw := &loggingResponseWriter{ResponseWriter: w, statusCode: 200}
+		next.ServeHTTP(lw, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", lw.statusCode))
+		if lw.statusCode >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(lw.statusCode))
+		}
+	})
+}
+
+// isTraced checks if request has recorded span
+func isTraced(r *http.Request) bool {
+	return trace.SpanFromContext(r.Context()).IsRecording()
+}
+
+// registerQuerySpans starts span of every query of gorm callback made with DB
+// opened by InitRequestDb. processor returns new processor for every registration.
+func registerQuerySpans(processor func() *gorm.CallbackProcessor, callbackName string, operation string) {
+	processor().Before(callbackName).Register("tracing:before_"+operation, func(scope *gorm.Scope) {
+		ctx, ok := scope.Get(tracingContextKey)
+		tracer := getTracer()
+		if !ok || tracer == nil {
+			return
+		}
+		_, span := tracer.Start(ctx.(context.Context), "gorm."+operation+" "+scope.TableName(), trace.WithSpanKind(trace.SpanKindClient))
+		scope.Set(tracingSpanKey, span)
+	})
+	processor().After(callbackName).Register("tracing:after_"+operation, func(scope *gorm.Scope) {
+		value, ok := scope.Get(tracingSpanKey)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		span.SetAttributes(
+			attribute.String("db.system", "sqlite"),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.collection.name", scope.TableName()),
+			attribute.String("db.query.text", scope.SQL),
+		)
+		if scope.HasError() && !gorm.IsRecordNotFoundError(scope.DB().Error) {
+			span.SetStatus(codes.Error, scope.DB().Error.Error())
+		}
+		span.End()
+	})
+}
+
+func init() {
+	registerQuerySpans(gorm.DefaultCallback.Create, "gorm:create", "create")
+	registerQuerySpans(gorm.DefaultCallback.Query, "gorm:query", "query")
+	registerQuerySpans(gorm.DefaultCallback.RowQuery, "gorm:row_query", "row_query")
+	registerQuerySpans(gorm.DefaultCallback.Update, "gorm:update", "update")
+	registerQuerySpans(gorm.DefaultCallback.Delete, "gorm:delete", "delete")
+}
+
+// initTracing starts tracer with TRACING_EXPORTER: "otlp", "stdout" or "file".
+// Tracing is disabled if exporter isn't set.
+func initTracing() error {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch TRACING_EXPORTER {
+	case "":
+		return nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(OTLP_ENDPOINT))
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "file":
+		file, fileErr := openRotatingFile(TRACING_FILE_PATH, int64(LOG_MAX_SIZE_MB)<<20, LOG_MAX_BACKUPS)
+		if fileErr != nil {
+			return fileErr
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return errors.New("TRACING_EXPORTER must be otlp, stdout or file")
+	}
+	if err != nil {
+		return err
+	}
+	startTracer(exporter)
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (e *memoryExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memoryExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func getSpanAttribute(span sdktrace.ReadOnlySpan, key string) string {
+	for _, attribute := range span.Attributes() {
+		if string(attribute.Key) == key {
+			return attribute.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracing(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+
+	exporter := &memoryExporter{}
+	startTracer(exporter)
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest("GET", "/users/1/stats", nil)
+	req.Header.Set(TRACEPARENT_HEADER, "00-"+traceID+"-00f067aa0ba902b7-01")
+	response := executeRequest(req)
+	stopTracer()
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var serverSpan sdktrace.ReadOnlySpan
+	for _, span := range exporter.spans {
+		if span.SpanKind() == trace.SpanKindServer {
+			serverSpan = span
+		}
+	}
+	if serverSpan == nil {
+		t.Fatal("Expected server span to be exported")
+	}
+	spanContext := serverSpan.SpanContext()
+	if serverSpan.Name() != "GET /users/{id}/stats" || spanContext.TraceID().String() != traceID || serverSpan.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Unexpected server span %s of trace %s with parent %s", serverSpan.Name(), spanContext.TraceID(), serverSpan.Parent().SpanID())
+	}
+	expected := "00-" + traceID + "-" + spanContext.SpanID().String() + "-01"
+	if response.Header().Get(TRACEPARENT_HEADER) != expected {
+		t.Errorf("Expected traceparent %s of server span in response. Got %s", expected, response.Header().Get(TRACEPARENT_HEADER))
+	}
+
+	tables := make(map[string]bool)
+	for _, span := range exporter.spans {
+		if span.SpanKind() == trace.SpanKindClient && span.Parent().SpanID() == spanContext.SpanID() && span.SpanContext().TraceID() == spanContext.TraceID() {
+			tables[getSpanAttribute(span, "db.collection.name")] = true
+		}
+	}
+	for _, table := range []string{"users", "visits", "locations"} {
+		if !tables[table] {
+			t.Errorf("Expected query span of %s table", table)
+		}
+	}
+}
+
+func TestTracingLocationAggregates(t *testing.T) {
+	ClearDB()
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Red Square", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/visits/new", `{"id": 1, "location": 1, "user": 1, "visited_at": "1500000000", "mark": 5}`)
+
+	for url, table := range map[string]string{
+		"/locations/1/avg":                     "location_marks",
+		"/locations/1/avg?fromDate=1400000000": "visits",
+		"/locations/1/stats":                   "visits",
+	} {
+		exporter := &memoryExporter{}
+		startTracer(exporter)
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set(TRACEPARENT_HEADER, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		response := executeRequest(req)
+		stopTracer()
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		traced := false
+		for _, span := range exporter.spans {
+			if span.SpanKind() == trace.SpanKindClient && getSpanAttribute(span, "db.collection.name") == table {
+				traced = true
+			}
+		}
+		if !traced {
+			t.Errorf("Expected query span of %s table in %s", table, url)
+		}
+	}
+}
+
+func TestTracingNotSampled(t *testing.T) {
+	exporter := &memoryExporter{}
+	startTracer(exporter)
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest("GET", "/users", nil)
+	req.Header.Set(TRACEPARENT_HEADER, "00-"+traceID+"-00f067aa0ba902b7-00")
+	response := executeRequest(req)
+	stopTracer()
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	if len(exporter.spans) != 0 {
+		t.Errorf("Expected spans of unsampled trace not to be exported. Got %d", len(exporter.spans))
+	}
+	traceparent := response.Header().Get(TRACEPARENT_HEADER)
+	if !strings.HasPrefix(traceparent, "00-"+traceID+"-") || !strings.HasSuffix(traceparent, "-00") {
+		t.Errorf("Expected traceparent of unsampled trace in response. Got %s", traceparent)
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/users", nil)
+	response := executeRequest(req)
+	if response.Header().Get(TRACEPARENT_HEADER) != "" {
+		t.Errorf("Expected no traceparent when tracing is disabled")
+	}
+}
+
+func TestStopTracerDuringRequests(t *testing.T) {
+	startTracer(&memoryExporter{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/users", nil)
+			checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+		}()
+	}
+	stopTracer()
+	wg.Wait()
+}
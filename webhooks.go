@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	WEBHOOK_SIGNATURE_HEADER = "X-Webhook-Signature"
+	WEBHOOK_TIMESTAMP_HEADER = "X-Webhook-Timestamp"
+	WEBHOOK_ID_HEADER        = "X-Webhook-ID"
+	EVENT_ID_HEADER          = "X-Event-ID"
+	EVENT_TYPE_HEADER        = "X-Event-Type"
+
+	// outbox sinks of webhooks are named "webhook:<id>"
+	WEBHOOK_SINK_PREFIX = "webhook:"
+)
+
+// Webhook gets events of entity, or of all entities if entity is empty.
+// Secret is returned only when webhook is created.
+type Webhook struct {
+	ID        int    `json:"id"`
+	URL       string `json:"url"`
+	Entity    string `json:"entity"`
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt int    `json:"created_at"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// WebhookDeadLetter is an event which wasn't delivered to webhook after all
+// attempts
+type WebhookDeadLetter struct {
+	ID        int
+	WebhookID int
+	EventID   int
+	Payload   string
+	Attempts  int
+	Error     string
+	CreatedAt int
+}
+
+func (WebhookDeadLetter) TableName() string {
+	return "webhook_dead_letters"
+}
+
+// signWebhook returns signature of "<timestamp>.<body>" with secret of webhook
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookSink delivers events of entity of webhook. Every webhook has outbox
+// cursor and worker of its own, so failing webhook doesn't delay others.
+type webhookSink struct {
+	webhook Webhook
+}
+
+func getWebhookSinkName(id int) string {
+	return WEBHOOK_SINK_PREFIX + strconv.Itoa(id)
+}
+
+func (s webhookSink) Deliver(e Event) error {
+	if s.webhook.Entity != "" && s.webhook.Entity != e.Entity {
+		return nil
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return deliverWebhook(s.webhook, e, payload)
+}
+
+// RetryDelay doubles WEBHOOK_RETRY_DELAY_MS after each attempt
+func (webhookSink) RetryDelay(attempts int) time.Duration {
+	delay := time.Duration(WEBHOOK_RETRY_DELAY_MS) * time.Millisecond
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+// GiveUp saves event to dead letters after WEBHOOK_MAX_ATTEMPTS
+func (s webhookSink) GiveUp(e Event, attempts int, deliveryErr error) bool {
+	if attempts < WEBHOOK_MAX_ATTEMPTS {
+		return false
+	}
+	payload, _ := json.Marshal(e)
+	if err := saveDeadLetter(s.webhook, e, payload, attempts, deliveryErr.Error()); err != nil {
+		log.WithFields(log.Fields{"module": "webhooks", "webhook_id": s.webhook.ID}).Error(err)
+		return false
+	}
+	return true
+}
+
+// startWebhookWorkers starts outbox workers of registered webhooks. Workers of
+// webhooks created or deleted later are started or stopped with them.
+func startWebhookWorkers() error {
+	outboxDispatcher.Lock()
+	outboxDispatcher.webhooks = true
+	outboxDispatcher.Unlock()
+
+	db := InitDb()
+	defer db.Close()
+
+	var webhooks []Webhook
+	if err := db.Find(&webhooks).Error; err != nil {
+		return err
+	}
+	for _, webhook := range webhooks {
+		startWebhookWorker(webhook)
+	}
+	return nil
+}
+
+// startWebhookWorker starts outbox worker of webhook if webhooks are enabled
+func startWebhookWorker(webhook Webhook) {
+	outboxDispatcher.Lock()
+	enabled := outboxDispatcher.webhooks
+	outboxDispatcher.Unlock()
+	if enabled {
+		startOutboxWorker(getWebhookSinkName(webhook.ID), webhookSink{webhook})
+	}
+}
+
+func deliverWebhook(webhook Webhook, e Event, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(WEBHOOK_TIMEOUT_SECONDS)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WEBHOOK_ID_HEADER, strconv.Itoa(webhook.ID))
+	req.Header.Set(EVENT_ID_HEADER, strconv.Itoa(e.ID))
+	req.Header.Set(EVENT_TYPE_HEADER, e.Type)
+	req.Header.Set(WEBHOOK_TIMESTAMP_HEADER, timestamp)
+	req.Header.Set(WEBHOOK_SIGNATURE_HEADER, signWebhook(webhook.Secret, timestamp, payload))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("Response status %d", res.StatusCode)
+	}
+	return nil
+}
+
+func saveDeadLetter(webhook Webhook, e Event, payload []byte, attempts int, deliveryErr string) error {
+	db := InitDb()
+	defer db.Close()
+
+	return db.Create(&WebhookDeadLetter{
+		WebhookID: webhook.ID,
+		EventID:   e.ID,
+		Payload:   string(payload),
+		Attempts:  attempts,
+		Error:     deliveryErr,
+		CreatedAt: int(time.Now().Unix()),
+	}).Error
+}
+
+func isValidWebhookURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func newWebhookSecret() string {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return hex.EncodeToString(secret)
+}
+
+func getWebhooks(w http.ResponseWriter, r *http.Request) {
+	db := InitRequestDb(r)
+	defer db.Close()
+
+	var webhooks []Webhook
+	db.Order("id").Find(&webhooks)
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	if webhooks == nil {
+		webhooks = []Webhook{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+// createWebhook registers webhook, secret is generated if it isn't given.
+// Outbox cursor of webhook starts at the last entry, so it gets events of
+// changes made after it's created.
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := readRequestBody(r)
+	if err != nil {
+		res, statusCode := getBodyErrorResponse(err)
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+	var webhook Webhook
+	err = decodeStrict(body, &webhook)
+	if err != nil || webhook.ID != 0 || webhook.CreatedAt != 0 || !isValidWebhookURL(webhook.URL) ||
+		(webhook.Entity != "" && !isEventEntity(webhook.Entity)) {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"Error": "Bad request body parameters"})
+		return
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = newWebhookSecret()
+	}
+	webhook.CreatedAt = int(time.Now().Unix())
+
+	db := InitRequestDb(r)
+	defer db.Close()
+	tx := db.Begin()
+	err = tx.Create(&webhook).Error
+	if err == nil {
+		err = tx.Exec(`INSERT INTO outbox_cursors (sink, last_id, last_error, updated_at)
+SELECT ?, COALESCE(MAX(id), 0), '', ? FROM outbox`, getWebhookSinkName(webhook.ID), webhook.CreatedAt).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	}
+	if err != nil {
+		tx.Rollback()
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(map[string]string{"Error": "Webhook can't be saved"})
+		return
+	}
+	startWebhookWorker(webhook)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	db := InitRequestDb(r)
+	defer db.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	query := db.Where("id = ?", id).Delete(Webhook{})
+	if query.Error != nil {
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(map[string]string{"Error": "Webhook can't be deleted"})
+		return
+	}
+	if query.RowsAffected == 0 {
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]string{"Error": "Webhook not found"})
+		return
+	}
+	stopOutboxWorker(getWebhookSinkName(id))
+	db.Where("sink = ?", getWebhookSinkName(id)).Delete(OutboxCursor{})
+	json.NewEncoder(w).Encode(map[string]interface{}{"Success": true})
+}
+
+func getWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	db := InitRequestDb(r)
+	defer db.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	qsParams := r.URL.Query()
+	webhookID, webhookOk := getIntParam(qsParams, "webhook", -1)
+	limit, limitOk := getIntParam(qsParams, "limit", MAX_LIMIT)
+	offset, offsetOk := getIntParam(qsParams, "offset", 0)
+	if !webhookOk || !limitOk || !offsetOk || limit < 1 || limit > MAX_LIMIT || offset < 0 {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"Error": "Bad query string parameters"})
+		return
+	}
+
+	query := db.Order("id")
+	if webhookID != -1 {
+		query = query.Where("webhook_id = ?", webhookID)
+	}
+	var deadLetters []WebhookDeadLetter
+	query.Limit(limit).Offset(offset).Find(&deadLetters)
+
+	res := make([]map[string]interface{}, 0, len(deadLetters))
+	for _, deadLetter := range deadLetters {
+		res = append(res, map[string]interface{}{
+			"id":         deadLetter.ID,
+			"webhook_id": deadLetter.WebhookID,
+			"event_id":   deadLetter.EventID,
+			"payload":    rawImage(deadLetter.Payload),
+			"attempts":   deadLetter.Attempts,
+			"error":      deadLetter.Error,
+			"created_at": deadLetter.CreatedAt,
+		})
+	}
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records events with valid signatures and fails first
+// failures requests
+type webhookReceiver struct {
+	mu       sync.Mutex
+	secret   string
+	failures int
+	requests int
+	events   []Event
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	wr.requests++
+	if wr.requests <= wr.failures {
+		w.WriteHeader(500)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	if r.Header.Get(WEBHOOK_SIGNATURE_HEADER) != signWebhook(wr.secret, r.Header.Get(WEBHOOK_TIMESTAMP_HEADER), body) {
+		w.WriteHeader(401)
+		return
+	}
+	var e Event
+	json.Unmarshal(body, &e)
+	wr.events = append(wr.events, e)
+}
+
+func (wr *webhookReceiver) getEvents() []Event {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	return append([]Event(nil), wr.events...)
+}
+
+func createTestWebhook(t *testing.T, url string, entity string) Webhook {
+	body, _ := json.Marshal(map[string]string{"url": url, "entity": entity})
+	req, _ := http.NewRequest("POST", "/webhooks/new", bytes.NewReader(body))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var webhook Webhook
+	json.Unmarshal(response.Body.Bytes(), &webhook)
+	if webhook.ID == 0 || webhook.Secret == "" {
+		t.Fatalf("Expected webhook with id and secret. Got %s", response.Body.String())
+	}
+	return webhook
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out")
+		}
+	}
+}
+
+// clearWebhooks deletes webhooks with their outbox workers
+func clearWebhooks() {
+	var webhooks []Webhook
+	db.Find(&webhooks)
+	for _, webhook := range webhooks {
+		req, _ := http.NewRequest("DELETE", "/webhooks/"+strconv.Itoa(webhook.ID), nil)
+		executeRequest(req)
+	}
+	db.Delete(WebhookDeadLetter{})
+}
+
+func TestWebhooks(t *testing.T) {
+	ClearDB()
+	clearWebhooks()
+	defer clearWebhooks()
+	defer func(attempts, delay int) {
+		WEBHOOK_MAX_ATTEMPTS, WEBHOOK_RETRY_DELAY_MS = attempts, delay
+	}(WEBHOOK_MAX_ATTEMPTS, WEBHOOK_RETRY_DELAY_MS)
+	WEBHOOK_MAX_ATTEMPTS, WEBHOOK_RETRY_DELAY_MS = 3, 1
+
+	// the first delivery fails and is retried
+	receiver := &webhookReceiver{failures: 1}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	// webhook doesn't get events of changes made before it's created
+	postJSON(t, "/locations/new", `{"id": 2, "place": "Place", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	receiver.secret = createTestWebhook(t, server.URL, "locations").Secret
+
+	postJSON(t, "/users/new", `{"id": 1, "email": "a@mail.com", "first_name": "A", "last_name": "A", "gender": "m", "birth_date": 631152000}`)
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Place", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	postJSON(t, "/locations/1", `{"distance": 20}`)
+
+	waitFor(t, func() bool { return len(receiver.getEvents()) == 2 })
+	received := receiver.getEvents()
+	var location Location
+	json.Unmarshal(received[1].Data, &location)
+	if received[0].Type != EVENT_CREATED || received[0].EntityID != 1 || received[1].Type != EVENT_UPDATED || location.Distance != 20 {
+		t.Errorf("Expected created and updated location events in order. Got %+v", received)
+	}
+
+	req, _ := http.NewRequest("GET", "/webhooks", nil)
+	response := executeRequest(req)
+	var webhooks []Webhook
+	json.Unmarshal(response.Body.Bytes(), &webhooks)
+	if len(webhooks) != 1 || webhooks[0].Secret != "" {
+		t.Errorf("Expected one webhook without secret. Got %s", response.Body.String())
+	}
+}
+
+func TestWebhookDeadLetters(t *testing.T) {
+	ClearDB()
+	clearWebhooks()
+	defer clearWebhooks()
+	defer func(attempts, delay int) {
+		WEBHOOK_MAX_ATTEMPTS, WEBHOOK_RETRY_DELAY_MS = attempts, delay
+	}(WEBHOOK_MAX_ATTEMPTS, WEBHOOK_RETRY_DELAY_MS)
+	WEBHOOK_MAX_ATTEMPTS, WEBHOOK_RETRY_DELAY_MS = 3, 1
+
+	receiver := &webhookReceiver{failures: 1000}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	webhook := createTestWebhook(t, server.URL, "")
+
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Place", "country": "Russia", "city": "Moscow", "distance": 10}`)
+
+	var deadLetters []map[string]interface{}
+	waitFor(t, func() bool {
+		req, _ := http.NewRequest("GET", "/webhooks/dead_letters", nil)
+		json.Unmarshal(executeRequest(req).Body.Bytes(), &deadLetters)
+		return len(deadLetters) == 1
+	})
+	deadLetter := deadLetters[0]
+	payload, _ := deadLetter["payload"].(map[string]interface{})
+	if deadLetter["webhook_id"] != float64(webhook.ID) || deadLetter["attempts"] != float64(3) ||
+		deadLetter["error"] != "Response status 500" || payload["type"] != EVENT_CREATED {
+		t.Errorf("Expected dead letter of created location after 3 attempts. Got %v", deadLetter)
+	}
+	receiver.mu.Lock()
+	if receiver.requests != 3 {
+		t.Errorf("Expected 3 delivery attempts. Got %d", receiver.requests)
+	}
+	receiver.mu.Unlock()
+
+	// worker and cursor are removed with webhook
+	req, _ := http.NewRequest("DELETE", "/webhooks/"+strconv.Itoa(webhook.ID), nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+	for _, sink := range getOutboxSinks() {
+		if sink == getWebhookSinkName(webhook.ID) {
+			t.Errorf("Expected worker of deleted webhook to be stopped")
+		}
+	}
+	var count int
+	db.Model(&OutboxCursor{}).Where("sink = ?", getWebhookSinkName(webhook.ID)).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected cursor of deleted webhook to be removed")
+	}
+}
+
+func TestFailingWebhook(t *testing.T) {
+	ClearDB()
+	clearWebhooks()
+	defer clearWebhooks()
+	defer func(delay int) { WEBHOOK_RETRY_DELAY_MS = delay }(WEBHOOK_RETRY_DELAY_MS)
+	WEBHOOK_RETRY_DELAY_MS = 60000
+
+	failing := &webhookReceiver{failures: 1000}
+	failingServer := httptest.NewServer(failing)
+	defer failingServer.Close()
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	failingWebhook := createTestWebhook(t, failingServer.URL, "")
+	receiver.secret = createTestWebhook(t, server.URL, "").Secret
+
+	// retries of failing webhook don't delay others
+	postJSON(t, "/locations/new", `{"id": 1, "place": "Place", "country": "Russia", "city": "Moscow", "distance": 10}`)
+	waitFor(t, func() bool { return len(receiver.getEvents()) == 1 })
+	sink := getWebhookSinkName(failingWebhook.ID)
+	waitFor(t, func() bool { return getOutboxSinkLag(t, sink)["attempts"] != float64(0) })
+	lag := getOutboxSinkLag(t, sink)
+	if lag["lag"] != float64(1) || lag["attempts"] != float64(1) || lag["last_error"] != "Response status 500" {
+		t.Errorf("Expected failed delivery waiting for retry. Got %v", lag)
+	}
+}
+
+func TestCreateWebhookValidation(t *testing.T) {
+	defer clearWebhooks()
+	for _, body := range []string{
+		`{"url": "ftp://example.com"}`,
+		`{"url": "http://example.com", "entity": "badentity"}`,
+		`{"url": "http://example.com", "unknown": 1}`,
+	} {
+		req, _ := http.NewRequest("POST", "/webhooks/new", bytes.NewBufferString(body))
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+	}
+
+	readerKey, _, _ := CreateApiKey("reader", ROLE_READER, 0)
+	req, _ := http.NewRequest("GET", "/webhooks", nil)
+	req.Header.Set(API_KEY_HEADER, readerKey)
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+}